@@ -0,0 +1,370 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultArchiveIndex = "events"
+const defaultPageSize = 1000
+
+// ArchiveClient читает документы архива из Elasticsearch
+type ArchiveClient struct {
+	baseUrl    string
+	index      string
+	pageSize   int
+	httpClient *http.Client
+}
+
+// NewArchiveClient создает клиент архива для сервера baseUrl (например http://localhost:9200).
+// Если httpClient не задан, используется http.DefaultClient
+func NewArchiveClient(baseUrl string, httpClient *http.Client) *ArchiveClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &ArchiveClient{
+		baseUrl:    strings.TrimRight(baseUrl, "/"),
+		index:      defaultArchiveIndex,
+		pageSize:   defaultPageSize,
+		httpClient: httpClient}
+}
+
+// MeasurePoint значение измерения или атрибута на момент времени.
+// Если значение не определено, Value содержит NaN
+type MeasurePoint struct {
+	Time  time.Time
+	Value float32
+}
+
+type searchHit struct {
+	Source json.RawMessage `json:"_source"`
+	Sort   []interface{}   `json:"sort"`
+}
+
+type searchResponse struct {
+	Hits struct {
+		Hits []searchHit `json:"hits"`
+	} `json:"hits"`
+}
+
+// Отправляет запрос POST на путь path сервера и разбирает ответ в result
+func (client *ArchiveClient) doPost(ctx context.Context, path string, query interface{}, result interface{}) error {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, client.baseUrl+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("archive request %s failed with status %d: %s", path, response.StatusCode, string(responseBody))
+	}
+
+	return json.Unmarshal(responseBody, result)
+}
+
+func (client *ArchiveClient) doSearch(ctx context.Context, query map[string]interface{}) (*searchResponse, error) {
+	var result searchResponse
+	if err := client.doPost(ctx, fmt.Sprintf("/%s/_search", client.index), query, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Выполняет запрос с постраничным чтением через search_after и вызывает handler для каждой страницы документов.
+// Запрос должен содержать сортировку, однозначно упорядочивающую документы
+func (client *ArchiveClient) searchPages(ctx context.Context, query map[string]interface{}, handler func(sources []json.RawMessage) error) error {
+	query["size"] = client.pageSize
+
+	for {
+		result, err := client.doSearch(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		hits := result.Hits.Hits
+		if len(hits) > 0 {
+			sources := make([]json.RawMessage, 0, len(hits))
+			for _, hit := range hits {
+				sources = append(sources, hit.Source)
+			}
+
+			if err = handler(sources); err != nil {
+				return err
+			}
+		}
+
+		if len(hits) < client.pageSize {
+			return nil
+		}
+
+		query["search_after"] = hits[len(hits)-1].Sort
+	}
+}
+
+// Выполняет запрос с постраничным чтением через search_after и вызывает handler для каждого документа.
+// Запрос должен содержать сортировку, однозначно упорядочивающую документы
+func (client *ArchiveClient) search(ctx context.Context, query map[string]interface{}, handler func(source json.RawMessage) error) error {
+	return client.searchPages(ctx, query, func(sources []json.RawMessage) error {
+		for _, source := range sources {
+			if err := handler(source); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func getTimeRangeQuery(from time.Time, to time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			"time": map[string]int64{
+				"gte": core.GetUnixMillisecondsFromTime(from),
+				"lte": core.GetUnixMillisecondsFromTime(to)}}}
+}
+
+func getTimeSort() []interface{} {
+	return []interface{}{
+		map[string]string{"time": "asc"},
+		map[string]string{"deviceId": "asc"},
+		map[string]string{"format": "asc"}}
+}
+
+func getMeasureHistoryQuery(objectId int, measureId int, isAttribute bool, from time.Time, to time.Time) map[string]interface{} {
+	field, idField := "measures", "measureId"
+	if isAttribute {
+		field, idField = "attributes", "attributeId"
+	}
+
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					getTimeRangeQuery(from, to),
+					map[string]interface{}{"term": map[string]int{field + ".objectId": objectId}},
+					map[string]interface{}{"term": map[string]int{field + "." + idField: measureId}},
+				}}},
+		"sort": getTimeSort()}
+}
+
+func getMeasureRecord(doc *MeasuresDocument, objectId int, measureId int, isAttribute bool) *MeasureRecord {
+	var item *MeasureOrAttributeItem
+
+	if isAttribute {
+		for i := range doc.Attributes {
+			if doc.Attributes[i].ObjectId == objectId && doc.Attributes[i].AttributeId == measureId {
+				item = &doc.Attributes[i].MeasureOrAttributeItem
+				break
+			}
+		}
+	} else {
+		for i := range doc.Measures {
+			if doc.Measures[i].ObjectId == objectId && doc.Measures[i].MeasureId == measureId {
+				item = &doc.Measures[i].MeasureOrAttributeItem
+				break
+			}
+		}
+	}
+
+	// Поля массива не вложенные, поэтому документ может содержать объект и измерение в разных элементах
+	if item == nil {
+		return nil
+	}
+
+	return newMeasureRecord(doc, item, measureId, isAttribute)
+}
+
+// StreamMeasureHistory вызывает handler для каждого изменения измерения или атрибута объекта за период
+// в порядке возрастания времени, не загружая всю историю в память
+func (client *ArchiveClient) StreamMeasureHistory(ctx context.Context, objectId int, measureId int, isAttribute bool,
+	from time.Time, to time.Time, handler func(record *MeasureRecord) error) error {
+
+	return client.search(ctx, getMeasureHistoryQuery(objectId, measureId, isAttribute, from, to), func(source json.RawMessage) error {
+		decoded, err := DecodeDocument(source)
+		if err != nil {
+			return err
+		}
+
+		doc, ok := decoded.(*MeasuresDocument)
+		if !ok {
+			return nil
+		}
+
+		if record := getMeasureRecord(doc, objectId, measureId, isAttribute); record != nil {
+			return handler(record)
+		}
+
+		return nil
+	})
+}
+
+func (client *ArchiveClient) queryHistory(ctx context.Context, objectId int, measureId int, isAttribute bool,
+	from time.Time, to time.Time) ([]MeasurePoint, error) {
+
+	var result []MeasurePoint
+
+	err := client.StreamMeasureHistory(ctx, objectId, measureId, isAttribute, from, to, func(record *MeasureRecord) error {
+		result = append(result, MeasurePoint{Time: record.Time, Value: record.Value})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// QueryMeasureHistory возвращает изменения измерения объекта за период в порядке возрастания времени
+func (client *ArchiveClient) QueryMeasureHistory(ctx context.Context, objectId int, measureId int,
+	from time.Time, to time.Time) ([]MeasurePoint, error) {
+	return client.queryHistory(ctx, objectId, measureId, false, from, to)
+}
+
+// QueryAttributeHistory возвращает изменения атрибута объекта за период в порядке возрастания времени
+func (client *ArchiveClient) QueryAttributeHistory(ctx context.Context, objectId int, attributeId int,
+	from time.Time, to time.Time) ([]MeasurePoint, error) {
+	return client.queryHistory(ctx, objectId, attributeId, true, from, to)
+}
+
+func getStationDocumentsQuery(stationId int, formats []byte, timeRange map[string]interface{}) map[string]interface{} {
+	formatIds := make([]int, len(formats))
+	for i, format := range formats {
+		formatIds[i] = int(format)
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				timeRange,
+				map[string]interface{}{"term": map[string]int{"stations": stationId}},
+				map[string]interface{}{"terms": map[string][]int{"format": formatIds}},
+			}}}
+}
+
+// ReadLatestDocuments возвращает для каждого устройства последний документ станции формата format
+// со временем не позже before
+func (client *ArchiveClient) ReadLatestDocuments(ctx context.Context, stationId int, format byte, before time.Time) ([][]byte, error) {
+	timeRange := map[string]interface{}{
+		"range": map[string]interface{}{
+			"time": map[string]int64{"lte": core.GetUnixMillisecondsFromTime(before)}}}
+
+	// Свертка по устройству оставляет первый документ в порядке сортировки
+	query := map[string]interface{}{
+		"query":    getStationDocumentsQuery(stationId, []byte{format}, timeRange),
+		"sort":     []interface{}{map[string]string{"time": "desc"}},
+		"collapse": map[string]string{"field": "deviceId"},
+		"size":     client.pageSize}
+
+	response, err := client.doSearch(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([][]byte, len(response.Hits.Hits))
+	for i, hit := range response.Hits.Hits {
+		result[i] = hit.Source
+	}
+
+	return result, nil
+}
+
+// ReadDocuments вызывает handler для документов станции указанных форматов за период в порядке возрастания времени
+func (client *ArchiveClient) ReadDocuments(ctx context.Context, stationId int, formats []byte, from time.Time, to time.Time,
+	handler func(document []byte) error) error {
+
+	query := map[string]interface{}{
+		"query": getStationDocumentsQuery(stationId, formats, getTimeRangeQuery(from, to)),
+		"sort":  getTimeSort()}
+
+	return client.search(ctx, query, func(source json.RawMessage) error {
+		return handler(source)
+	})
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// WriteRequestItems записывает запросы через _bulk. Документы, которые уже есть в архиве, не считаются ошибкой,
+// поэтому повторная запись после сбоя безопасна
+func (client *ArchiveClient) WriteRequestItems(ctx context.Context, items []*RequestItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	var builder strings.Builder
+	for _, item := range items {
+		item.AddToBuilder(&builder)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, client.baseUrl+"/_bulk", strings.NewReader(builder.String()))
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-ndjson")
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("archive bulk request failed with status %d: %s", response.StatusCode, string(responseBody))
+	}
+
+	var result bulkResponse
+	if err = json.Unmarshal(responseBody, &result); err != nil {
+		return err
+	}
+
+	if !result.Errors {
+		return nil
+	}
+
+	for _, item := range result.Items {
+		for _, action := range item {
+			if action.Error != nil && action.Status != http.StatusConflict {
+				return fmt.Errorf("archive bulk request item failed with status %d: %s", action.Status, string(action.Error))
+			}
+		}
+	}
+
+	return nil
+}
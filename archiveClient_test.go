@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func getHistoryTestHit(time int64, objectId int, measureId int, value string) string {
+	return fmt.Sprintf(`{"_source":{"schemaVersion":2,"time":%d,"stations":[1],"deviceId":10,"format":0,`+
+		`"measures":[{"objectId":%d,"measureId":%d,"unit":"В","objectTypeId":1%s}]},"sort":[%d,10,0]}`,
+		time, objectId, measureId, value, time)
+}
+
+func TestArchiveClient_QueryMeasureHistory(t *testing.T) {
+	pages := []string{
+		fmt.Sprintf(`{"hits":{"hits":[%s,%s]}}`,
+			getHistoryTestHit(1000, 5, 7, `,"value":1.5`),
+			getHistoryTestHit(2000, 5, 8, `,"value":2.5`)),
+		fmt.Sprintf(`{"hits":{"hits":[%s]}}`,
+			getHistoryTestHit(3000, 5, 7, ``)),
+	}
+
+	var queries []map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/events/_search", r.URL.Path)
+
+		body, _ := ioutil.ReadAll(r.Body)
+		var query map[string]interface{}
+		assert.Nil(t, json.Unmarshal(body, &query))
+		queries = append(queries, query)
+
+		_, _ = w.Write([]byte(pages[len(queries)-1]))
+	}))
+	defer server.Close()
+
+	client := NewArchiveClient(server.URL+"/", server.Client())
+	client.pageSize = 2
+
+	points, err := client.QueryMeasureHistory(context.Background(), 5, 7, time.Unix(0, 0), time.Unix(10, 0))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(queries))
+
+	_, ok := queries[0]["search_after"]
+	assert.False(t, ok)
+	assert.Equal(t, []interface{}{float64(2000), float64(10), float64(0)}, queries[1]["search_after"])
+	assert.Equal(t, float64(2), queries[1]["size"])
+
+	// Документ, в котором нет измерения объекта, пропускается
+	assert.Equal(t, 2, len(points))
+	assert.Equal(t, time.Unix(1, 0), points[0].Time)
+	assert.Equal(t, float32(1.5), points[0].Value)
+	assert.Equal(t, time.Unix(3, 0), points[1].Time)
+	assert.True(t, core.IsNaN(points[1].Value))
+}
+
+func TestArchiveClient_QueryMeasureHistoryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"index_not_found_exception"}`))
+	}))
+	defer server.Close()
+
+	client := NewArchiveClient(server.URL, nil)
+
+	points, err := client.QueryAttributeHistory(context.Background(), 5, 7, time.Unix(0, 0), time.Unix(10, 0))
+
+	assert.Nil(t, points)
+	assert.NotNil(t, err)
+}
+
+func TestGetMeasureHistoryQuery(t *testing.T) {
+	query := getMeasureHistoryQuery(5, 7, true, time.Unix(1, 0), time.Unix(2, 0))
+
+	buf, err := json.Marshal(query)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `{"query":{"bool":{"filter":[{"range":{"time":{"gte":1000,"lte":2000}}},`+
+		`{"term":{"attributes.objectId":5}},{"term":{"attributes.attributeId":7}}]}},`+
+		`"sort":[{"time":"asc"},{"deviceId":"asc"},{"format":"asc"}]}`, string(buf))
+}
+
+func TestArchiveClient_ReadLatestDocuments(t *testing.T) {
+	var query map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Nil(t, json.Unmarshal(body, &query))
+
+		_, _ = w.Write([]byte(`{"hits":{"hits":[{"_source":{"time":1000,"deviceId":1}},{"_source":{"time":900,"deviceId":2}}]}}`))
+	}))
+	defer server.Close()
+
+	client := NewArchiveClient(server.URL, nil)
+
+	docs, err := client.ReadLatestDocuments(context.Background(), 30000, core.PackageFormatFullObjectStates, time.Unix(2, 0))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(docs))
+	assert.Equal(t, `{"time":1000,"deviceId":1}`, string(docs[0]))
+	assert.Equal(t, map[string]interface{}{"field": "deviceId"}, query["collapse"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"time": "desc"}}, query["sort"])
+}
@@ -1,6 +1,7 @@
 package archive
 
 import (
+	"errors"
 	"github.com/imsat-spb/go-apkdk-configuration"
 )
 
@@ -11,6 +12,101 @@ type archiveMeasureOrAttributeInfo struct {
 	stationId            int
 	objectTypeId         int
 	isAttribute          bool
+	// Названия из проекта, заполняются только при включенном обогащении
+	objectName             string
+	measureOrAttributeName string
+	objectTypeName         string
+	stationName            string
+}
+
+// ProjectNamesInformation предоставляет названия станций и типов объектов.
+// Если проект реализует этот интерфейс, названия добавляются при обогащении документов.
+// Проект, загруженный LoadProjectInfo, реализует этот интерфейс
+type ProjectNamesInformation interface {
+	GetStationName(id int) string
+	GetObjectTypeName(id int) string
+}
+
+// ProjectMappingsInformation предоставляет привязки измерений и атрибутов всех вложенных проектов
+// в порядке описания, включая повторы. configuration.ProjectInformation возвращает привязки
+// словарем, в котором повторы уже объединены, поэтому повторные привязки (ReasonDuplicateMapping)
+// определяются только для проектов, реализующих этот интерфейс (LoadProjectInfo)
+type ProjectMappingsInformation interface {
+	GetParameterMappings() []*configuration.ObjectParameterMapping
+	GetAttributeMappings() []*configuration.ObjectAttributeMapping
+}
+
+// ErrProjectNamesUnavailable возвращается NewConfigurationInfo с опцией WithNames,
+// если проект не предоставляет названия станций и типов объектов (ProjectNamesInformation)
+var ErrProjectNamesUnavailable = errors.New("project does not provide station and object type names, load it with LoadProjectInfo")
+
+// ObjectStateInfo описание состояния объекта из словаря состояний типа объекта
+type ObjectStateInfo struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// Класс важности (цвет) состояния
+	Severity int `json:"severity"`
+}
+
+// ProjectStatesInformation предоставляет словарь состояний для типа объекта.
+// Если проект реализует этот интерфейс или словарь задан опцией WithObjectStates,
+// состояния объектов в архиве дополняются названиями.
+// Проект configuration не содержит словаря состояний, его нужно загружать отдельно (LoadObjectStatesDictionary)
+type ProjectStatesInformation interface {
+	GetObjectTypeStates(typeId int) []*ObjectStateInfo
+}
+
+// ObjectStatesDictionary словарь состояний: тип объекта на список состояний
+type ObjectStatesDictionary map[int][]*ObjectStateInfo
+
+// GetObjectTypeStates возвращает состояния типа объекта
+func (dictionary ObjectStatesDictionary) GetObjectTypeStates(typeId int) []*ObjectStateInfo {
+	return dictionary[typeId]
+}
+
+type configurationOptions struct {
+	enrichWithNames  bool
+	strictValidation bool
+	states           ProjectStatesInformation
+	filter           *objectFilter
+	// Не записывать измерения с датчиков, привязанных к конфликтующим измерениям
+	rejectSensorConflicts bool
+}
+
+// ConfigurationOption задает дополнительные параметры построения ConfigurationInfo
+type ConfigurationOption func(options *configurationOptions)
+
+// WithNames включает добавление в документы архива названий объекта, измерения или атрибута,
+// типа объекта и станции. Проект должен реализовывать ProjectNamesInformation,
+// иначе NewConfigurationInfo возвращает ErrProjectNamesUnavailable
+func WithNames() ConfigurationOption {
+	return func(options *configurationOptions) {
+		options.enrichWithNames = true
+	}
+}
+
+// WithObjectStates задает словарь состояний объектов, если проект его не предоставляет
+func WithObjectStates(states ProjectStatesInformation) ConfigurationOption {
+	return func(options *configurationOptions) {
+		options.states = states
+	}
+}
+
+// WithStrictValidation включает строгую проверку привязок.
+// Если хотя бы одна привязка пропущена, NewConfigurationInfo возвращает ValidationError
+func WithStrictValidation() ConfigurationOption {
+	return func(options *configurationOptions) {
+		options.strictValidation = true
+	}
+}
+
+// WithoutSensorConflicts исключает из конфигурации датчики, к которым привязаны измерения
+// с разными единицами измерения или одновременно измерения и атрибуты.
+// Исключенные привязки добавляются в отчет о проверке
+func WithoutSensorConflicts() ConfigurationOption {
+	return func(options *configurationOptions) {
+		options.rejectSensorConflicts = true
+	}
 }
 
 type ParameterOrAttributeMappingKey struct {
@@ -29,12 +125,30 @@ type ConfigurationInfo struct {
 	mappings map[int]map[int][]*archiveMeasureOrAttributeInfo
 	// Информация по объекту контроля
 	Objects map[int]*ObjectInfo
+	// Тип объекта на словарь состояний
+	objectStates map[int]map[int]*ObjectStateInfo
+	// Привязки, пропущенные при построении
+	validationReport *ValidationReport
+	// Конфигурация содержит только часть объектов проекта
+	isSubset bool
+}
+
+// HasObjectStates возвращает true, если конфигурация содержит словарь состояний объектов.
+// Без словаря в документах архива не заполняются названия и важность состояний
+func (archiveConfig *ConfigurationInfo) HasObjectStates() bool {
+	return len(archiveConfig.objectStates) > 0
+}
+
+// GetValidationReport возвращает список привязок, пропущенных при построении
+func (archiveConfig *ConfigurationInfo) GetValidationReport() *ValidationReport {
+	return archiveConfig.validationReport
 }
 
 type ObjectInfo struct {
 	objectId  int
 	stationId int
 	hostId    int
+	typeId    int
 }
 
 type deviceMappingItem struct {
@@ -42,38 +156,94 @@ type deviceMappingItem struct {
 	sensorId int
 }
 
-func NewConfigurationInfo(project configuration.ProjectInformation) (*ConfigurationInfo, error) {
+func NewConfigurationInfo(project configuration.ProjectInformation, opts ...ConfigurationOption) (*ConfigurationInfo, error) {
+
+	options := &configurationOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	var namesInfo ProjectNamesInformation
+	if options.enrichWithNames {
+		var ok bool
+		if namesInfo, ok = project.(ProjectNamesInformation); !ok {
+			return nil, ErrProjectNamesUnavailable
+		}
+	}
 
 	var archiveConfig = &ConfigurationInfo{
-		mappings: make(map[int]map[int][]*archiveMeasureOrAttributeInfo),
-		Objects:  make(map[int]*ObjectInfo),
+		mappings:         make(map[int]map[int][]*archiveMeasureOrAttributeInfo),
+		Objects:          make(map[int]*ObjectInfo),
+		objectStates:     make(map[int]map[int]*ObjectStateInfo),
+		validationReport: &ValidationReport{},
 	}
+	report := archiveConfig.validationReport
+
+	statesInfo := options.states
+	if statesInfo == nil {
+		statesInfo, _ = project.(ProjectStatesInformation)
+	}
+	hasStates := statesInfo != nil
+
+	archiveConfig.isSubset = !options.filter.isEmpty()
 
 	for objectId, objectInfo := range project.GetObjects() {
+		hostId := project.GetObjectHost(objectId)
+
+		if !options.filter.match(objectId, objectInfo.StationId, objectInfo.TypeId, hostId) {
+			continue
+		}
+
 		archiveConfig.Objects[objectId] = &ObjectInfo{
 			objectId:  objectId,
 			stationId: objectInfo.StationId,
-			hostId:    project.GetObjectHost(objectId),
+			hostId:    hostId,
+			typeId:    objectInfo.TypeId,
 		}
-	}
-	measuresToDevices := make(map[ParameterOrAttributeMappingKey]deviceMappingItem)
 
-	// Добавляем маппинг измерений
-	measureMappingsMap := project.GetObjectParametersMappingsMap()
-	attributesMappingsMap := project.GetObjectAttributeMappingsMap()
+		if !hasStates {
+			continue
+		}
+
+		// Словарь состояний загружаем один раз для каждого типа объекта
+		if _, ok := archiveConfig.objectStates[objectInfo.TypeId]; ok {
+			continue
+		}
 
+		typeStates := make(map[int]*ObjectStateInfo)
+		for _, state := range statesInfo.GetObjectTypeStates(objectInfo.TypeId) {
+			typeStates[state.Id] = state
+		}
+		archiveConfig.objectStates[objectInfo.TypeId] = typeStates
+	}
 	resultMap := make(map[ParameterOrAttributeMappingKey]deviceMappingItem)
 
-	for _, mv := range measureMappingsMap {
-		resultMap[NewParameterOrAttributeMappingKey(mv.ObjectId, mv.Id, false)] = deviceMappingItem{
-			mv.DeviceId,
-			mv.SensorId}
+	addMapping := func(mapKey ParameterOrAttributeMappingKey, mapping deviceMappingItem) {
+		if _, ok := resultMap[mapKey]; ok {
+			// Измерение уже было описано, игнорируем повторное описание
+			report.add(ReasonDuplicateMapping, mapKey, mapping)
+			return
+		}
+		resultMap[mapKey] = mapping
 	}
 
-	for _, av := range attributesMappingsMap {
-		resultMap[NewParameterOrAttributeMappingKey(av.ObjectId, av.Id, true)] = deviceMappingItem{
-			av.DeviceId,
-			av.SensorId}
+	// Добавляем маппинг измерений
+	if mappingsInfo, ok := project.(ProjectMappingsInformation); ok {
+		for _, mv := range mappingsInfo.GetParameterMappings() {
+			addMapping(NewParameterOrAttributeMappingKey(mv.ObjectId, mv.Id, false), deviceMappingItem{mv.DeviceId, mv.SensorId})
+		}
+
+		for _, av := range mappingsInfo.GetAttributeMappings() {
+			addMapping(NewParameterOrAttributeMappingKey(av.ObjectId, av.Id, true), deviceMappingItem{av.DeviceId, av.SensorId})
+		}
+	} else {
+		for _, mv := range project.GetObjectParametersMappingsMap() {
+			addMapping(NewParameterOrAttributeMappingKey(mv.ObjectId, mv.Id, false), deviceMappingItem{mv.DeviceId, mv.SensorId})
+		}
+
+		for _, av := range project.GetObjectAttributeMappingsMap() {
+			addMapping(NewParameterOrAttributeMappingKey(av.ObjectId, av.Id, true), deviceMappingItem{av.DeviceId, av.SensorId})
+		}
 	}
 
 	// Вставка информации об устройствах
@@ -84,41 +254,49 @@ func NewConfigurationInfo(project configuration.ProjectInformation) (*Configurat
 		// Игнорируем не объявленные объекты или измерения
 		oInfo := project.GetObjectInfo(objectId)
 		if oInfo == nil {
+			report.add(ReasonUndeclaredObject, mapKey, mapping)
+			continue
+		}
+
+		// Объект не входит в отобранные объекты
+		if _, ok := archiveConfig.Objects[objectId]; !ok {
 			continue
 		}
 
 		var unitOfMeasure string
+		var measureName string
 
 		if mapKey.isAttribute {
 			attributeInfo := project.GetAttributeInfo(measureId)
 
 			if attributeInfo == nil {
+				report.add(ReasonUnknownAttribute, mapKey, mapping)
 				continue
 			}
 
 			unitOfMeasure = attributeInfo.GetUnitOfMeasure()
+			measureName = attributeInfo.GetName()
 		} else {
 			paramInfo := project.GetObjectParameterInfo(measureId)
 
 			if paramInfo == nil {
+				report.add(ReasonUnknownParameter, mapKey, mapping)
 				continue
 			}
 
 			unitOfMeasure = paramInfo.GetUnitOfMeasureDisplayName()
+			measureName = paramInfo.GetParameterDisplayName()
 		}
 
 		deviceInfo := project.GetDeviceInfo(mapping.deviceId)
 		if deviceInfo == nil {
 			// Не нашли устройство
+			report.add(ReasonUnknownDevice, mapKey, mapping)
 			continue
 		}
 		if mapping.sensorId >= deviceInfo.SensorCount {
 			// Неправильный маппинг датчика
-			continue
-		}
-
-		if _, ok := measuresToDevices[mapKey]; ok {
-			// Измерение уже было добавлено, игнорируем повторное описание
+			report.add(ReasonSensorOutOfRange, mapKey, mapping)
 			continue
 		}
 
@@ -130,6 +308,13 @@ func NewConfigurationInfo(project configuration.ProjectInformation) (*Configurat
 			measureOrAttributeId: measureId,
 			unitOfMeasure:        unitOfMeasure}
 
+		if options.enrichWithNames {
+			mInfo.objectName = oInfo.Name
+			mInfo.measureOrAttributeName = measureName
+			mInfo.objectTypeName = namesInfo.GetObjectTypeName(oInfo.TypeId)
+			mInfo.stationName = namesInfo.GetStationName(oInfo.StationId)
+		}
+
 		devInfo := archiveConfig.mappings[mapping.deviceId]
 		if devInfo == nil {
 			devInfo = make(map[int][]*archiveMeasureOrAttributeInfo)
@@ -143,8 +328,16 @@ func NewConfigurationInfo(project configuration.ProjectInformation) (*Configurat
 		} else {
 			devInfo[mapping.sensorId] = append(sensorInfo, mInfo)
 		}
+	}
+
+	if options.rejectSensorConflicts {
+		archiveConfig.rejectSensorConflicts(report)
+	}
+
+	report.sort()
 
-		measuresToDevices[mapKey] = deviceMappingItem{deviceId: mapping.deviceId, sensorId: mapping.sensorId}
+	if options.strictValidation && report.HasFindings() {
+		return nil, &ValidationError{Report: report}
 	}
 
 	return archiveConfig, nil
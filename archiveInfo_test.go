@@ -95,3 +95,119 @@ func TestNewArchiveSingleMeasureInfo(t *testing.T) {
 	assert.Len(t, am, 1)
 	assert.Equal(t, *am[0], expectedAttribute)
 }
+
+type testProjectWithNames struct {
+	configuration.TestProjectData
+	stations    map[int]string
+	objectTypes map[int]string
+}
+
+func (td *testProjectWithNames) GetStationName(id int) string {
+	return td.stations[id]
+}
+
+func (td *testProjectWithNames) GetObjectTypeName(id int) string {
+	return td.objectTypes[id]
+}
+
+func TestNewArchiveInfoWithNames(t *testing.T) {
+
+	const typeId = 1
+	const typeName = "Type1"
+	const objectName = "test1"
+	const objectId = 1
+	const measureId = 100
+	const attributeId = 100
+	const measureShortName = "P"
+	const measureName = "Parameter"
+	const attributeName = "Attribute"
+	const stationId = 1000
+	const stationName = "TestStation"
+
+	const deviceId = 3
+	const sensorId = 0
+	const sensorAttrId = 1
+
+	testProject := &testProjectWithNames{
+		TestProjectData: configuration.TestProjectData{
+			Devices: map[int]*configuration.Device{
+				deviceId: {Id: deviceId, SensorCount: 100, BitsPerSensor: 32},
+			},
+			Objects: map[int]*configuration.ObjectInfo{
+				objectId: {Id: objectId, TypeId: typeId, Name: objectName, StationId: stationId}},
+			Parameters: map[int]*configuration.ObjectParameter{
+				measureId: {Id: measureId, Name: measureName, ShortName: measureShortName, UnitOfMeasure: "Секунды,с"}},
+			Attributes: map[int]*configuration.ObjectAttribute{
+				attributeId: {Id: attributeId, Name: attributeName, UnitOfMeasure: "В"}},
+			ParameterMappings: map[configuration.ParameterMappingKey]*configuration.ObjectParameterMapping{
+				configuration.NewParameterMappingKey(objectId, measureId): {Id: measureId, ObjectId: objectId, DeviceId: deviceId, SensorId: sensorId}},
+			AttributeMappings: map[configuration.ParameterMappingKey]*configuration.ObjectAttributeMapping{
+				configuration.NewParameterMappingKey(objectId, attributeId): {Id: attributeId, ObjectId: objectId, DeviceId: deviceId, SensorId: sensorAttrId}},
+		},
+		stations:    map[int]string{stationId: stationName},
+		objectTypes: map[int]string{typeId: typeName},
+	}
+
+	info, err := NewConfigurationInfo(testProject, WithNames())
+
+	assert.Nil(t, err)
+
+	m := info.mappings[deviceId][sensorId][0]
+	assert.Equal(t, objectName, m.objectName)
+	assert.Equal(t, measureShortName, m.measureOrAttributeName)
+	assert.Equal(t, typeName, m.objectTypeName)
+	assert.Equal(t, stationName, m.stationName)
+
+	a := info.mappings[deviceId][sensorAttrId][0]
+	assert.Equal(t, objectName, a.objectName)
+	assert.Equal(t, attributeName, a.measureOrAttributeName)
+	assert.Equal(t, typeName, a.objectTypeName)
+	assert.Equal(t, stationName, a.stationName)
+
+	// Без опции названия не заполняются
+	info, err = NewConfigurationInfo(testProject)
+
+	assert.Nil(t, err)
+
+	m = info.mappings[deviceId][sensorId][0]
+	assert.Empty(t, m.objectName)
+	assert.Empty(t, m.measureOrAttributeName)
+	assert.Empty(t, m.objectTypeName)
+	assert.Empty(t, m.stationName)
+}
+
+type testProjectWithStates struct {
+	configuration.TestProjectData
+	states map[int][]*ObjectStateInfo
+}
+
+func (td *testProjectWithStates) GetObjectTypeStates(typeId int) []*ObjectStateInfo {
+	return td.states[typeId]
+}
+
+func TestNewArchiveInfoWithObjectStates(t *testing.T) {
+	const typeId1 = 1
+	const typeId2 = 2
+
+	normal := &ObjectStateInfo{Id: 1, Name: "Норма", Severity: 1}
+	failure := &ObjectStateInfo{Id: 2, Name: "Отказ", Severity: 3}
+
+	testProject := &testProjectWithStates{
+		TestProjectData: configuration.TestProjectData{
+			Objects: map[int]*configuration.ObjectInfo{
+				1: {Id: 1, TypeId: typeId1, StationId: 1000},
+				2: {Id: 2, TypeId: typeId1, StationId: 1000},
+				3: {Id: 3, TypeId: typeId2, StationId: 1000}},
+		},
+		states: map[int][]*ObjectStateInfo{typeId1: {normal, failure}},
+	}
+
+	info, err := NewConfigurationInfo(testProject)
+
+	assert.Nil(t, err)
+	assert.Equal(t, typeId1, info.Objects[1].typeId)
+	assert.Equal(t, map[int]map[int]*ObjectStateInfo{
+		typeId1: {1: normal, 2: failure},
+		typeId2: {},
+	}, info.objectStates)
+}
@@ -0,0 +1,202 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package archivegrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ArchiveServiceClient is the client API for ArchiveService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ArchiveServiceClient interface {
+	// Принимает пакеты данных от сборщиков и обрабатывает их в RuntimeConfiguration
+	Ingest(ctx context.Context, opts ...grpc.CallOption) (ArchiveService_IngestClient, error)
+	// Передает сформированные документы архива и изменения значений
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (ArchiveService_SubscribeClient, error)
+}
+
+type archiveServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewArchiveServiceClient(cc grpc.ClientConnInterface) ArchiveServiceClient {
+	return &archiveServiceClient{cc}
+}
+
+func (c *archiveServiceClient) Ingest(ctx context.Context, opts ...grpc.CallOption) (ArchiveService_IngestClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ArchiveService_ServiceDesc.Streams[0], "/apkdk.archive.ArchiveService/Ingest", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &archiveServiceIngestClient{stream}
+	return x, nil
+}
+
+type ArchiveService_IngestClient interface {
+	Send(*IngestRequest) error
+	CloseAndRecv() (*IngestResponse, error)
+	grpc.ClientStream
+}
+
+type archiveServiceIngestClient struct {
+	grpc.ClientStream
+}
+
+func (x *archiveServiceIngestClient) Send(m *IngestRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *archiveServiceIngestClient) CloseAndRecv() (*IngestResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *archiveServiceClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (ArchiveService_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ArchiveService_ServiceDesc.Streams[1], "/apkdk.archive.ArchiveService/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &archiveServiceSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ArchiveService_SubscribeClient interface {
+	Recv() (*SubscribeResponse, error)
+	grpc.ClientStream
+}
+
+type archiveServiceSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *archiveServiceSubscribeClient) Recv() (*SubscribeResponse, error) {
+	m := new(SubscribeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ArchiveServiceServer is the server API for ArchiveService service.
+// All implementations must embed UnimplementedArchiveServiceServer
+// for forward compatibility
+type ArchiveServiceServer interface {
+	// Принимает пакеты данных от сборщиков и обрабатывает их в RuntimeConfiguration
+	Ingest(ArchiveService_IngestServer) error
+	// Передает сформированные документы архива и изменения значений
+	Subscribe(*SubscribeRequest, ArchiveService_SubscribeServer) error
+	mustEmbedUnimplementedArchiveServiceServer()
+}
+
+// UnimplementedArchiveServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedArchiveServiceServer struct {
+}
+
+func (UnimplementedArchiveServiceServer) Ingest(ArchiveService_IngestServer) error {
+	return status.Errorf(codes.Unimplemented, "method Ingest not implemented")
+}
+func (UnimplementedArchiveServiceServer) Subscribe(*SubscribeRequest, ArchiveService_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedArchiveServiceServer) mustEmbedUnimplementedArchiveServiceServer() {}
+
+// UnsafeArchiveServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ArchiveServiceServer will
+// result in compilation errors.
+type UnsafeArchiveServiceServer interface {
+	mustEmbedUnimplementedArchiveServiceServer()
+}
+
+func RegisterArchiveServiceServer(s grpc.ServiceRegistrar, srv ArchiveServiceServer) {
+	s.RegisterService(&ArchiveService_ServiceDesc, srv)
+}
+
+func _ArchiveService_Ingest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ArchiveServiceServer).Ingest(&archiveServiceIngestServer{stream})
+}
+
+type ArchiveService_IngestServer interface {
+	SendAndClose(*IngestResponse) error
+	Recv() (*IngestRequest, error)
+	grpc.ServerStream
+}
+
+type archiveServiceIngestServer struct {
+	grpc.ServerStream
+}
+
+func (x *archiveServiceIngestServer) SendAndClose(m *IngestResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *archiveServiceIngestServer) Recv() (*IngestRequest, error) {
+	m := new(IngestRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _ArchiveService_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ArchiveServiceServer).Subscribe(m, &archiveServiceSubscribeServer{stream})
+}
+
+type ArchiveService_SubscribeServer interface {
+	Send(*SubscribeResponse) error
+	grpc.ServerStream
+}
+
+type archiveServiceSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *archiveServiceSubscribeServer) Send(m *SubscribeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// ArchiveService_ServiceDesc is the grpc.ServiceDesc for ArchiveService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ArchiveService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "apkdk.archive.ArchiveService",
+	HandlerType: (*ArchiveServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Ingest",
+			Handler:       _ArchiveService_Ingest_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _ArchiveService_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "archiveService.proto",
+}
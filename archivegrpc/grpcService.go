@@ -0,0 +1,370 @@
+// Package archivegrpc сервис gRPC приема пакетов данных и подписки на документы архива
+package archivegrpc
+
+// Код сгенерирован protoc 3.21.12, protoc-gen-go v1.27.1 и protoc-gen-go-grpc v1.1.0
+//go:generate go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.27.1
+//go:generate go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.1.0
+//go:generate sh -c "protoc --version | grep -qx 'libprotoc 3.21.12' || { echo 'protoc 3.21.12 is required' >&2; exit 1; }"
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative archiveService.proto
+
+import (
+	"bytes"
+	"context"
+	"github.com/imsat-spb/go-apkdk-archive"
+	"github.com/imsat-spb/go-apkdk-core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"sync"
+)
+
+const defaultArchiveServerBufferSize = 1024
+
+type archiveServerOptions struct {
+	runtimeOptions []archive.RuntimeOption
+	sink           archive.ReplaySink
+	bufferSize     int
+}
+
+// ArchiveServerOption задает параметры ArchiveServer
+type ArchiveServerOption func(options *archiveServerOptions)
+
+// WithArchiveServerRuntimeOptions задает параметры RuntimeConfiguration сервера
+func WithArchiveServerRuntimeOptions(opts ...archive.RuntimeOption) ArchiveServerOption {
+	return func(options *archiveServerOptions) {
+		options.runtimeOptions = append(options.runtimeOptions, opts...)
+	}
+}
+
+// WithArchiveServerSink задает получателя документов, например ArchiveClient.
+// Ошибка записи завершает поток приема пакетов
+func WithArchiveServerSink(sink archive.ReplaySink) ArchiveServerOption {
+	return func(options *archiveServerOptions) {
+		options.sink = sink
+	}
+}
+
+// WithArchiveServerBufferSize задает количество сообщений в буфере каждого подписчика. По умолчанию 1024
+func WithArchiveServerBufferSize(size int) ArchiveServerOption {
+	return func(options *archiveServerOptions) {
+		options.bufferSize = size
+	}
+}
+
+type archiveSubscriber struct {
+	filter    *archive.LiveFeedFilter
+	documents bool
+	values    bool
+	messages  chan *SubscribeResponse
+	dropped   uint64
+}
+
+// ArchiveServer реализация ArchiveService. Пакеты всех потоков Ingest обрабатываются одной
+// RuntimeConfiguration по очереди. Подписчики получают сообщения через буфер, при переполнении
+// отбрасываются самые старые сообщения, а их количество передается в поле dropped
+type ArchiveServer struct {
+	UnimplementedArchiveServiceServer
+	runtimeConfig *archive.RuntimeConfiguration
+	sink          archive.ReplaySink
+	bufferSize    int
+	ingestLock    sync.Mutex
+	lock          sync.Mutex
+	subscribers   map[*archiveSubscriber]bool
+}
+
+// NewArchiveServer создает сервер с RuntimeConfiguration для конфигурации info
+func NewArchiveServer(info *archive.ConfigurationInfo, opts ...ArchiveServerOption) *ArchiveServer {
+	options := archiveServerOptions{bufferSize: defaultArchiveServerBufferSize}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	result := &ArchiveServer{
+		sink:        options.sink,
+		bufferSize:  options.bufferSize,
+		subscribers: make(map[*archiveSubscriber]bool)}
+
+	runtimeOptions := append(options.runtimeOptions[:len(options.runtimeOptions):len(options.runtimeOptions)],
+		archive.WithDocumentListener(result.publishDocuments), archive.WithMeasureListener(result.publishValues))
+
+	result.runtimeConfig = archive.NewRuntimeConfiguration(info, runtimeOptions...)
+
+	return result
+}
+
+// GetRuntimeConfiguration возвращает RuntimeConfiguration сервера
+func (server *ArchiveServer) GetRuntimeConfiguration() *archive.RuntimeConfiguration {
+	return server.runtimeConfig
+}
+
+func (server *ArchiveServer) processPackage(ctx context.Context, data []byte) (int, error) {
+	dataPackage := &core.DataPackage{}
+	if err := dataPackage.Read(bytes.NewReader(data)); err != nil {
+		return 0, err
+	}
+
+	server.ingestLock.Lock()
+	defer server.ingestLock.Unlock()
+
+	items, err := server.runtimeConfig.GetUpdateRequestItemsFromPackage(dataPackage)
+	if err != nil {
+		return 0, err
+	}
+
+	if server.sink != nil && len(items) != 0 {
+		if err = server.sink.WriteRequestItems(ctx, items); err != nil {
+			return 0, status.Errorf(codes.Unavailable, "write documents: %v", err)
+		}
+	}
+
+	return len(items), nil
+}
+
+// Ingest принимает пакеты данных. Пакеты, которые не удалось разобрать, пропускаются и учитываются в failed
+func (server *ArchiveServer) Ingest(stream ArchiveService_IngestServer) error {
+	response := &IngestResponse{}
+
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+
+		response.Received++
+
+		count, err := server.processPackage(stream.Context(), request.Package)
+		if err != nil {
+			// Ошибка записи получателю возвращается как статус gRPC и завершает поток
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			response.Failed++
+			continue
+		}
+
+		response.Documents += uint64(count)
+	}
+}
+
+func (server *ArchiveServer) enqueue(subscriber *archiveSubscriber, message *SubscribeResponse) {
+	select {
+	case subscriber.messages <- message:
+		return
+	default:
+	}
+
+	subscriber.dropped++
+
+	select {
+	case <-subscriber.messages:
+	default:
+	}
+	select {
+	case subscriber.messages <- message:
+	default:
+	}
+}
+
+func (server *ArchiveServer) publishDocuments(items []*archive.RequestItem) {
+	var documents []*archive.LiveFeedDocument
+
+	for _, item := range items {
+		document, err := archive.GetLiveFeedDocument(item)
+		if err != nil || document == nil {
+			continue
+		}
+		documents = append(documents, document)
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for subscriber := range server.subscribers {
+		if !subscriber.documents {
+			continue
+		}
+
+		for _, document := range documents {
+			data := subscriber.filter.Apply(document)
+			if data == nil {
+				continue
+			}
+
+			server.enqueue(subscriber, &SubscribeResponse{Payload: &SubscribeResponse_Document{Document: &ArchiveDocument{
+				Index: document.Index(),
+				Id:    document.Id(),
+				Kind:  document.Kind(),
+				Json:  data}}})
+		}
+	}
+}
+
+func getValueUpdate(record *archive.MeasureRecord) *ValueUpdate {
+	result := &ValueUpdate{
+		Time:         timestamppb.New(record.Time),
+		DeviceId:     record.DeviceId,
+		SensorId:     uint32(record.SensorId),
+		ObjectId:     int32(record.ObjectId),
+		ObjectTypeId: int32(record.ObjectTypeId),
+		MeasureId:    int32(record.MeasureId),
+		IsAttribute:  record.IsAttribute,
+		StationId:    int32(record.StationId),
+		Unit:         record.Unit}
+
+	if core.IsNaN(record.Value) {
+		result.Undefined = true
+	} else {
+		result.Value = record.Value
+	}
+
+	return result
+}
+
+func (server *ArchiveServer) publishValues(update *archive.MeasureUpdate) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for subscriber := range server.subscribers {
+		if !subscriber.values {
+			continue
+		}
+
+		for _, record := range update.Records {
+			if !subscriber.filter.IsRecordAllowed(record) {
+				continue
+			}
+
+			server.enqueue(subscriber, &SubscribeResponse{Payload: &SubscribeResponse_Value{Value: getValueUpdate(record)}})
+		}
+	}
+}
+
+func (server *ArchiveServer) subscribe(request *SubscribeRequest) *archiveSubscriber {
+	stations := make([]int, len(request.Stations))
+	for i, stationId := range request.Stations {
+		stations[i] = int(stationId)
+	}
+	objects := make([]int, len(request.Objects))
+	for i, objectId := range request.Objects {
+		objects[i] = int(objectId)
+	}
+
+	subscriber := &archiveSubscriber{
+		filter:    archive.NewLiveFeedFilter(stations, objects),
+		documents: request.Documents,
+		values:    request.Values,
+		messages:  make(chan *SubscribeResponse, server.bufferSize)}
+
+	server.lock.Lock()
+	server.subscribers[subscriber] = true
+	server.lock.Unlock()
+
+	return subscriber
+}
+
+func (server *ArchiveServer) unsubscribe(subscriber *archiveSubscriber) {
+	server.lock.Lock()
+	delete(server.subscribers, subscriber)
+	server.lock.Unlock()
+}
+
+func (server *ArchiveServer) getSubscriberCount() int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	return len(server.subscribers)
+}
+
+func (server *ArchiveServer) takeDropped(subscriber *archiveSubscriber) uint64 {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	result := subscriber.dropped
+	subscriber.dropped = 0
+	return result
+}
+
+// Subscribe передает подписчику документы и изменения значений, пока он не отключится
+func (server *ArchiveServer) Subscribe(request *SubscribeRequest, stream ArchiveService_SubscribeServer) error {
+	if !request.Documents && !request.Values {
+		return status.Error(codes.InvalidArgument, "documents or values should be requested")
+	}
+
+	subscriber := server.subscribe(request)
+	defer server.unsubscribe(subscriber)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case message := <-subscriber.messages:
+			message.Dropped = server.takeDropped(subscriber)
+			if err := stream.Send(message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ArchiveGrpcClient клиент ArchiveService
+type ArchiveGrpcClient struct {
+	client ArchiveServiceClient
+}
+
+// NewArchiveGrpcClient создает клиента для соединения conn
+func NewArchiveGrpcClient(conn grpc.ClientConnInterface) *ArchiveGrpcClient {
+	return &ArchiveGrpcClient{client: NewArchiveServiceClient(conn)}
+}
+
+// SendPackages передает пакеты данных серверу одним потоком
+func (client *ArchiveGrpcClient) SendPackages(ctx context.Context, packages []*core.DataPackage) (*IngestResponse, error) {
+	stream, err := client.client.Ingest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dataPackage := range packages {
+		if err = stream.Send(&IngestRequest{Package: dataPackage.Bytes()}); err != nil {
+			// Причина ошибки возвращается из CloseAndRecv
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+	}
+
+	return stream.CloseAndRecv()
+}
+
+// Subscribe получает сообщения подписки, пока не будет отменен ctx или handler не вернет ошибку
+func (client *ArchiveGrpcClient) Subscribe(ctx context.Context, request *SubscribeRequest,
+	handler func(response *SubscribeResponse) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.client.Subscribe(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	for {
+		response, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if err = handler(response); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package archivegrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/imsat-spb/go-apkdk-archive"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startArchiveTestServer(t *testing.T, opts ...ArchiveServerOption) (*ArchiveServer, *ArchiveGrpcClient, func()) {
+	server := NewArchiveServer(getTestConfigurationInfo(t), opts...)
+
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	RegisterArchiveServiceServer(grpcServer, server)
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.Dial()
+		}), grpc.WithInsecure())
+	assert.Nil(t, err)
+
+	return server, NewArchiveGrpcClient(conn), func() {
+		_ = conn.Close()
+		grpcServer.Stop()
+	}
+}
+
+func waitArchiveTestSubscribers(t *testing.T, server *ArchiveServer, count int) {
+	for i := 0; i < 200 && server.getSubscriberCount() != count; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, count, server.getSubscriberCount())
+}
+
+func TestArchiveServer(t *testing.T) {
+	sink := &testReplaySink{}
+	server, client, stop := startArchiveTestServer(t, WithArchiveServerSink(sink))
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	responses := make(chan *SubscribeResponse, 10)
+	subscribed := make(chan error, 1)
+	go func() {
+		subscribed <- client.Subscribe(ctx, &SubscribeRequest{Stations: []int32{33000}, Documents: true, Values: true},
+			func(response *SubscribeResponse) error {
+				responses <- response
+				return nil
+			})
+	}()
+	waitArchiveTestSubscribers(t, server, 1)
+
+	packageTime := time.Unix(1000, 123456000)
+	response, err := client.SendPackages(context.Background(), []*core.DataPackage{
+		getTestDataPackage(packageTime, []byte{0, 0, 0, 0x80}),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), response.Received)
+	assert.Equal(t, uint64(0), response.Failed)
+	assert.Equal(t, uint64(1), response.Documents)
+	assert.Len(t, sink.items, 1)
+
+	// Пакет, который не удалось разобрать, пропускается
+	stream, err := client.client.Ingest(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&IngestRequest{Package: []byte{1, 2, 3}}))
+	response, err = stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), response.Received)
+	assert.Equal(t, uint64(1), response.Failed)
+	assert.Len(t, sink.items, 1)
+
+	var received []*SubscribeResponse
+	for len(received) < 2 {
+		select {
+		case r := <-responses:
+			received = append(received, r)
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "no subscription messages")
+		}
+	}
+
+	// Изменения значений передаются до документов пакета
+	value := received[0].GetValue()
+	assert.NotNil(t, value)
+	assert.True(t, packageTime.Equal(value.Time.AsTime()))
+	assert.Equal(t, int32(200), value.ObjectId)
+	assert.Equal(t, int32(8), value.MeasureId)
+	assert.True(t, value.IsAttribute)
+	assert.True(t, value.Undefined)
+	assert.Equal(t, uint32(1), value.SensorId)
+	assert.Equal(t, int32(33000), value.StationId)
+
+	document := received[1].GetDocument()
+	assert.NotNil(t, document)
+	assert.Equal(t, "events", document.Index)
+	assert.Equal(t, "5_0_1000123", document.Id)
+	assert.Equal(t, archive.LiveFeedKindMeasures, document.Kind)
+
+	var builder strings.Builder
+	sink.items[0].AddToBuilder(&builder)
+	assert.True(t, strings.HasSuffix(builder.String(), "\n"+string(document.Json)+"\n"))
+
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(<-subscribed))
+	waitArchiveTestSubscribers(t, server, 0)
+}
+
+func TestArchiveServerErrors(t *testing.T) {
+	server, client, stop := startArchiveTestServer(t, WithArchiveServerSink(&testReplaySink{failure: errors.New("unavailable")}))
+	defer stop()
+
+	_, err := client.SendPackages(context.Background(), []*core.DataPackage{getTestDataPackage(time.Unix(1000, 0), []byte{232, 3, 0, 0})})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	err = client.Subscribe(context.Background(), &SubscribeRequest{}, func(response *SubscribeResponse) error {
+		return nil
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 0, server.getSubscriberCount())
+}
+
+func TestArchiveServerDropped(t *testing.T) {
+	server := NewArchiveServer(&archive.ConfigurationInfo{}, WithArchiveServerBufferSize(1))
+	subscriber := server.subscribe(&SubscribeRequest{Values: true})
+
+	update := &archive.MeasureUpdate{Records: []*archive.MeasureRecord{
+		{ObjectId: 1, MeasureId: 1, Value: 1},
+		{ObjectId: 1, MeasureId: 2, Value: 2},
+		{ObjectId: 1, MeasureId: 3, Value: core.GetNaN()},
+	}}
+	server.publishValues(update)
+
+	message := <-subscriber.messages
+	assert.Equal(t, int32(3), message.GetValue().MeasureId)
+	assert.True(t, message.GetValue().Undefined)
+	assert.Equal(t, uint64(2), server.takeDropped(subscriber))
+
+	// Подписчик только на документы не получает значения
+	documents := server.subscribe(&SubscribeRequest{Documents: true})
+	server.publishValues(update)
+	assert.Len(t, documents.messages, 0)
+}
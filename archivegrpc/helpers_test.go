@@ -0,0 +1,49 @@
+package archivegrpc
+
+import (
+	"context"
+	"github.com/imsat-spb/go-apkdk-archive"
+	"github.com/imsat-spb/go-apkdk-core"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getTestDataPackage пакет измерений устройства 5, value содержит значение датчика 1
+func getTestDataPackage(now time.Time, value []byte) *core.DataPackage {
+	return &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(now),
+		DeviceId:      5,
+		Format:        core.PackageFormatData,
+		Data:          append([]byte{0, 0, 0, 0}, value...),
+		BitsPerSensor: 32,
+		DataSize:      8,
+		SensorCount:   2}
+}
+
+// getTestConfigurationInfo датчик 1 устройства 5 привязан к измерению 7 объекта 100 (станция 30000)
+// и атрибуту 8 объекта 200 (станция 33000)
+func getTestConfigurationInfo(t *testing.T) *archive.ConfigurationInfo {
+	info, err := archive.LoadConfigurationInfo(strings.NewReader(`{"version":1,` +
+		`"objects":[{"id":100,"stationId":30000,"hostId":800},{"id":200,"stationId":33000,"hostId":800}],` +
+		`"devices":[{"id":5,"sensors":[{"id":1,"measures":[{"objectId":100,"measureId":7,"unit":"В"},` +
+		`{"objectId":200,"measureId":8,"isAttribute":true}]}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info
+}
+
+type testReplaySink struct {
+	items   []*archive.RequestItem
+	failure error
+}
+
+func (sink *testReplaySink) WriteRequestItems(ctx context.Context, items []*archive.RequestItem) error {
+	if sink.failure != nil {
+		return sink.failure
+	}
+	sink.items = append(sink.items, items...)
+	return nil
+}
@@ -0,0 +1,189 @@
+package archive
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MeasureMappingInfo привязка измерения или атрибута объекта к датчику устройства
+type MeasureMappingInfo struct {
+	ObjectId      int
+	MeasureId     int
+	IsAttribute   bool
+	DeviceId      int
+	SensorId      int
+	UnitOfMeasure string
+}
+
+func (info *MeasureMappingInfo) String() string {
+	kind := "measure"
+	if info.IsAttribute {
+		kind = "attribute"
+	}
+
+	return fmt.Sprintf("object {%d} %s {%d}", info.ObjectId, kind, info.MeasureId)
+}
+
+// MeasureMappingChange изменение привязки измерения или атрибута
+type MeasureMappingChange struct {
+	Old MeasureMappingInfo
+	New MeasureMappingInfo
+}
+
+// ObjectChange изменение станции или хоста объекта
+type ObjectChange struct {
+	ObjectId     int
+	OldStationId int
+	NewStationId int
+	OldHostId    int
+	NewHostId    int
+}
+
+// ConfigurationDiff изменения в архиве между двумя версиями проекта
+type ConfigurationDiff struct {
+	AddedMeasures    []MeasureMappingInfo
+	RemovedMeasures  []MeasureMappingInfo
+	RemappedMeasures []MeasureMappingChange
+	UnitChanges      []MeasureMappingChange
+	MovedObjects     []ObjectChange
+}
+
+func newMeasureMappingInfo(deviceId int, sensorId int, m *archiveMeasureOrAttributeInfo) *MeasureMappingInfo {
+	return &MeasureMappingInfo{
+		ObjectId:      m.objectId,
+		MeasureId:     m.measureOrAttributeId,
+		IsAttribute:   m.isAttribute,
+		DeviceId:      deviceId,
+		SensorId:      sensorId,
+		UnitOfMeasure: m.unitOfMeasure}
+}
+
+// Индекс привязок по объекту и измерению или атрибуту
+func (archiveConfig *ConfigurationInfo) getMeasureMappings() map[ParameterOrAttributeMappingKey]*MeasureMappingInfo {
+	result := make(map[ParameterOrAttributeMappingKey]*MeasureMappingInfo)
+
+	for deviceId, deviceMapping := range archiveConfig.mappings {
+		for sensorId, sensorMapping := range deviceMapping {
+			for _, m := range sensorMapping {
+				result[NewParameterOrAttributeMappingKey(m.objectId, m.measureOrAttributeId, m.isAttribute)] =
+					newMeasureMappingInfo(deviceId, sensorId, m)
+			}
+		}
+	}
+
+	return result
+}
+
+func lessMeasureMapping(a, b *MeasureMappingInfo) bool {
+	if a.ObjectId != b.ObjectId {
+		return a.ObjectId < b.ObjectId
+	}
+	if a.MeasureId != b.MeasureId {
+		return a.MeasureId < b.MeasureId
+	}
+	return !a.IsAttribute && b.IsAttribute
+}
+
+func sortMeasureMappings(items []MeasureMappingInfo) {
+	sort.Slice(items, func(i, j int) bool {
+		return lessMeasureMapping(&items[i], &items[j])
+	})
+}
+
+func sortMeasureMappingChanges(items []MeasureMappingChange) {
+	sort.Slice(items, func(i, j int) bool {
+		return lessMeasureMapping(&items[i].New, &items[j].New)
+	})
+}
+
+// DiffConfigurationInfo сравнивает две конфигурации архива
+func DiffConfigurationInfo(oldConfig, newConfig *ConfigurationInfo) *ConfigurationDiff {
+	result := &ConfigurationDiff{}
+
+	oldMappings := oldConfig.getMeasureMappings()
+	newMappings := newConfig.getMeasureMappings()
+
+	for key, oldMapping := range oldMappings {
+		newMapping, ok := newMappings[key]
+		if !ok {
+			result.RemovedMeasures = append(result.RemovedMeasures, *oldMapping)
+			continue
+		}
+
+		if oldMapping.DeviceId != newMapping.DeviceId || oldMapping.SensorId != newMapping.SensorId {
+			result.RemappedMeasures = append(result.RemappedMeasures, MeasureMappingChange{*oldMapping, *newMapping})
+		}
+
+		if oldMapping.UnitOfMeasure != newMapping.UnitOfMeasure {
+			result.UnitChanges = append(result.UnitChanges, MeasureMappingChange{*oldMapping, *newMapping})
+		}
+	}
+
+	for key, newMapping := range newMappings {
+		if _, ok := oldMappings[key]; !ok {
+			result.AddedMeasures = append(result.AddedMeasures, *newMapping)
+		}
+	}
+
+	for objectId, oldObject := range oldConfig.Objects {
+		newObject, ok := newConfig.Objects[objectId]
+		if !ok {
+			continue
+		}
+
+		if oldObject.stationId != newObject.stationId || oldObject.hostId != newObject.hostId {
+			result.MovedObjects = append(result.MovedObjects, ObjectChange{
+				ObjectId:     objectId,
+				OldStationId: oldObject.stationId,
+				NewStationId: newObject.stationId,
+				OldHostId:    oldObject.hostId,
+				NewHostId:    newObject.hostId})
+		}
+	}
+
+	sortMeasureMappings(result.AddedMeasures)
+	sortMeasureMappings(result.RemovedMeasures)
+	sortMeasureMappingChanges(result.RemappedMeasures)
+	sortMeasureMappingChanges(result.UnitChanges)
+	sort.Slice(result.MovedObjects, func(i, j int) bool {
+		return result.MovedObjects[i].ObjectId < result.MovedObjects[j].ObjectId
+	})
+
+	return result
+}
+
+func (diff *ConfigurationDiff) IsEmpty() bool {
+	return len(diff.AddedMeasures) == 0 && len(diff.RemovedMeasures) == 0 && len(diff.RemappedMeasures) == 0 &&
+		len(diff.UnitChanges) == 0 && len(diff.MovedObjects) == 0
+}
+
+// String возвращает отчет об изменениях, по одному изменению в строке
+func (diff *ConfigurationDiff) String() string {
+	var builder strings.Builder
+
+	for _, m := range diff.AddedMeasures {
+		builder.WriteString(fmt.Sprintf("added %s on device {%d} sensor {%d}\n", m.String(), m.DeviceId, m.SensorId))
+	}
+
+	for _, m := range diff.RemovedMeasures {
+		builder.WriteString(fmt.Sprintf("removed %s from device {%d} sensor {%d}\n", m.String(), m.DeviceId, m.SensorId))
+	}
+
+	for _, c := range diff.RemappedMeasures {
+		builder.WriteString(fmt.Sprintf("remapped %s from device {%d} sensor {%d} to device {%d} sensor {%d}\n",
+			c.New.String(), c.Old.DeviceId, c.Old.SensorId, c.New.DeviceId, c.New.SensorId))
+	}
+
+	for _, c := range diff.UnitChanges {
+		builder.WriteString(fmt.Sprintf("unit of %s changed from %q to %q\n",
+			c.New.String(), c.Old.UnitOfMeasure, c.New.UnitOfMeasure))
+	}
+
+	for _, o := range diff.MovedObjects {
+		builder.WriteString(fmt.Sprintf("object {%d} moved from station {%d} host {%d} to station {%d} host {%d}\n",
+			o.ObjectId, o.OldStationId, o.OldHostId, o.NewStationId, o.NewHostId))
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,92 @@
+package archive
+
+import (
+	configuration "github.com/imsat-spb/go-apkdk-configuration"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getDiffTestProject() *configuration.TestProjectData {
+	return &configuration.TestProjectData{
+		Devices: map[int]*configuration.Device{
+			3: {Id: 3, SensorCount: 100, BitsPerSensor: 32},
+			4: {Id: 4, SensorCount: 100, BitsPerSensor: 32},
+		},
+		ObjectsToHosts: map[int]int{1: 175, 2: 175},
+		Objects: map[int]*configuration.ObjectInfo{
+			1: {Id: 1, TypeId: 1, StationId: 1000},
+			2: {Id: 2, TypeId: 1, StationId: 1000}},
+		Parameters: map[int]*configuration.ObjectParameter{
+			100: {Id: 100, Name: "U", UnitOfMeasure: "Напряжение,В"},
+			101: {Id: 101, Name: "I", UnitOfMeasure: "Ток,А"}},
+		Attributes: map[int]*configuration.ObjectAttribute{
+			200: {Id: 200, Name: "A", UnitOfMeasure: "В"}},
+		ParameterMappings: map[configuration.ParameterMappingKey]*configuration.ObjectParameterMapping{
+			configuration.NewParameterMappingKey(1, 100): {Id: 100, ObjectId: 1, DeviceId: 3, SensorId: 0},
+			configuration.NewParameterMappingKey(1, 101): {Id: 101, ObjectId: 1, DeviceId: 3, SensorId: 1},
+			configuration.NewParameterMappingKey(2, 100): {Id: 100, ObjectId: 2, DeviceId: 3, SensorId: 2}},
+		AttributeMappings: map[configuration.ParameterMappingKey]*configuration.ObjectAttributeMapping{
+			configuration.NewParameterMappingKey(1, 200): {Id: 200, ObjectId: 1, DeviceId: 3, SensorId: 3}},
+	}
+}
+
+func TestDiffConfigurationInfo(t *testing.T) {
+	oldProject := getDiffTestProject()
+	newProject := getDiffTestProject()
+
+	// Измерение 101 объекта 1 удалено, у объекта 2 добавлено
+	delete(newProject.ParameterMappings, configuration.NewParameterMappingKey(1, 101))
+	newProject.ParameterMappings[configuration.NewParameterMappingKey(2, 101)] =
+		&configuration.ObjectParameterMapping{Id: 101, ObjectId: 2, DeviceId: 4, SensorId: 1}
+	// Атрибут перенесен на другое устройство
+	newProject.AttributeMappings[configuration.NewParameterMappingKey(1, 200)] =
+		&configuration.ObjectAttributeMapping{Id: 200, ObjectId: 1, DeviceId: 4, SensorId: 0}
+	// Изменена единица измерения
+	newProject.Parameters[100] = &configuration.ObjectParameter{Id: 100, Name: "U", UnitOfMeasure: "Напряжение,кВ"}
+	// Объект перенесен на другую станцию и хост
+	newProject.Objects[2] = &configuration.ObjectInfo{Id: 2, TypeId: 1, StationId: 2000}
+	newProject.ObjectsToHosts = map[int]int{1: 175, 2: 176}
+
+	oldInfo, err := NewConfigurationInfo(oldProject)
+	assert.Nil(t, err)
+
+	newInfo, err := NewConfigurationInfo(newProject)
+	assert.Nil(t, err)
+
+	diff := DiffConfigurationInfo(oldInfo, newInfo)
+
+	assert.False(t, diff.IsEmpty())
+	assert.Equal(t, []MeasureMappingInfo{
+		{ObjectId: 2, MeasureId: 101, DeviceId: 4, SensorId: 1, UnitOfMeasure: "А"}}, diff.AddedMeasures)
+	assert.Equal(t, []MeasureMappingInfo{
+		{ObjectId: 1, MeasureId: 101, DeviceId: 3, SensorId: 1, UnitOfMeasure: "А"}}, diff.RemovedMeasures)
+	assert.Equal(t, []MeasureMappingChange{{
+		Old: MeasureMappingInfo{ObjectId: 1, MeasureId: 200, IsAttribute: true, DeviceId: 3, SensorId: 3, UnitOfMeasure: "В"},
+		New: MeasureMappingInfo{ObjectId: 1, MeasureId: 200, IsAttribute: true, DeviceId: 4, SensorId: 0, UnitOfMeasure: "В"}},
+	}, diff.RemappedMeasures)
+	assert.Len(t, diff.UnitChanges, 2)
+	assert.Equal(t, "В", diff.UnitChanges[0].Old.UnitOfMeasure)
+	assert.Equal(t, "кВ", diff.UnitChanges[0].New.UnitOfMeasure)
+	assert.Equal(t, []ObjectChange{
+		{ObjectId: 2, OldStationId: 1000, NewStationId: 2000, OldHostId: 175, NewHostId: 176}}, diff.MovedObjects)
+
+	assert.Equal(t, "added object {2} measure {101} on device {4} sensor {1}\n"+
+		"removed object {1} measure {101} from device {3} sensor {1}\n"+
+		"remapped object {1} attribute {200} from device {3} sensor {3} to device {4} sensor {0}\n"+
+		"unit of object {1} measure {100} changed from \"В\" to \"кВ\"\n"+
+		"unit of object {2} measure {100} changed from \"В\" to \"кВ\"\n"+
+		"object {2} moved from station {1000} host {175} to station {2000} host {176}\n", diff.String())
+}
+
+func TestDiffSameConfigurationInfo(t *testing.T) {
+	oldInfo, err := NewConfigurationInfo(getDiffTestProject())
+	assert.Nil(t, err)
+
+	newInfo, err := NewConfigurationInfo(getDiffTestProject())
+	assert.Nil(t, err)
+
+	diff := DiffConfigurationInfo(oldInfo, newInfo)
+
+	assert.True(t, diff.IsEmpty())
+	assert.Empty(t, diff.String())
+}
@@ -0,0 +1,261 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Версия формата файла конфигурации архива
+const configurationFileVersion = 1
+
+type configurationFile struct {
+	Version      int                    `json:"version"`
+	IsSubset     bool                   `json:"isSubset,omitempty"`
+	Objects      []objectFileInfo       `json:"objects"`
+	Devices      []deviceFileInfo       `json:"devices"`
+	ObjectStates []objectTypeFileStates `json:"objectStates,omitempty"`
+}
+
+type objectFileInfo struct {
+	Id          int    `json:"id"`
+	StationId   int    `json:"stationId"`
+	HostId      int    `json:"hostId,omitempty"`
+	TypeId      int    `json:"typeId"`
+	Name        string `json:"name,omitempty"`
+	StationName string `json:"stationName,omitempty"`
+	TypeName    string `json:"typeName,omitempty"`
+}
+
+type deviceFileInfo struct {
+	Id      int              `json:"id"`
+	Sensors []sensorFileInfo `json:"sensors"`
+}
+
+type sensorFileInfo struct {
+	Id       int               `json:"id"`
+	Measures []measureFileInfo `json:"measures"`
+}
+
+type measureFileInfo struct {
+	ObjectId    int    `json:"objectId"`
+	MeasureId   int    `json:"measureId"`
+	IsAttribute bool   `json:"isAttribute,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+type objectTypeFileStates struct {
+	TypeId int               `json:"typeId"`
+	States []ObjectStateInfo `json:"states"`
+}
+
+func getSortedKeys(m map[int]bool) []int {
+	result := make([]int, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// MarshalJSON записывает конфигурацию архива в формате, не требующем проекта для загрузки
+func (archiveConfig *ConfigurationInfo) MarshalJSON() ([]byte, error) {
+	file := &configurationFile{
+		Version:  configurationFileVersion,
+		IsSubset: archiveConfig.isSubset,
+		Objects:  []objectFileInfo{},
+		Devices:  []deviceFileInfo{}}
+
+	// Названия хранятся в описании объекта, а не в каждом измерении
+	objectNames := make(map[int]*archiveMeasureOrAttributeInfo)
+
+	deviceIds := make(map[int]bool)
+	for deviceId := range archiveConfig.mappings {
+		deviceIds[deviceId] = true
+	}
+
+	for _, deviceId := range getSortedKeys(deviceIds) {
+		deviceMapping := archiveConfig.mappings[deviceId]
+		device := deviceFileInfo{Id: deviceId}
+
+		sensorIds := make(map[int]bool)
+		for sensorId := range deviceMapping {
+			sensorIds[sensorId] = true
+		}
+
+		for _, sensorId := range getSortedKeys(sensorIds) {
+			sensor := sensorFileInfo{Id: sensorId}
+
+			for _, m := range deviceMapping[sensorId] {
+				if _, ok := archiveConfig.Objects[m.objectId]; !ok {
+					return nil, fmt.Errorf("object {%d} is not found for device {%d} sensor {%d}", m.objectId, deviceId, sensorId)
+				}
+
+				sensor.Measures = append(sensor.Measures, measureFileInfo{
+					ObjectId:    m.objectId,
+					MeasureId:   m.measureOrAttributeId,
+					IsAttribute: m.isAttribute,
+					Unit:        m.unitOfMeasure,
+					Name:        m.measureOrAttributeName})
+
+				objectNames[m.objectId] = m
+			}
+
+			device.Sensors = append(device.Sensors, sensor)
+		}
+
+		file.Devices = append(file.Devices, device)
+	}
+
+	objectIds := make(map[int]bool)
+	for objectId := range archiveConfig.Objects {
+		objectIds[objectId] = true
+	}
+
+	for _, objectId := range getSortedKeys(objectIds) {
+		obj := archiveConfig.Objects[objectId]
+		objectInfo := objectFileInfo{
+			Id:        objectId,
+			StationId: obj.stationId,
+			HostId:    obj.hostId,
+			TypeId:    obj.typeId}
+
+		if m, ok := objectNames[objectId]; ok {
+			objectInfo.Name = m.objectName
+			objectInfo.StationName = m.stationName
+			objectInfo.TypeName = m.objectTypeName
+		}
+
+		file.Objects = append(file.Objects, objectInfo)
+	}
+
+	typeIds := make(map[int]bool)
+	for typeId := range archiveConfig.objectStates {
+		typeIds[typeId] = true
+	}
+
+	for _, typeId := range getSortedKeys(typeIds) {
+		typeStates := objectTypeFileStates{TypeId: typeId, States: []ObjectStateInfo{}}
+
+		for _, state := range archiveConfig.objectStates[typeId] {
+			typeStates.States = append(typeStates.States, *state)
+		}
+
+		sort.Slice(typeStates.States, func(i, j int) bool {
+			return typeStates.States[i].Id < typeStates.States[j].Id
+		})
+
+		file.ObjectStates = append(file.ObjectStates, typeStates)
+	}
+
+	return json.Marshal(file)
+}
+
+// UnmarshalJSON загружает конфигурацию архива, записанную MarshalJSON
+func (archiveConfig *ConfigurationInfo) UnmarshalJSON(data []byte) error {
+	var file configurationFile
+
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	if file.Version != configurationFileVersion {
+		return fmt.Errorf("unsupported configuration file version %d", file.Version)
+	}
+
+	result := ConfigurationInfo{
+		mappings:         make(map[int]map[int][]*archiveMeasureOrAttributeInfo),
+		Objects:          make(map[int]*ObjectInfo),
+		objectStates:     make(map[int]map[int]*ObjectStateInfo),
+		validationReport: &ValidationReport{},
+		isSubset:         file.IsSubset}
+
+	objects := make(map[int]*objectFileInfo)
+
+	for i := range file.Objects {
+		obj := &file.Objects[i]
+		objects[obj.Id] = obj
+		result.Objects[obj.Id] = &ObjectInfo{
+			objectId:  obj.Id,
+			stationId: obj.StationId,
+			hostId:    obj.HostId,
+			typeId:    obj.TypeId}
+	}
+
+	for _, device := range file.Devices {
+		devInfo := make(map[int][]*archiveMeasureOrAttributeInfo)
+		result.mappings[device.Id] = devInfo
+
+		for _, sensor := range device.Sensors {
+			for _, m := range sensor.Measures {
+				obj, ok := objects[m.ObjectId]
+				if !ok {
+					return fmt.Errorf("object {%d} is not found for device {%d} sensor {%d}", m.ObjectId, device.Id, sensor.Id)
+				}
+
+				devInfo[sensor.Id] = append(devInfo[sensor.Id], &archiveMeasureOrAttributeInfo{
+					objectId:               m.ObjectId,
+					measureOrAttributeId:   m.MeasureId,
+					unitOfMeasure:          m.Unit,
+					stationId:              obj.StationId,
+					objectTypeId:           obj.TypeId,
+					isAttribute:            m.IsAttribute,
+					objectName:             obj.Name,
+					measureOrAttributeName: m.Name,
+					objectTypeName:         obj.TypeName,
+					stationName:            obj.StationName})
+			}
+		}
+	}
+
+	for _, typeStates := range file.ObjectStates {
+		states := make(map[int]*ObjectStateInfo)
+		for i := range typeStates.States {
+			state := typeStates.States[i]
+			states[state.Id] = &state
+		}
+		result.objectStates[typeStates.TypeId] = states
+	}
+
+	*archiveConfig = result
+
+	return nil
+}
+
+// SaveConfigurationInfo записывает конфигурацию архива для запуска без проекта
+func SaveConfigurationInfo(archiveConfig *ConfigurationInfo, writer io.Writer) error {
+	return json.NewEncoder(writer).Encode(archiveConfig)
+}
+
+// LoadConfigurationInfo загружает конфигурацию архива, записанную SaveConfigurationInfo
+func LoadConfigurationInfo(reader io.Reader) (*ConfigurationInfo, error) {
+	result := &ConfigurationInfo{}
+
+	if err := json.NewDecoder(reader).Decode(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// LoadObjectStatesDictionary загружает словарь состояний объектов в формате раздела objectStates
+// файла конфигурации: [{"typeId": 1, "states": [{"id": 1, "name": "Норма", "severity": 1}]}]
+func LoadObjectStatesDictionary(reader io.Reader) (ObjectStatesDictionary, error) {
+	var file []objectTypeFileStates
+
+	if err := json.NewDecoder(reader).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	result := make(ObjectStatesDictionary)
+
+	for _, typeStates := range file {
+		for i := range typeStates.States {
+			result[typeStates.TypeId] = append(result[typeStates.TypeId], &typeStates.States[i])
+		}
+	}
+
+	return result, nil
+}
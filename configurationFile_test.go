@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func getConfigurationFileTestInfo(t *testing.T) *ConfigurationInfo {
+	project := &testProjectWithNames{
+		TestProjectData: *getDiffTestProject(),
+		stations:        map[int]string{1000: "Station"},
+		objectTypes:     map[int]string{1: "Type"},
+	}
+
+	info, err := NewConfigurationInfo(project, WithNames())
+	assert.Nil(t, err)
+
+	info.objectStates = map[int]map[int]*ObjectStateInfo{
+		1: {1: {Id: 1, Name: "Норма", Severity: 1}, 2: {Id: 2, Name: "Отказ", Severity: 3}},
+	}
+
+	return info
+}
+
+func TestConfigurationInfoRoundTrip(t *testing.T) {
+	info := getConfigurationFileTestInfo(t)
+
+	var buf bytes.Buffer
+	err := SaveConfigurationInfo(info, &buf)
+	assert.Nil(t, err)
+
+	loaded, err := LoadConfigurationInfo(&buf)
+	assert.Nil(t, err)
+
+	assert.Equal(t, info.Objects, loaded.Objects)
+	assert.Equal(t, info.objectStates, loaded.objectStates)
+	assert.Equal(t, len(info.mappings), len(loaded.mappings))
+
+	for deviceId, deviceMapping := range info.mappings {
+		for sensorId, sensorMapping := range deviceMapping {
+			assert.ElementsMatch(t, sensorMapping, loaded.mappings[deviceId][sensorId])
+		}
+	}
+
+	// Повторная запись дает тот же файл
+	first, err := json.Marshal(info)
+	assert.Nil(t, err)
+	second, err := json.Marshal(loaded)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(first), string(second))
+}
+
+func TestConfigurationInfoRoundTripRuntime(t *testing.T) {
+	info := getConfigurationFileTestInfo(t)
+
+	var buf bytes.Buffer
+	err := SaveConfigurationInfo(info, &buf)
+	assert.Nil(t, err)
+
+	loaded, err := LoadConfigurationInfo(&buf)
+	assert.Nil(t, err)
+
+	data := make([]byte, 16)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	dataPackage := &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(time.Now()),
+		DeviceId:      3,
+		Format:        core.PackageFormatData,
+		Data:          data,
+		BitsPerSensor: 32,
+		DataSize:      16,
+		SensorCount:   4}
+
+	expected, err := NewRuntimeConfiguration(info).GetUpdateRequestItemsFromPackage(dataPackage)
+	assert.Nil(t, err)
+
+	actual, err := NewRuntimeConfiguration(loaded).GetUpdateRequestItemsFromPackage(dataPackage)
+	assert.Nil(t, err)
+
+	assert.Len(t, actual, len(expected))
+	assert.Equal(t, expected[0].request, actual[0].request)
+
+	var expectedItem, actualItem MeasuresDocument
+	assert.Nil(t, json.Unmarshal([]byte(expected[0].item), &expectedItem))
+	assert.Nil(t, json.Unmarshal([]byte(actual[0].item), &actualItem))
+
+	assert.NotEmpty(t, actualItem.Measures)
+	assert.ElementsMatch(t, expectedItem.Measures, actualItem.Measures)
+	assert.ElementsMatch(t, expectedItem.Attributes, actualItem.Attributes)
+	assert.ElementsMatch(t, expectedItem.Stations, actualItem.Stations)
+	assert.Equal(t, "Station", actualItem.Measures[0].StationName)
+}
+
+func TestLoadConfigurationInfoErrors(t *testing.T) {
+	_, err := LoadConfigurationInfo(bytes.NewBufferString(`{"version":100}`))
+	assert.NotNil(t, err)
+
+	_, err = LoadConfigurationInfo(bytes.NewBufferString(
+		`{"version":1,"objects":[],"devices":[{"id":1,"sensors":[{"id":0,"measures":[{"objectId":5,"measureId":1}]}]}]}`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,74 @@
+package archive
+
+import "sort"
+
+// GetMeasureMapping возвращает устройство и датчик, с которого поступает измерение или атрибут объекта,
+// или nil, если измерение не записывается в архив
+func (archiveConfig *ConfigurationInfo) GetMeasureMapping(objectId int, measureId int, isAttribute bool) *MeasureMappingInfo {
+	for deviceId, deviceMapping := range archiveConfig.mappings {
+		for sensorId, sensorMapping := range deviceMapping {
+			for _, m := range sensorMapping {
+				if m.objectId == objectId && m.measureOrAttributeId == measureId && m.isAttribute == isAttribute {
+					return newMeasureMappingInfo(deviceId, sensorId, m)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetDeviceMappings возвращает измерения и атрибуты, привязанные к датчикам устройства, упорядоченные по номеру датчика
+func (archiveConfig *ConfigurationInfo) GetDeviceMappings(deviceId int) []MeasureMappingInfo {
+	var result []MeasureMappingInfo
+
+	for sensorId, sensorMapping := range archiveConfig.mappings[deviceId] {
+		for _, m := range sensorMapping {
+			result = append(result, *newMeasureMappingInfo(deviceId, sensorId, m))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SensorId != result[j].SensorId {
+			return result[i].SensorId < result[j].SensorId
+		}
+		return lessMeasureMapping(&result[i], &result[j])
+	})
+
+	return result
+}
+
+// GetStationObjects возвращает упорядоченный список объектов станции
+func (archiveConfig *ConfigurationInfo) GetStationObjects(stationId int) []int {
+	var result []int
+
+	for objectId, obj := range archiveConfig.Objects {
+		if obj.stationId == stationId {
+			result = append(result, objectId)
+		}
+	}
+
+	sort.Ints(result)
+
+	return result
+}
+
+// GetHostStations возвращает упорядоченный список станций, объекты которых обслуживаются хостом
+func (archiveConfig *ConfigurationInfo) GetHostStations(hostId int) []int {
+	stations := make(map[int]bool)
+
+	for _, obj := range archiveConfig.Objects {
+		if obj.hostId == hostId {
+			stations[obj.stationId] = true
+		}
+	}
+
+	var result []int
+	for stationId := range stations {
+		result = append(result, stationId)
+	}
+
+	sort.Ints(result)
+
+	return result
+}
@@ -0,0 +1,59 @@
+package archive
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getLookupTestConfigurationInfo() *ConfigurationInfo {
+	return &ConfigurationInfo{
+		Objects: map[int]*ObjectInfo{
+			100: {objectId: 100, stationId: 30000, hostId: 800},
+			200: {objectId: 200, stationId: 30000, hostId: 800},
+			300: {objectId: 300, stationId: 31000, hostId: 800},
+			400: {objectId: 400, stationId: 32000, hostId: 900},
+		},
+		mappings: map[int]map[int][]*archiveMeasureOrAttributeInfo{
+			5: {
+				1: {{objectId: 100, measureOrAttributeId: 7, unitOfMeasure: "В"},
+					{objectId: 200, measureOrAttributeId: 7, unitOfMeasure: "В"}},
+				0: {{objectId: 100, measureOrAttributeId: 7, isAttribute: true}},
+			},
+			6: {
+				3: {{objectId: 300, measureOrAttributeId: 8}},
+			},
+		},
+	}
+}
+
+func TestGetMeasureMapping(t *testing.T) {
+	info := getLookupTestConfigurationInfo()
+
+	assert.Equal(t, &MeasureMappingInfo{ObjectId: 100, MeasureId: 7, DeviceId: 5, SensorId: 1, UnitOfMeasure: "В"},
+		info.GetMeasureMapping(100, 7, false))
+	assert.Equal(t, &MeasureMappingInfo{ObjectId: 100, MeasureId: 7, IsAttribute: true, DeviceId: 5, SensorId: 0},
+		info.GetMeasureMapping(100, 7, true))
+	assert.Nil(t, info.GetMeasureMapping(100, 8, false))
+}
+
+func TestGetDeviceMappings(t *testing.T) {
+	info := getLookupTestConfigurationInfo()
+
+	assert.Equal(t, []MeasureMappingInfo{
+		{ObjectId: 100, MeasureId: 7, IsAttribute: true, DeviceId: 5, SensorId: 0},
+		{ObjectId: 100, MeasureId: 7, DeviceId: 5, SensorId: 1, UnitOfMeasure: "В"},
+		{ObjectId: 200, MeasureId: 7, DeviceId: 5, SensorId: 1, UnitOfMeasure: "В"},
+	}, info.GetDeviceMappings(5))
+	assert.Empty(t, info.GetDeviceMappings(7))
+}
+
+func TestGetStationObjectsAndHostStations(t *testing.T) {
+	info := getLookupTestConfigurationInfo()
+
+	assert.Equal(t, []int{100, 200}, info.GetStationObjects(30000))
+	assert.Empty(t, info.GetStationObjects(1))
+
+	assert.Equal(t, []int{30000, 31000}, info.GetHostStations(800))
+	assert.Equal(t, []int{32000}, info.GetHostStations(900))
+	assert.Empty(t, info.GetHostStations(1))
+}
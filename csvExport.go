@@ -0,0 +1,333 @@
+package archive
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/imsat-spb/go-apkdk-core"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MeasureRecord значение измерения или атрибута объекта с описанием.
+// Если значение не определено, Value содержит NaN
+type MeasureRecord struct {
+	Time           time.Time
+	ObjectId       int
+	ObjectName     string
+	ObjectTypeId   int
+	ObjectTypeName string
+	MeasureId      int
+	IsAttribute    bool
+	MeasureName    string
+	Unit           string
+	// Устройство заполняется из документа архива. Станция и датчик в документах не хранятся
+	// и заполняются только для значений, полученных через WithMeasureListener
+	StationId   int
+	StationName string
+	DeviceId    int32
+	SensorId    uint16
+	Value       float32
+}
+
+func newMeasureRecord(doc *MeasuresDocument, item *MeasureOrAttributeItem, measureId int, isAttribute bool) *MeasureRecord {
+	result := &MeasureRecord{
+		Time:           getTimeFromUnixMilliseconds(doc.Time),
+		ObjectId:       item.ObjectId,
+		ObjectName:     item.ObjectName,
+		ObjectTypeId:   item.ObjectTypeId,
+		ObjectTypeName: item.ObjectTypeName,
+		MeasureId:      measureId,
+		IsAttribute:    isAttribute,
+		MeasureName:    item.Name,
+		Unit:           item.Unit,
+		StationName:    item.StationName,
+		DeviceId:       doc.DeviceId,
+		Value:          core.GetNaN()}
+
+	if item.Value != nil {
+		result.Value = *item.Value
+	}
+
+	return result
+}
+
+// MeasureHistoryReader источник истории значений измерений и атрибутов
+type MeasureHistoryReader interface {
+	StreamMeasureHistory(ctx context.Context, objectId int, measureId int, isAttribute bool,
+		from time.Time, to time.Time, handler func(record *MeasureRecord) error) error
+}
+
+// CsvColumn колонка выгрузки в CSV
+type CsvColumn string
+
+const (
+	CsvColumnTime        CsvColumn = "time"
+	CsvColumnObjectId    CsvColumn = "objectId"
+	CsvColumnObjectName  CsvColumn = "objectName"
+	CsvColumnMeasureId   CsvColumn = "measureId"
+	CsvColumnMeasureName CsvColumn = "measureName"
+	CsvColumnUnit        CsvColumn = "unit"
+	CsvColumnStation     CsvColumn = "stationName"
+	CsvColumnValue       CsvColumn = "value"
+)
+
+type csvOptions struct {
+	delimiter        rune
+	decimalSeparator string
+	location         *time.Location
+	timeFormat       string
+	columns          []CsvColumn
+	header           bool
+	bom              bool
+	filter           func(record *MeasureRecord) bool
+}
+
+// CsvOption задает параметры выгрузки в CSV
+type CsvOption func(options *csvOptions)
+
+// WithCsvDelimiter задает разделитель колонок. По умолчанию используется точка с запятой
+func WithCsvDelimiter(delimiter rune) CsvOption {
+	return func(options *csvOptions) {
+		options.delimiter = delimiter
+	}
+}
+
+// WithCsvDecimalSeparator задает разделитель целой и дробной части значения. По умолчанию используется запятая
+func WithCsvDecimalSeparator(separator rune) CsvOption {
+	return func(options *csvOptions) {
+		options.decimalSeparator = string(separator)
+	}
+}
+
+// WithCsvLocation задает часовой пояс времени. По умолчанию время записывается в UTC
+func WithCsvLocation(location *time.Location) CsvOption {
+	return func(options *csvOptions) {
+		options.location = location
+	}
+}
+
+// WithCsvTimeFormat задает формат времени в терминах пакета time
+func WithCsvTimeFormat(format string) CsvOption {
+	return func(options *csvOptions) {
+		options.timeFormat = format
+	}
+}
+
+// WithCsvColumns задает состав и порядок колонок
+func WithCsvColumns(columns ...CsvColumn) CsvOption {
+	return func(options *csvOptions) {
+		options.columns = columns
+	}
+}
+
+// WithoutCsvHeader отключает запись строки с названиями колонок
+func WithoutCsvHeader() CsvOption {
+	return func(options *csvOptions) {
+		options.header = false
+	}
+}
+
+// WithoutCsvBom отключает запись метки порядка байтов UTF-8 в начале файла
+func WithoutCsvBom() CsvOption {
+	return func(options *csvOptions) {
+		options.bom = false
+	}
+}
+
+// WithCsvFilter задает отбор записываемых значений
+func WithCsvFilter(filter func(record *MeasureRecord) bool) CsvOption {
+	return func(options *csvOptions) {
+		options.filter = filter
+	}
+}
+
+// CsvWriter записывает значения измерений в CSV построчно
+type CsvWriter struct {
+	output  io.Writer
+	writer  *csv.Writer
+	options csvOptions
+	started bool
+}
+
+// Метка порядка байтов, без нее Excel открывает UTF-8 в кодировке Windows-1251
+const csvUtf8Bom = "\xef\xbb\xbf"
+
+// NewCsvWriter создает выгрузку в CSV. По умолчанию формат рассчитан на открытие в Excel с русскими
+// региональными настройками: разделитель колонок точка с запятой, разделитель дробной части запятая,
+// в начале файла записывается метка порядка байтов UTF-8
+func NewCsvWriter(writer io.Writer, opts ...CsvOption) *CsvWriter {
+	result := &CsvWriter{
+		output: writer,
+		writer: csv.NewWriter(writer),
+		options: csvOptions{
+			delimiter:        ';',
+			decimalSeparator: ",",
+			location:         time.UTC,
+			timeFormat:       "2006-01-02 15:04:05.000",
+			columns: []CsvColumn{CsvColumnTime, CsvColumnObjectName, CsvColumnMeasureName,
+				CsvColumnUnit, CsvColumnValue},
+			header: true,
+			bom:    true}}
+
+	for _, opt := range opts {
+		opt(&result.options)
+	}
+
+	result.writer.Comma = result.options.delimiter
+
+	return result
+}
+
+func (w *CsvWriter) formatValue(value float32) string {
+	if core.IsNaN(value) {
+		return ""
+	}
+
+	return strings.Replace(strconv.FormatFloat(float64(value), 'f', -1, 32), ".", w.options.decimalSeparator, 1)
+}
+
+func (w *CsvWriter) getCell(record *MeasureRecord, column CsvColumn) string {
+	switch column {
+	case CsvColumnTime:
+		return record.Time.In(w.options.location).Format(w.options.timeFormat)
+	case CsvColumnObjectId:
+		return strconv.Itoa(record.ObjectId)
+	case CsvColumnObjectName:
+		return record.ObjectName
+	case CsvColumnMeasureId:
+		return strconv.Itoa(record.MeasureId)
+	case CsvColumnMeasureName:
+		return record.MeasureName
+	case CsvColumnUnit:
+		return record.Unit
+	case CsvColumnStation:
+		return record.StationName
+	case CsvColumnValue:
+		return w.formatValue(record.Value)
+	default:
+		return ""
+	}
+}
+
+// Записывает метку порядка байтов и названия колонок перед первой строкой
+func (w *CsvWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	if w.options.bom {
+		if _, err := io.WriteString(w.output, csvUtf8Bom); err != nil {
+			return err
+		}
+	}
+
+	if !w.options.header {
+		return nil
+	}
+
+	header := make([]string, len(w.options.columns))
+	for i, column := range w.options.columns {
+		header[i] = string(column)
+	}
+
+	return w.writer.Write(header)
+}
+
+// WriteRecord записывает строку со значением. Перед первой строкой записываются названия колонок.
+// Подходит в качестве обработчика MeasureHistoryReader.StreamMeasureHistory
+func (w *CsvWriter) WriteRecord(record *MeasureRecord) error {
+	if w.options.filter != nil && !w.options.filter(record) {
+		return nil
+	}
+
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	row := make([]string, len(w.options.columns))
+	for i, column := range w.options.columns {
+		row[i] = w.getCell(record, column)
+	}
+
+	return w.writer.Write(row)
+}
+
+// WriteRequestItems записывает значения из документов измерений, сформированных RuntimeConfiguration.
+// Остальные документы пропускаются. CsvWriter может использоваться как получатель Replay
+func (w *CsvWriter) WriteRequestItems(ctx context.Context, items []*RequestItem) error {
+	for _, item := range items {
+		var rq map[string]*createRequest
+		if err := json.Unmarshal([]byte(item.request), &rq); err != nil {
+			return err
+		}
+
+		if action := getRequestAction(rq); action == nil || action.Index != defaultArchiveIndex {
+			continue
+		}
+
+		decoded, err := DecodeDocument([]byte(item.item))
+		if err != nil {
+			return err
+		}
+
+		doc, ok := decoded.(*MeasuresDocument)
+		if !ok {
+			continue
+		}
+
+		var records []*MeasureRecord
+		for i := range doc.Measures {
+			records = append(records, newMeasureRecord(doc, &doc.Measures[i].MeasureOrAttributeItem, doc.Measures[i].MeasureId, false))
+		}
+		for i := range doc.Attributes {
+			records = append(records, newMeasureRecord(doc, &doc.Attributes[i].MeasureOrAttributeItem, doc.Attributes[i].AttributeId, true))
+		}
+
+		// Измерения в документе записаны в произвольном порядке
+		sort.SliceStable(records, func(i, j int) bool {
+			a, b := records[i], records[j]
+			if a.ObjectId != b.ObjectId {
+				return a.ObjectId < b.ObjectId
+			}
+			if a.IsAttribute != b.IsAttribute {
+				return !a.IsAttribute
+			}
+			return a.MeasureId < b.MeasureId
+		})
+
+		for _, record := range records {
+			if err = w.WriteRecord(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Flush записывает буферизованные строки. Если значений не было, записываются только названия колонок
+func (w *CsvWriter) Flush() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// WriteMeasureHistoryCsv выгружает историю измерения или атрибута объекта за период в CSV
+func WriteMeasureHistoryCsv(ctx context.Context, reader MeasureHistoryReader, writer *CsvWriter,
+	objectId int, measureId int, isAttribute bool, from time.Time, to time.Time) error {
+
+	err := reader.StreamMeasureHistory(ctx, objectId, measureId, isAttribute, from, to, writer.WriteRecord)
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,116 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCsvWriter_WriteRecord(t *testing.T) {
+	var buf bytes.Buffer
+
+	location := time.FixedZone("MSK", 3*3600)
+	writer := NewCsvWriter(&buf, WithCsvLocation(location))
+
+	assert.Nil(t, writer.WriteRecord(&MeasureRecord{
+		Time:        time.Unix(0, 1500*int64(time.Millisecond)),
+		ObjectName:  "Стрелка 1; четная",
+		MeasureName: "Напряжение",
+		Unit:        "В",
+		Value:       220.5}))
+	assert.Nil(t, writer.WriteRecord(&MeasureRecord{
+		Time:        time.Unix(2, 0),
+		ObjectName:  "Стрелка 1",
+		MeasureName: "Напряжение",
+		Unit:        "В",
+		Value:       core.GetNaN()}))
+	assert.Nil(t, writer.Flush())
+
+	assert.Equal(t, csvUtf8Bom+"time;objectName;measureName;unit;value\n"+
+		"1970-01-01 03:00:01.500;\"Стрелка 1; четная\";Напряжение;В;220,5\n"+
+		"1970-01-01 03:00:02.000;Стрелка 1;Напряжение;В;\n", buf.String())
+}
+
+func TestCsvWriter_Options(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer := NewCsvWriter(&buf,
+		WithCsvDelimiter(','),
+		WithCsvDecimalSeparator('.'),
+		WithCsvTimeFormat(time.RFC3339),
+		WithCsvColumns(CsvColumnTime, CsvColumnObjectId, CsvColumnMeasureId, CsvColumnValue),
+		WithoutCsvHeader(),
+		WithoutCsvBom(),
+		WithCsvFilter(func(record *MeasureRecord) bool {
+			return record.ObjectId == 100
+		}))
+
+	assert.Nil(t, writer.WriteRecord(&MeasureRecord{Time: time.Unix(0, 0), ObjectId: 100, MeasureId: 7, Value: 0.125}))
+	assert.Nil(t, writer.WriteRecord(&MeasureRecord{Time: time.Unix(0, 0), ObjectId: 200, MeasureId: 7, Value: 1}))
+	assert.Nil(t, writer.Flush())
+
+	assert.Equal(t, "1970-01-01T00:00:00Z,100,7,0.125\n", buf.String())
+}
+
+func TestCsvWriter_WriteRequestItems(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithGapDetection(time.Minute))
+
+	items, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(1, 0), []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	writer := NewCsvWriter(&buf, WithCsvColumns(CsvColumnObjectId, CsvColumnMeasureId, CsvColumnUnit, CsvColumnValue))
+
+	assert.Nil(t, writer.WriteRequestItems(context.Background(), items))
+	assert.Nil(t, writer.Flush())
+
+	assert.Equal(t, csvUtf8Bom+"objectId;measureId;unit;value\n100;7;В;1\n200;8;;1\n", buf.String())
+
+	var records []*MeasureRecord
+	writer = NewCsvWriter(&bytes.Buffer{}, WithCsvFilter(func(record *MeasureRecord) bool {
+		records = append(records, record)
+		return true
+	}))
+	assert.Nil(t, writer.WriteRequestItems(context.Background(), items))
+
+	assert.Len(t, records, 2)
+	assert.Equal(t, int32(5), records[0].DeviceId)
+}
+
+func TestCsvWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+
+	// Заголовок записывается и без значений
+	assert.Nil(t, NewCsvWriter(&buf).Flush())
+	assert.Equal(t, csvUtf8Bom+"time;objectName;measureName;unit;value\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, NewCsvWriter(&buf, WithoutCsvBom(), WithCsvColumns(CsvColumnValue)).Flush())
+	assert.Equal(t, "value\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, NewCsvWriter(&buf, WithoutCsvBom(), WithoutCsvHeader()).Flush())
+	assert.Empty(t, buf.String())
+}
+
+func TestWriteMeasureHistoryCsv(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"hits":{"hits":[{"_source":{"schemaVersion":2,"time":1000,"stations":[1],"deviceId":10,` +
+			`"format":0,"measures":[{"objectId":5,"measureId":7,"unit":"А","value":0.5,"name":"Ток","objectName":"СП-1"}]}}]}}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	writer := NewCsvWriter(&buf)
+
+	err := WriteMeasureHistoryCsv(context.Background(), NewArchiveClient(server.URL, nil), writer,
+		5, 7, false, time.Unix(0, 0), time.Unix(10, 0))
+
+	assert.Nil(t, err)
+	assert.Equal(t, csvUtf8Bom+"time;objectName;measureName;unit;value\n1970-01-01 00:00:01.000;СП-1;Ток;А;0,5\n", buf.String())
+}
@@ -0,0 +1,421 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/deckarep/golang-set"
+	"github.com/imsat-spb/go-apkdk-core"
+	"sort"
+	"time"
+)
+
+const gapIndex = "gaps"
+
+// DataGapKind вид пропуска данных
+type DataGapKind int
+
+const (
+	// Устройство не присылало данные
+	GapNoData DataGapKind = iota + 1
+	// Значение измерения или атрибута не определено
+	GapNaN
+)
+
+func (kind DataGapKind) String() string {
+	switch kind {
+	case GapNoData:
+		return "noData"
+	case GapNaN:
+		return "nan"
+	default:
+		return fmt.Sprintf("gap %d", int(kind))
+	}
+}
+
+// DataGap пропуск данных устройства или значения измерения за период [Start, End)
+type DataGap struct {
+	Kind     DataGapKind
+	DeviceId int32
+	Start    time.Time
+	End      time.Time
+	Stations []int
+	// Заполняются для GapNaN
+	ObjectId    int
+	MeasureId   int
+	IsAttribute bool
+	// Пропуск не завершен, End содержит время проверки
+	Open bool
+}
+
+type gapItemInfo struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Kind          string `json:"kind"`
+	Time          int64  `json:"time"`
+	EndTime       int64  `json:"endTime"`
+	Duration      int64  `json:"duration"`
+	DeviceId      int32  `json:"deviceId"`
+	Stations      []int  `json:"stations"`
+	ObjectId      int    `json:"objectId,omitempty"`
+	MeasureId     int    `json:"measureId,omitempty"`
+	AttributeId   int    `json:"attributeId,omitempty"`
+	Open          bool   `json:"open,omitempty"`
+}
+
+// Отслеживает время пакетов устройств и неопределенные значения измерений
+type gapTracker struct {
+	maxInterval time.Duration
+	lastTimes   map[int32]time.Time
+	nanStarts   map[ParameterOrAttributeMappingKey]*nanGapStart
+}
+
+type nanGapStart struct {
+	deviceId int32
+	start    time.Time
+	stations []int
+}
+
+func newGapTracker(maxInterval time.Duration) *gapTracker {
+	return &gapTracker{
+		maxInterval: maxInterval,
+		lastTimes:   make(map[int32]time.Time),
+		nanStarts:   make(map[ParameterOrAttributeMappingKey]*nanGapStart)}
+}
+
+// Возвращает пропуск, если с предыдущего пакета устройства прошло больше maxInterval.
+// Пакеты, пришедшие с опозданием, не учитываются
+func (tracker *gapTracker) addPackage(deviceId int32, now time.Time, getStations func() []int) *DataGap {
+	lastTime, ok := tracker.lastTimes[deviceId]
+	if ok && !now.After(lastTime) {
+		return nil
+	}
+
+	tracker.lastTimes[deviceId] = now
+
+	if !ok || now.Sub(lastTime) <= tracker.maxInterval {
+		return nil
+	}
+
+	return &DataGap{
+		Kind:     GapNoData,
+		DeviceId: deviceId,
+		Start:    lastTime,
+		End:      now,
+		Stations: getStations()}
+}
+
+// Возвращает незавершенные пропуски на момент now: устройства без пакетов больше maxInterval
+// и неопределенные значения дольше maxInterval или, если all равно true, любой длительности
+func (tracker *gapTracker) getOpenGaps(now time.Time, all bool, getStations func(deviceId int32) []int) []*DataGap {
+	var result []*DataGap
+
+	for deviceId, lastTime := range tracker.lastTimes {
+		if now.Sub(lastTime) <= tracker.maxInterval {
+			continue
+		}
+
+		result = append(result, &DataGap{
+			Kind:     GapNoData,
+			DeviceId: deviceId,
+			Start:    lastTime,
+			End:      now,
+			Stations: getStations(deviceId),
+			Open:     true})
+	}
+
+	for key, nanStart := range tracker.nanStarts {
+		if !now.After(nanStart.start) || !all && now.Sub(nanStart.start) <= tracker.maxInterval {
+			continue
+		}
+
+		result = append(result, &DataGap{
+			Kind:        GapNaN,
+			DeviceId:    nanStart.deviceId,
+			Start:       nanStart.start,
+			End:         now,
+			Stations:    nanStart.stations,
+			ObjectId:    key.GetObjectId(),
+			MeasureId:   key.GetMeasureId(),
+			IsAttribute: key.isAttribute,
+			Open:        true})
+	}
+
+	sortDataGaps(result)
+
+	return result
+}
+
+// Возвращает пропуск, если неопределенное значение измерения сменилось определенным
+func (tracker *gapTracker) addValue(deviceId int32, key ParameterOrAttributeMappingKey, isNaN bool, now time.Time,
+	stations []int) *DataGap {
+
+	nanStart, ok := tracker.nanStarts[key]
+
+	if isNaN {
+		if !ok {
+			tracker.nanStarts[key] = &nanGapStart{deviceId: deviceId, start: now, stations: stations}
+		}
+		return nil
+	}
+
+	if !ok {
+		return nil
+	}
+
+	delete(tracker.nanStarts, key)
+
+	return &DataGap{
+		Kind:        GapNaN,
+		DeviceId:    nanStart.deviceId,
+		Start:       nanStart.start,
+		End:         now,
+		Stations:    stations,
+		ObjectId:    key.GetObjectId(),
+		MeasureId:   key.GetMeasureId(),
+		IsAttribute: key.isAttribute}
+}
+
+// WithGapDetection включает запись пропусков данных: периодов больше maxInterval без пакетов данных устройства
+// и периодов с неопределенными значениями измерений. Пропуск записывается в индекс gaps после его завершения.
+// Пропуски устройств, которые перестали присылать данные, записываются CheckGaps и FlushGaps
+func WithGapDetection(maxInterval time.Duration) RuntimeOption {
+	return func(runtimeConfig *RuntimeConfiguration) {
+		runtimeConfig.gaps = newGapTracker(maxInterval)
+	}
+}
+
+func getDeviceStations(deviceMapping map[uint16]*runtimeSensorMappingInfo) []int {
+	stations := mapset.NewSet()
+
+	for _, item := range deviceMapping {
+		for _, am := range item.measures {
+			stations.Add(am.stationId)
+		}
+	}
+
+	result := getIntSlice(stations)
+	sort.Ints(result)
+
+	return result
+}
+
+// Учитывает пакет данных устройства при поиске пропусков
+func (runtimeConfig *RuntimeConfiguration) trackGaps(packageInfo *core.DataPackage,
+	deviceMapping map[uint16]*runtimeSensorMappingInfo, values map[uint16]float32, now time.Time) {
+
+	tracker := runtimeConfig.gaps
+
+	gap := tracker.addPackage(packageInfo.DeviceId, now, func() []int {
+		return getDeviceStations(deviceMapping)
+	})
+	if gap != nil {
+		runtimeConfig.closedGaps = append(runtimeConfig.closedGaps, gap)
+	}
+
+	for sensorId, value := range values {
+		for _, am := range deviceMapping[sensorId].measures {
+			key := NewParameterOrAttributeMappingKey(am.objectId, am.measureOrAttributeId, am.isAttribute)
+			if gap = tracker.addValue(packageInfo.DeviceId, key, core.IsNaN(value), now, []int{am.stationId}); gap != nil {
+				runtimeConfig.closedGaps = append(runtimeConfig.closedGaps, gap)
+			}
+		}
+	}
+}
+
+func (gap *DataGap) getRequestItem() (*RequestItem, error) {
+	startTime := core.GetUnixMillisecondsFromTime(gap.Start)
+	endTime := core.GetUnixMillisecondsFromTime(gap.End)
+
+	item := &gapItemInfo{
+		SchemaVersion: DocumentSchemaVersion,
+		Kind:          gap.Kind.String(),
+		Time:          startTime,
+		EndTime:       endTime,
+		Duration:      endTime - startTime,
+		DeviceId:      gap.DeviceId,
+		Stations:      gap.Stations,
+		Open:          gap.Open}
+
+	id := fmt.Sprintf("%s_%d_%d", gap.Kind, gap.DeviceId, startTime)
+
+	if gap.Kind == GapNaN {
+		item.ObjectId = gap.ObjectId
+		kind := dictionaryKindMeasure
+		if gap.IsAttribute {
+			kind = dictionaryKindAttribute
+			item.AttributeId = gap.MeasureId
+		} else {
+			item.MeasureId = gap.MeasureId
+		}
+		id = fmt.Sprintf("%s_%s_%d_%d_%d", gap.Kind, kind, gap.ObjectId, gap.MeasureId, startTime)
+	}
+
+	// Идентификатор зависит только от начала пропуска, поэтому незавершенный пропуск,
+	// записанный CheckGaps, перезаписывается при его завершении
+	rq := map[string]*createRequest{"index": {DocType: "_doc", Index: gapIndex, Id: id}}
+
+	buf, err := json.Marshal(rq)
+	if err != nil {
+		return nil, err
+	}
+
+	itemBuf, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RequestItem{string(buf), string(itemBuf)}, nil
+}
+
+// Забирает запросы на запись завершенных пропусков
+func (runtimeConfig *RuntimeConfiguration) takeGapRequestItems() []*RequestItem {
+	runtimeConfig.lock.Lock()
+	closed := runtimeConfig.closedGaps
+	runtimeConfig.closedGaps = nil
+	runtimeConfig.lock.Unlock()
+
+	var result []*RequestItem
+	for _, gap := range closed {
+		if item, err := gap.getRequestItem(); err == nil {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func (runtimeConfig *RuntimeConfiguration) getOpenGapRequestItems(now time.Time, all bool) []*RequestItem {
+	runtimeConfig.lock.Lock()
+	var gaps []*DataGap
+	if runtimeConfig.gaps != nil {
+		gaps = runtimeConfig.gaps.getOpenGaps(now, all, func(deviceId int32) []int {
+			return getDeviceStations(runtimeConfig.mappings[deviceId])
+		})
+	}
+	runtimeConfig.closedGaps = append(runtimeConfig.closedGaps, gaps...)
+	runtimeConfig.lock.Unlock()
+
+	return runtimeConfig.takeGapRequestItems()
+}
+
+// CheckGaps возвращает запросы на запись пропусков, не завершенных на момент now: устройств, которые не присылали
+// данные больше maxInterval, и неопределенных дольше maxInterval значений. Вызывается периодически, чтобы пропуски
+// остановленных устройств попадали в архив до возобновления данных. Документ незавершенного пропуска (open)
+// перезаписывается при следующей проверке и при завершении пропуска
+func (runtimeConfig *RuntimeConfiguration) CheckGaps(now time.Time) []*RequestItem {
+	return runtimeConfig.getOpenGapRequestItems(now, false)
+}
+
+// FlushGaps возвращает запросы на запись всех незавершенных на момент now пропусков, включая неопределенные
+// значения короче maxInterval. Вызывается перед остановкой вместе с FlushRollups
+func (runtimeConfig *RuntimeConfiguration) FlushGaps(now time.Time) []*RequestItem {
+	return runtimeConfig.getOpenGapRequestItems(now, true)
+}
+
+func sortDataGaps(gaps []*DataGap) {
+	sort.SliceStable(gaps, func(i, j int) bool {
+		a, b := gaps[i], gaps[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.DeviceId != b.DeviceId {
+			return a.DeviceId < b.DeviceId
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.ObjectId != b.ObjectId {
+			return a.ObjectId < b.ObjectId
+		}
+		return a.MeasureId < b.MeasureId
+	})
+}
+
+// FindDataGaps находит пропуски данных устройств станции за период по документам архива.
+// Значения без изменений записываются в архив не реже раза в минуту, поэтому maxInterval должен быть больше минуты.
+// Пропуски в начале и в конце периода определяются только для устройств, приславших данные в этом периоде.
+// Если задана конфигурация архива, неопределенные значения учитываются только для объектов станции,
+// иначе пропуски значений относятся ко всем станциям документа
+func FindDataGaps(ctx context.Context, reader DocumentReader, archiveConfig *ConfigurationInfo, stationId int,
+	from time.Time, to time.Time, maxInterval time.Duration) ([]*DataGap, error) {
+
+	tracker := newGapTracker(maxInterval)
+	var result []*DataGap
+
+	getStations := func() []int {
+		return []int{stationId}
+	}
+
+	err := reader.ReadDocuments(ctx, stationId, []byte{core.PackageFormatData}, from, to, func(document []byte) error {
+		decoded, err := DecodeDocument(document)
+		if err != nil {
+			return err
+		}
+
+		doc, ok := decoded.(*MeasuresDocument)
+		if !ok {
+			return nil
+		}
+
+		now := getTimeFromUnixMilliseconds(doc.Time)
+
+		if _, ok := tracker.lastTimes[doc.DeviceId]; !ok {
+			tracker.lastTimes[doc.DeviceId] = from
+		}
+
+		if gap := tracker.addPackage(doc.DeviceId, now, getStations); gap != nil {
+			result = append(result, gap)
+		}
+
+		addValue := func(key ParameterOrAttributeMappingKey, value *float32) {
+			stations := doc.Stations
+			if archiveConfig != nil {
+				obj, ok := archiveConfig.Objects[key.GetObjectId()]
+				if !ok || obj.stationId != stationId {
+					return
+				}
+				stations = getStations()
+			}
+
+			if gap := tracker.addValue(doc.DeviceId, key, value == nil, now, stations); gap != nil {
+				result = append(result, gap)
+			}
+		}
+
+		for _, m := range doc.Measures {
+			addValue(NewParameterOrAttributeMappingKey(m.ObjectId, m.MeasureId, false), m.Value)
+		}
+		for _, a := range doc.Attributes {
+			addValue(NewParameterOrAttributeMappingKey(a.ObjectId, a.AttributeId, true), a.Value)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Незавершенные пропуски заканчиваются концом периода
+	for deviceId := range tracker.lastTimes {
+		if gap := tracker.addPackage(deviceId, to, getStations); gap != nil {
+			result = append(result, gap)
+		}
+	}
+
+	for key, nanStart := range tracker.nanStarts {
+		result = append(result, &DataGap{
+			Kind:        GapNaN,
+			DeviceId:    nanStart.deviceId,
+			Start:       nanStart.start,
+			End:         to,
+			Stations:    nanStart.stations,
+			ObjectId:    key.GetObjectId(),
+			MeasureId:   key.GetMeasureId(),
+			IsAttribute: key.isAttribute})
+	}
+
+	sortDataGaps(result)
+
+	return result, nil
+}
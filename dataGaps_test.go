@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func getGapItems(t *testing.T, items []*RequestItem) map[string]*gapItemInfo {
+	result := make(map[string]*gapItemInfo)
+
+	for _, item := range items {
+		var rq map[string]*createRequest
+		assert.Nil(t, json.Unmarshal([]byte(item.request), &rq))
+
+		action, ok := rq["index"]
+		if !ok || action.Index != gapIndex {
+			continue
+		}
+
+		var info gapItemInfo
+		assert.Nil(t, json.Unmarshal([]byte(item.item), &info))
+		result[action.Id] = &info
+	}
+
+	return result
+}
+
+func TestRuntimeGapDetection(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithGapDetection(2 * time.Minute))
+
+	start := time.Unix(1000, 0)
+
+	res, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start, []byte{1, 0, 0, 0}))
+	assert.Nil(t, err)
+	assert.Empty(t, getGapItems(t, res))
+
+	res, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(time.Minute), []byte{0, 0, 0, 0x80}))
+	assert.Nil(t, err)
+	assert.Empty(t, getGapItems(t, res))
+
+	// Пакет с опозданием не влияет на поиск пропусков
+	res, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(30*time.Second), []byte{0, 0, 0, 0x80}))
+	assert.Nil(t, err)
+	assert.Empty(t, getGapItems(t, res))
+
+	res, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(5*time.Minute), []byte{2, 0, 0, 0}))
+	assert.Nil(t, err)
+
+	gaps := getGapItems(t, res)
+	assert.Len(t, gaps, 3)
+
+	noData := gaps["noData_5_1060000"]
+	assert.NotNil(t, noData)
+	assert.Equal(t, int64(1060000), noData.Time)
+	assert.Equal(t, int64(1300000), noData.EndTime)
+	assert.Equal(t, int64(240000), noData.Duration)
+	assert.Equal(t, []int{30000, 33000}, noData.Stations)
+
+	measure := gaps["nan_measure_100_7_1060000"]
+	assert.NotNil(t, measure)
+	assert.Equal(t, "nan", measure.Kind)
+	assert.Equal(t, 7, measure.MeasureId)
+	assert.Equal(t, int64(1300000), measure.EndTime)
+	assert.Equal(t, []int{30000}, measure.Stations)
+
+	attribute := gaps["nan_attribute_200_8_1060000"]
+	assert.NotNil(t, attribute)
+	assert.Equal(t, 8, attribute.AttributeId)
+	assert.Equal(t, []int{33000}, attribute.Stations)
+}
+
+func TestRuntimeCheckGaps(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithGapDetection(2 * time.Minute))
+
+	start := time.Unix(1000, 0)
+
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start, []byte{0, 0, 0, 0x80}))
+	assert.Nil(t, err)
+
+	assert.Empty(t, info.CheckGaps(start.Add(time.Minute)))
+
+	// Устройство перестало присылать данные, незавершенные пропуски записываются при проверке
+	gaps := getGapItems(t, info.CheckGaps(start.Add(3*time.Minute)))
+	assert.Len(t, gaps, 3)
+
+	noData := gaps["noData_5_1000000"]
+	assert.NotNil(t, noData)
+	assert.True(t, noData.Open)
+	assert.Equal(t, int64(1180000), noData.EndTime)
+	assert.Equal(t, []int{30000, 33000}, noData.Stations)
+
+	measure := gaps["nan_measure_100_7_1000000"]
+	assert.NotNil(t, measure)
+	assert.True(t, measure.Open)
+	assert.Equal(t, []int{30000}, measure.Stations)
+
+	// Возобновление данных завершает пропуск документом с тем же идентификатором
+	res, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(5*time.Minute), []byte{1, 0, 0, 0}))
+	assert.Nil(t, err)
+
+	gaps = getGapItems(t, res)
+	assert.Len(t, gaps, 3)
+	assert.False(t, gaps["noData_5_1000000"].Open)
+	assert.Equal(t, int64(1300000), gaps["noData_5_1000000"].EndTime)
+
+	assert.Empty(t, info.CheckGaps(start.Add(6*time.Minute)))
+}
+
+func TestRuntimeFlushGaps(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithGapDetection(2 * time.Minute))
+
+	start := time.Unix(1000, 0)
+
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start, []byte{1, 0, 0, 0}))
+	assert.Nil(t, err)
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(time.Minute), []byte{0, 0, 0, 0x80}))
+	assert.Nil(t, err)
+
+	// При остановке записываются неопределенные значения любой длительности
+	gaps := getGapItems(t, info.FlushGaps(start.Add(90*time.Second)))
+	assert.Len(t, gaps, 2)
+	assert.Equal(t, int64(1090000), gaps["nan_measure_100_7_1060000"].EndTime)
+	assert.True(t, gaps["nan_attribute_200_8_1060000"].Open)
+
+	assert.Empty(t, getTestRuntimeConfiguration().FlushGaps(start))
+}
+
+func TestFindDataGaps(t *testing.T) {
+	reader := &testDocumentReader{documents: [][]byte{
+		[]byte(`{"schemaVersion":2,"time":1000,"stations":[30000],"deviceId":5,"format":0,` +
+			`"measures":[{"objectId":100,"measureId":7,"value":1}]}`),
+		[]byte(`{"schemaVersion":2,"time":61000,"stations":[30000],"deviceId":5,"format":0,` +
+			`"measures":[{"objectId":100,"measureId":7}]}`),
+		[]byte(`{"schemaVersion":2,"time":400000,"stations":[30000],"deviceId":5,"format":0,` +
+			`"measures":[{"objectId":100,"measureId":7,"value":2}],"attributes":[{"objectId":100,"attributeId":9}]}`),
+		[]byte(`{"schemaVersion":2,"time":450000,"stations":[30000],"deviceId":6,"format":0,` +
+			`"measures":[{"objectId":300,"measureId":7,"value":2}]}`),
+	}}
+
+	gaps, err := FindDataGaps(context.Background(), reader, nil, 30000, time.Unix(0, 0), time.Unix(600, 0), 2*time.Minute)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*DataGap{
+		{Kind: GapNoData, DeviceId: 6, Start: time.Unix(0, 0), End: time.Unix(450, 0), Stations: []int{30000}},
+		{Kind: GapNoData, DeviceId: 5, Start: time.Unix(61, 0), End: time.Unix(400, 0), Stations: []int{30000}},
+		{Kind: GapNaN, DeviceId: 5, Start: time.Unix(61, 0), End: time.Unix(400, 0), Stations: []int{30000},
+			ObjectId: 100, MeasureId: 7},
+		{Kind: GapNoData, DeviceId: 5, Start: time.Unix(400, 0), End: time.Unix(600, 0), Stations: []int{30000}},
+		{Kind: GapNaN, DeviceId: 5, Start: time.Unix(400, 0), End: time.Unix(600, 0), Stations: []int{30000},
+			ObjectId: 100, MeasureId: 9, IsAttribute: true},
+		{Kind: GapNoData, DeviceId: 6, Start: time.Unix(450, 0), End: time.Unix(600, 0), Stations: []int{30000}},
+	}, gaps)
+}
+
+func TestFindDataGapsStations(t *testing.T) {
+	reader := &testDocumentReader{documents: [][]byte{
+		[]byte(`{"schemaVersion":2,"time":1000,"stations":[30000,33000],"deviceId":5,"format":0,` +
+			`"measures":[{"objectId":100,"measureId":7}],"attributes":[{"objectId":200,"attributeId":8}]}`),
+	}}
+
+	// Без конфигурации пропуски значений относятся ко всем станциям документа
+	gaps, err := FindDataGaps(context.Background(), reader, nil, 30000, time.Unix(0, 0), time.Unix(60, 0), 2*time.Minute)
+
+	assert.Nil(t, err)
+	assert.Len(t, gaps, 2)
+	assert.Equal(t, []int{30000, 33000}, gaps[0].Stations)
+
+	// Атрибут объекта другой станции пропускается
+	gaps, err = FindDataGaps(context.Background(), reader, getTestConfigurationInfo(), 30000, time.Unix(0, 0),
+		time.Unix(60, 0), 2*time.Minute)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*DataGap{
+		{Kind: GapNaN, DeviceId: 5, Start: time.Unix(1, 0), End: time.Unix(60, 0), Stations: []int{30000},
+			ObjectId: 100, MeasureId: 7},
+	}, gaps)
+}
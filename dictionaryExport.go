@@ -0,0 +1,320 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-configuration"
+)
+
+const dictionaryIndex = "dictionary"
+
+// Виды документов справочника
+const (
+	dictionaryKindObject    = "object"
+	dictionaryKindStation   = "station"
+	dictionaryKindDevice    = "device"
+	dictionaryKindMeasure   = "measure"
+	dictionaryKindAttribute = "attribute"
+)
+
+type dictionaryObjectInfo struct {
+	Kind        string `json:"kind"`
+	ObjectId    int    `json:"objectId"`
+	Name        string `json:"name"`
+	TypeId      int    `json:"objectTypeId"`
+	TypeName    string `json:"objectTypeName,omitempty"`
+	StationId   int    `json:"stationId"`
+	StationName string `json:"stationName,omitempty"`
+	HostId      int    `json:"hostId,omitempty"`
+}
+
+type dictionaryStationInfo struct {
+	Kind      string `json:"kind"`
+	StationId int    `json:"stationId"`
+	Name      string `json:"name,omitempty"`
+}
+
+type dictionaryDeviceInfo struct {
+	Kind          string `json:"kind"`
+	DeviceId      int    `json:"deviceId"`
+	SensorCount   int    `json:"sensorCount"`
+	BitsPerSensor int    `json:"bitsPerSensor"`
+}
+
+type dictionaryMeasureInfo struct {
+	Kind      string `json:"kind"`
+	ObjectId  int    `json:"objectId"`
+	MeasureId int    `json:"measureId"`
+	Name      string `json:"name"`
+	Unit      string `json:"unit"`
+	DeviceId  int    `json:"deviceId"`
+	SensorId  int    `json:"sensorId"`
+}
+
+type dictionaryAttributeInfo struct {
+	Kind        string `json:"kind"`
+	ObjectId    int    `json:"objectId"`
+	AttributeId int    `json:"attributeId"`
+	Name        string `json:"name"`
+	Unit        string `json:"unit"`
+	DeviceId    int    `json:"deviceId"`
+	SensorId    int    `json:"sensorId"`
+}
+
+func getDictionaryObjectId(objectId int) string {
+	return fmt.Sprintf("%s_%d", dictionaryKindObject, objectId)
+}
+
+func getDictionaryStationId(stationId int) string {
+	return fmt.Sprintf("%s_%d", dictionaryKindStation, stationId)
+}
+
+func getDictionaryDeviceId(deviceId int) string {
+	return fmt.Sprintf("%s_%d", dictionaryKindDevice, deviceId)
+}
+
+func getDictionaryMeasureId(m *MeasureMappingInfo) string {
+	kind := dictionaryKindMeasure
+	if m.IsAttribute {
+		kind = dictionaryKindAttribute
+	}
+	return fmt.Sprintf("%s_%d_%d", kind, m.ObjectId, m.MeasureId)
+}
+
+func getDictionaryRequestItem(id string, document interface{}) (*RequestItem, error) {
+	// Документы перезаписываются при повторной выгрузке
+	rq := map[string]*createRequest{"index": {DocType: "_doc", Index: dictionaryIndex, Id: id}}
+
+	buf, err := json.Marshal(rq)
+	if err != nil {
+		return nil, err
+	}
+
+	itemBuf, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RequestItem{string(buf), string(itemBuf)}, nil
+}
+
+// Объекты, станции, устройства и привязки конфигурации в порядке выгрузки справочника
+func getDictionaryContents(archiveConfig *ConfigurationInfo) ([]int, []int, []int, []MeasureMappingInfo) {
+	objectIds := make(map[int]bool)
+	stationIds := make(map[int]bool)
+	for objectId, obj := range archiveConfig.Objects {
+		objectIds[objectId] = true
+		stationIds[obj.stationId] = true
+	}
+
+	deviceIds := make(map[int]bool)
+	var measures []MeasureMappingInfo
+
+	for deviceId := range archiveConfig.mappings {
+		deviceIds[deviceId] = true
+		measures = append(measures, archiveConfig.GetDeviceMappings(deviceId)...)
+	}
+
+	sortMeasureMappings(measures)
+
+	return getSortedKeys(objectIds), getSortedKeys(stationIds), getSortedKeys(deviceIds), measures
+}
+
+// Идентификаторы документов справочника конфигурации в порядке выгрузки
+func getDictionaryIds(archiveConfig *ConfigurationInfo) []string {
+	objectIds, stationIds, deviceIds, measures := getDictionaryContents(archiveConfig)
+
+	var result []string
+	for _, objectId := range objectIds {
+		result = append(result, getDictionaryObjectId(objectId))
+	}
+	for _, stationId := range stationIds {
+		result = append(result, getDictionaryStationId(stationId))
+	}
+	for _, deviceId := range deviceIds {
+		result = append(result, getDictionaryDeviceId(deviceId))
+	}
+	for i := range measures {
+		result = append(result, getDictionaryMeasureId(&measures[i]))
+	}
+
+	return result
+}
+
+// GetDictionaryRequestItems возвращает запросы на запись справочника объектов, станций, устройств,
+// измерений и атрибутов конфигурации архива в индекс dictionary.
+// Идентификаторы документов не зависят от версии проекта, поэтому повторная выгрузка обновляет документы.
+// Документы, которых нет в новой конфигурации, удаляются запросами GetDictionaryDeleteRequestItems
+func GetDictionaryRequestItems(archiveConfig *ConfigurationInfo, project configuration.ProjectInformation) ([]*RequestItem, error) {
+	var result []*RequestItem
+
+	add := func(id string, document interface{}) error {
+		item, err := getDictionaryRequestItem(id, document)
+		if err != nil {
+			return err
+		}
+		result = append(result, item)
+		return nil
+	}
+
+	namesInfo, _ := project.(ProjectNamesInformation)
+
+	getStationName := func(stationId int) string {
+		if namesInfo == nil {
+			return ""
+		}
+		return namesInfo.GetStationName(stationId)
+	}
+
+	objectIds, stationIds, deviceIds, measures := getDictionaryContents(archiveConfig)
+
+	for _, objectId := range objectIds {
+		obj := archiveConfig.Objects[objectId]
+		document := &dictionaryObjectInfo{
+			Kind:        dictionaryKindObject,
+			ObjectId:    objectId,
+			TypeId:      obj.typeId,
+			StationId:   obj.stationId,
+			StationName: getStationName(obj.stationId),
+			HostId:      obj.hostId}
+
+		if oInfo := project.GetObjectInfo(objectId); oInfo != nil {
+			document.Name = oInfo.Name
+		}
+
+		if namesInfo != nil {
+			document.TypeName = namesInfo.GetObjectTypeName(obj.typeId)
+		}
+
+		if err := add(getDictionaryObjectId(objectId), document); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, stationId := range stationIds {
+		document := &dictionaryStationInfo{
+			Kind:      dictionaryKindStation,
+			StationId: stationId,
+			Name:      getStationName(stationId)}
+
+		if err := add(getDictionaryStationId(stationId), document); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, deviceId := range deviceIds {
+		document := &dictionaryDeviceInfo{
+			Kind:     dictionaryKindDevice,
+			DeviceId: deviceId}
+
+		if deviceInfo := project.GetDeviceInfo(deviceId); deviceInfo != nil {
+			document.SensorCount = deviceInfo.SensorCount
+			document.BitsPerSensor = deviceInfo.BitsPerSensor
+		}
+
+		if err := add(getDictionaryDeviceId(deviceId), document); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range measures {
+		m := &measures[i]
+
+		var document interface{}
+		if m.IsAttribute {
+			attribute := &dictionaryAttributeInfo{
+				Kind:        dictionaryKindAttribute,
+				ObjectId:    m.ObjectId,
+				AttributeId: m.MeasureId,
+				Unit:        m.UnitOfMeasure,
+				DeviceId:    m.DeviceId,
+				SensorId:    m.SensorId}
+			if attributeInfo := project.GetAttributeInfo(m.MeasureId); attributeInfo != nil {
+				attribute.Name = attributeInfo.GetName()
+			}
+			document = attribute
+		} else {
+			measure := &dictionaryMeasureInfo{
+				Kind:      dictionaryKindMeasure,
+				ObjectId:  m.ObjectId,
+				MeasureId: m.MeasureId,
+				Unit:      m.UnitOfMeasure,
+				DeviceId:  m.DeviceId,
+				SensorId:  m.SensorId}
+			if paramInfo := project.GetObjectParameterInfo(m.MeasureId); paramInfo != nil {
+				measure.Name = paramInfo.GetParameterDisplayName()
+			}
+			document = measure
+		}
+
+		if err := add(getDictionaryMeasureId(m), document); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// GetDictionaryDeleteRequestItems возвращает запросы на удаление из индекса dictionary документов
+// предыдущей выгрузки справочника, которых нет в новой конфигурации архива
+func GetDictionaryDeleteRequestItems(oldConfig, newConfig *ConfigurationInfo) ([]*RequestItem, error) {
+	actual := make(map[string]bool)
+	for _, id := range getDictionaryIds(newConfig) {
+		actual[id] = true
+	}
+
+	var result []*RequestItem
+
+	for _, id := range getDictionaryIds(oldConfig) {
+		if actual[id] {
+			continue
+		}
+
+		rq := map[string]*createRequest{"delete": {DocType: "_doc", Index: dictionaryIndex, Id: id}}
+
+		buf, err := json.Marshal(rq)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &RequestItem{request: string(buf)})
+	}
+
+	return result, nil
+}
+
+type enrichPolicyMatch struct {
+	Indices      string                 `json:"indices"`
+	MatchField   string                 `json:"match_field"`
+	EnrichFields []string               `json:"enrich_fields"`
+	Query        map[string]interface{} `json:"query"`
+}
+
+// GetDictionaryEnrichPolicies возвращает описания политик обогащения Elasticsearch по справочнику
+// (имя политики на тело запроса PUT _enrich/policy/<имя>) для поиска объектов и станций по идентификатору
+func GetDictionaryEnrichPolicies() (map[string]string, error) {
+	policies := map[string]*enrichPolicyMatch{
+		"apkdk-objects": {
+			Indices:      dictionaryIndex,
+			MatchField:   "objectId",
+			EnrichFields: []string{"name", "objectTypeName", "stationName"},
+			Query:        map[string]interface{}{"term": map[string]string{"kind": dictionaryKindObject}}},
+		"apkdk-stations": {
+			Indices:      dictionaryIndex,
+			MatchField:   "stationId",
+			EnrichFields: []string{"name"},
+			Query:        map[string]interface{}{"term": map[string]string{"kind": dictionaryKindStation}}},
+	}
+
+	result := make(map[string]string)
+
+	for name, policy := range policies {
+		buf, err := json.Marshal(map[string]*enrichPolicyMatch{"match": policy})
+		if err != nil {
+			return nil, err
+		}
+		result[name] = string(buf)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"encoding/json"
+	configuration "github.com/imsat-spb/go-apkdk-configuration"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestGetDictionaryRequestItems(t *testing.T) {
+	project := &testProjectWithNames{
+		TestProjectData: *getDiffTestProject(),
+		stations:        map[int]string{1000: "Station"},
+		objectTypes:     map[int]string{1: "Type"},
+	}
+	project.Objects[1].Name = "Object1"
+
+	info, err := NewConfigurationInfo(project)
+	assert.Nil(t, err)
+
+	items, err := GetDictionaryRequestItems(info, project)
+	assert.Nil(t, err)
+
+	// 2 объекта, 1 станция, 1 устройство, 3 измерения и 1 атрибут
+	assert.Len(t, items, 8)
+
+	var ids []string
+	for _, item := range items {
+		var rq map[string]*createRequest
+		assert.Nil(t, json.Unmarshal([]byte(item.request), &rq))
+		assert.Equal(t, dictionaryIndex, rq["index"].Index)
+		ids = append(ids, rq["index"].Id)
+	}
+
+	assert.Equal(t, []string{"object_1", "object_2", "station_1000", "device_3",
+		"measure_1_100", "measure_1_101", "attribute_1_200", "measure_2_100"}, ids)
+
+	var object dictionaryObjectInfo
+	assert.Nil(t, json.Unmarshal([]byte(items[0].item), &object))
+	assert.Equal(t, dictionaryObjectInfo{Kind: "object", ObjectId: 1, Name: "Object1", TypeId: 1, TypeName: "Type",
+		StationId: 1000, StationName: "Station", HostId: 175}, object)
+
+	var device dictionaryDeviceInfo
+	assert.Nil(t, json.Unmarshal([]byte(items[3].item), &device))
+	assert.Equal(t, dictionaryDeviceInfo{Kind: "device", DeviceId: 3, SensorCount: 100, BitsPerSensor: 32}, device)
+
+	var attribute dictionaryAttributeInfo
+	assert.Nil(t, json.Unmarshal([]byte(items[6].item), &attribute))
+	assert.Equal(t, dictionaryAttributeInfo{Kind: "attribute", ObjectId: 1, AttributeId: 200, Name: "A", Unit: "В",
+		DeviceId: 3, SensorId: 3}, attribute)
+
+	// Повторная выгрузка дает те же документы
+	again, err := GetDictionaryRequestItems(info, project)
+	assert.Nil(t, err)
+	assert.Equal(t, items, again)
+}
+
+func TestGetDictionaryRequestItemsZeroId(t *testing.T) {
+	project := getDiffTestProject()
+	project.Parameters[0] = &configuration.ObjectParameter{Id: 0, Name: "Z"}
+	project.ParameterMappings[configuration.NewParameterMappingKey(2, 0)] =
+		&configuration.ObjectParameterMapping{Id: 0, ObjectId: 2, DeviceId: 4, SensorId: 0}
+
+	info, err := NewConfigurationInfo(project)
+	assert.Nil(t, err)
+
+	items, err := GetDictionaryRequestItems(info, project)
+	assert.Nil(t, err)
+
+	// Измерение с идентификатором 0 записывается с полем measureId
+	assert.JSONEq(t, `{"kind":"measure","objectId":2,"measureId":0,"name":"Z","unit":"","deviceId":4,"sensorId":0}`,
+		items[len(items)-2].item)
+}
+
+func TestGetDictionaryDeleteRequestItems(t *testing.T) {
+	oldProject := getDiffTestProject()
+	newProject := getDiffTestProject()
+
+	// Объект 2 и измерение 101 объекта 1 удалены из проекта
+	delete(newProject.Objects, 2)
+	delete(newProject.ParameterMappings, configuration.NewParameterMappingKey(2, 100))
+	delete(newProject.ParameterMappings, configuration.NewParameterMappingKey(1, 101))
+
+	oldInfo, err := NewConfigurationInfo(oldProject)
+	assert.Nil(t, err)
+	newInfo, err := NewConfigurationInfo(newProject)
+	assert.Nil(t, err)
+
+	items, err := GetDictionaryDeleteRequestItems(oldInfo, newInfo)
+	assert.Nil(t, err)
+
+	var builder strings.Builder
+	for _, item := range items {
+		item.AddToBuilder(&builder)
+	}
+
+	assert.Equal(t,
+		`{"delete":{"_index":"dictionary","_id":"object_2","_type":"_doc"}}`+"\n"+
+			`{"delete":{"_index":"dictionary","_id":"measure_1_101","_type":"_doc"}}`+"\n"+
+			`{"delete":{"_index":"dictionary","_id":"measure_2_100","_type":"_doc"}}`+"\n",
+		builder.String())
+
+	items, err = GetDictionaryDeleteRequestItems(newInfo, newInfo)
+	assert.Nil(t, err)
+	assert.Empty(t, items)
+}
+
+func TestGetDictionaryEnrichPolicies(t *testing.T) {
+	policies, err := GetDictionaryEnrichPolicies()
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"match":{"indices":"dictionary","match_field":"objectId",`+
+		`"enrich_fields":["name","objectTypeName","stationName"],"query":{"term":{"kind":"object"}}}}`,
+		policies["apkdk-objects"])
+	assert.Contains(t, policies, "apkdk-stations")
+}
@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+)
+
+// DocumentSchemaVersion текущая версия схемы документов архива.
+// Документы без поля schemaVersion имеют версию 1
+const DocumentSchemaVersion = 2
+
+// DocumentSchemaInfo описание версии схемы документов архива
+type DocumentSchemaInfo struct {
+	Version     int
+	Description string
+}
+
+type documentUpgrade struct {
+	DocumentSchemaInfo
+	// Переводит документ из предыдущей версии в текущую
+	upgrade func(doc map[string]interface{})
+}
+
+// Версии схемы в порядке возрастания, начиная со второй
+var documentUpgrades = []*documentUpgrade{
+	{DocumentSchemaInfo{2, "добавлено поле schemaVersion, пустое поле sanr не записывается, rawData может отсутствовать"},
+		upgradeDocumentToVersion2},
+}
+
+func upgradeDocumentToVersion2(doc map[string]interface{}) {
+	// В версии 1 поле sanr записывалось всегда из-за ошибки в теге
+	if value, ok := doc["sanr"]; ok && value == nil {
+		delete(doc, "sanr")
+	}
+}
+
+// GetDocumentSchemaVersions возвращает описание всех версий схемы документов архива
+func GetDocumentSchemaVersions() []DocumentSchemaInfo {
+	result := []DocumentSchemaInfo{{1, "исходная схема"}}
+
+	for _, u := range documentUpgrades {
+		result = append(result, u.DocumentSchemaInfo)
+	}
+
+	return result
+}
+
+// GetDocumentKind возвращает вид документа архива для формата пакета
+func GetDocumentKind(format byte) (DocumentKind, error) {
+	switch format {
+	case core.PackageFormatData:
+		return DocumentKindMeasures, nil
+	case core.PackageFormatEvents,
+		core.PackageFormatChangeObjectStates,
+		core.PackageFormatChangeFailureStates:
+		return DocumentKindEvents, nil
+	case core.PackageFormatFullObjectStates,
+		core.PackageFormatFullFailureStates,
+		core.PackageFormatFullAccidentStates:
+		return DocumentKindFullState, nil
+	default:
+		return 0, fmt.Errorf("unknown package format %d", format)
+	}
+}
+
+func getDocumentSchemaVersion(doc map[string]interface{}) (int, error) {
+	value, ok := doc["schemaVersion"]
+	if !ok {
+		return 1, nil
+	}
+
+	version, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("incorrect schema version %v", value)
+	}
+
+	return int(version), nil
+}
+
+func upgradeDocument(doc map[string]interface{}) error {
+	version, err := getDocumentSchemaVersion(doc)
+	if err != nil {
+		return err
+	}
+
+	if version > DocumentSchemaVersion {
+		return fmt.Errorf("unsupported schema version %d", version)
+	}
+
+	for _, u := range documentUpgrades {
+		if u.Version <= version {
+			continue
+		}
+		u.upgrade(doc)
+		doc["schemaVersion"] = u.Version
+	}
+
+	return nil
+}
+
+// UpgradeDocument приводит документ архива к текущей версии схемы
+func UpgradeDocument(data []byte) ([]byte, error) {
+	var doc map[string]interface{}
+
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if err := upgradeDocument(doc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// DecodeDocument разбирает документ архива любой версии схемы в структуру текущей версии.
+// Возвращает *MeasuresDocument, *EventsDocument или *FullStateDocument в зависимости от вида документа
+func DecodeDocument(data []byte) (interface{}, error) {
+	upgraded, err := UpgradeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		Format byte `json:"format"`
+	}
+
+	if err = json.Unmarshal(upgraded, &header); err != nil {
+		return nil, err
+	}
+
+	kind, err := GetDocumentKind(header.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+
+	switch kind {
+	case DocumentKindMeasures:
+		result = &MeasuresDocument{}
+	case DocumentKindEvents:
+		result = &EventsDocument{}
+	default:
+		result = &FullStateDocument{}
+	}
+
+	if err = json.Unmarshal(upgraded, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package archive
+
+import (
+	"encoding/json"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestUpgradeDocumentFromVersion1(t *testing.T) {
+	legacy := `{"time":1000,"rawData":"AAA=","stations":[1],"deviceId":5,"format":1,` +
+		`"sds":[{"objectId":100,"stateId":2}],"sanr":null}`
+
+	upgraded, err := UpgradeDocument([]byte(legacy))
+
+	assert.Nil(t, err)
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(upgraded, &doc)
+
+	assert.Nil(t, err)
+	assert.Equal(t, float64(DocumentSchemaVersion), doc["schemaVersion"])
+	assert.NotContains(t, doc, "sanr")
+
+	decoded, err := DecodeDocument([]byte(legacy))
+
+	assert.Nil(t, err)
+
+	item := decoded.(*EventsDocument)
+	assert.Equal(t, DocumentSchemaVersion, item.SchemaVersion)
+	assert.Equal(t, int64(1000), item.Time)
+	assert.Equal(t, "AAA=", item.RawData)
+	assert.Equal(t, []StateEvent{{ObjectId: 100, StateId: 2}}, item.Sds)
+}
+
+func TestUpgradeDocumentUnsupportedVersion(t *testing.T) {
+	_, err := UpgradeDocument([]byte(`{"schemaVersion":1000,"format":0}`))
+
+	assert.NotNil(t, err)
+}
+
+func TestDecodeCurrentDocuments(t *testing.T) {
+	aTime := time.Now()
+	testPackage := &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(aTime),
+		DeviceId:      core.GetSpecialDeviceForHost(800),
+		Format:        core.PackageFormatFullObjectStates,
+		Data:          []byte{core.PackageEventTypeObjectState, 100, 0, 0, 0, 1, 0},
+		BitsPerSensor: 8,
+		DataSize:      7,
+		SensorCount:   7}
+
+	updateResult := &objectFullStateUpdateEventInfo{packageInfo: testPackage, processingTime: aTime,
+		stations: []int{30000}}
+
+	res := updateResult.getArchiveServerRequest()
+	assert.Len(t, res, 1)
+	assert.NotContains(t, res[0].item, "sanr")
+
+	decoded, err := DecodeDocument([]byte(res[0].item))
+
+	assert.Nil(t, err)
+
+	item := decoded.(*FullStateDocument)
+	assert.Equal(t, DocumentSchemaVersion, item.SchemaVersion)
+	assert.Equal(t, testPackage.DeviceId, item.DeviceId)
+
+	_, err = DecodeDocument([]byte(`{"format":100}`))
+	assert.NotNil(t, err)
+}
+
+func TestGetDocumentSchemaVersions(t *testing.T) {
+	versions := GetDocumentSchemaVersions()
+
+	assert.Len(t, versions, DocumentSchemaVersion)
+	assert.Equal(t, DocumentSchemaVersion, versions[len(versions)-1].Version)
+}
@@ -7,19 +7,33 @@ import (
 	"time"
 )
 
-type sdsEventInfo struct {
-	ObjectId uint32 `json:"objectId"`
-	StateId  uint16 `json:"stateId"`
+// StateEvent изменение состояния объекта
+type StateEvent struct {
+	ObjectId      uint32  `json:"objectId"`
+	StateId       uint16  `json:"stateId"`
+	StateName     string  `json:"stateName,omitempty"`
+	Severity      int     `json:"severity,omitempty"`
+	PrevStateId   *uint16 `json:"prevStateId,omitempty"`
+	PrevStateName string  `json:"prevStateName,omitempty"`
 }
 
-type failureEventInfo struct {
+// Описание изменения состояния объекта по словарю состояний
+type objectStateChange struct {
+	state       *ObjectStateInfo
+	prevStateId *uint16
+	prevState   *ObjectStateInfo
+}
+
+// FailureEvent начало или окончание отказа объекта
+type FailureEvent struct {
 	ObjectId    uint32 `json:"objectId"`
 	Fault       uint32 `json:"faultId"`
 	IsStarted   bool   `json:"isStarted"`
 	FailureTime int64  `json:"failureTime"`
 }
 
-type accidentEventInfo struct {
+// AccidentEvent предотказ объекта
+type AccidentEvent struct {
 	ObjectId       uint32 `json:"objectId"`
 	AlgorithmId    int32  `json:"algorithmId"`
 	AccidentTypeId byte   `json:"accidentType"`
@@ -27,7 +41,8 @@ type accidentEventInfo struct {
 	EndTime        int64  `json:"endTime,omitempty"`
 }
 
-type nwaEventInfo struct {
+// NwaEvent событие алгоритма нормальной работы
+type NwaEvent struct {
 	ObjectId    uint32 `json:"objectId"`
 	AlgorithmId uint32 `json:"algorithmId"`
 	StateId     int32  `json:"stateId"`
@@ -35,38 +50,108 @@ type nwaEventInfo struct {
 	EventTime   int64  `json:"time"`
 }
 
-type fpEventInfo struct {
+// FpEvent шаг алгоритма поиска отказа
+type FpEvent struct {
 	ObjectId    uint32 `json:"objectId"`
 	AlgorithmId uint32 `json:"algorithmId"`
 	StepIndex   int32  `json:"stepIndex"`
 	EventTime   int64  `json:"time"`
 }
 
-type nwaStateEventInfo struct {
+// NwaStateEvent состояние алгоритма нормальной работы объекта
+type NwaStateEvent struct {
 	ObjectId  uint32 `json:"objectId"`
 	StateId   int32  `json:"stateId"`
 	EventTime int64  `json:"time"`
 }
 
-type eventChangeItemInfo struct {
-	Time      int64               `json:"time"`
-	RawData   string              `json:"rawData"`
-	Stations  []int               `json:"stations"`
-	DeviceId  int32               `json:"deviceId"`
-	Format    byte                `json:"format"`
-	Sds       []sdsEventInfo      `json:"sds,omitempty"`
-	Failures  []failureEventInfo  `json:"failures,omitempty"`
-	Accidents []accidentEventInfo `json:"accidents,omitempty"`
-	Nwa       []nwaEventInfo      `json:"anr,omitempty"`
-	Fp        []fpEventInfo       `json:"ap,omitempty"`
-	NwaState  []nwaStateEventInfo `json:"sanr, omitempty"`
+// EventsDocument документ архива с событиями объектов (DocumentKindEvents)
+type EventsDocument struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Time          int64           `json:"time"`
+	Stations      []int           `json:"stations"`
+	DeviceId      int32           `json:"deviceId"`
+	Format        byte            `json:"format"`
+	Sds           []StateEvent    `json:"sds,omitempty"`
+	Failures      []FailureEvent  `json:"failures,omitempty"`
+	Accidents     []AccidentEvent `json:"accidents,omitempty"`
+	Nwa           []NwaEvent      `json:"anr,omitempty"`
+	Fp            []FpEvent       `json:"ap,omitempty"`
+	NwaState      []NwaStateEvent `json:"sanr,omitempty"`
+	rawDataFields
 }
 
 type objectChangeEventUpdateEventInfo struct {
 	processingTime time.Time
 	packageInfo    *core.DataPackage
 	events         *core.PackageEvents
+	stateChanges   map[uint32]*objectStateChange
 	stations       []int
+	rawDataPolicy  RawDataPolicy
+}
+
+func getSdsEvents(states map[uint32]uint16, stateChanges map[uint32]*objectStateChange) []StateEvent {
+	if len(states) == 0 {
+		return nil
+	}
+
+	result := make([]StateEvent, len(states))
+	i := 0
+	for k, v := range states {
+		result[i] = StateEvent{ObjectId: k, StateId: v}
+		if change, ok := stateChanges[k]; ok {
+			if change.state != nil {
+				result[i].StateName = change.state.Name
+				result[i].Severity = change.state.Severity
+			}
+			result[i].PrevStateId = change.prevStateId
+			if change.prevState != nil {
+				result[i].PrevStateName = change.prevState.Name
+			}
+		}
+		i++
+	}
+
+	return result
+}
+
+func getFailureEvents(failures map[core.ObjectFailureKey]*core.ObjectFailureEventInfo) []FailureEvent {
+	if len(failures) == 0 {
+		return nil
+	}
+
+	result := make([]FailureEvent, len(failures))
+	i := 0
+	for k, v := range failures {
+
+		result[i] = FailureEvent{ObjectId: k.ObjectId,
+			Fault:       k.FailureId,
+			IsStarted:   v.IsStarted,
+			FailureTime: core.GetUnixMillisecondsFromTime(v.EventTime)}
+		i++
+	}
+
+	return result
+}
+
+func getAccidentEvents(accidents map[core.ObjectAccidentKey]*core.ObjectAccidentEventInfo) []AccidentEvent {
+	if len(accidents) == 0 {
+		return nil
+	}
+
+	result := make([]AccidentEvent, len(accidents))
+	i := 0
+	for k, v := range accidents {
+
+		result[i] = AccidentEvent{ObjectId: k.ObjectId,
+			AlgorithmId:    k.AccidentId,
+			AccidentTypeId: v.AccidentType,
+			StartTime:      core.GetUnixMillisecondsFromTime(v.StartTime),
+			EndTime:        core.GetUnixMillisecondsFromTime(v.EndTime)}
+		i++
+	}
+
+	return result
 }
 
 func (update *objectChangeEventUpdateEventInfo) getArchiveServerRequest() []*RequestItem {
@@ -87,60 +172,27 @@ func (update *objectChangeEventUpdateEventInfo) getArchiveServerRequest() []*Req
 		return nil
 	}
 
-	item := &eventChangeItemInfo{
-		Time:     processingTime,
-		Stations: update.stations,
-		DeviceId: update.packageInfo.DeviceId,
-		Format:   update.packageInfo.Format,
-		RawData:  update.packageInfo.GetBase64String()}
-
-	sdsEvents := len(update.events.ObjectStates)
-
-	if sdsEvents > 0 {
-		item.Sds = make([]sdsEventInfo, sdsEvents)
-		i := 0
-		for k, v := range update.events.ObjectStates {
-			item.Sds[i] = sdsEventInfo{k, v}
-			i++
-		}
-	}
-
-	failureEvents := len(update.events.ObjectFailuresChangeState)
-	if failureEvents > 0 {
-		item.Failures = make([]failureEventInfo, failureEvents)
-		i := 0
-		for k, v := range update.events.ObjectFailuresChangeState {
-
-			item.Failures[i] = failureEventInfo{ObjectId: k.ObjectId,
-				Fault:       k.FailureId,
-				IsStarted:   v.IsStarted,
-				FailureTime: core.GetUnixMillisecondsFromTime(v.EventTime)}
-			i++
-		}
-	}
+	item := &EventsDocument{
+		SchemaVersion: DocumentSchemaVersion,
+		Time:          processingTime,
+		Stations:      update.stations,
+		DeviceId:      update.packageInfo.DeviceId,
+		Format:        update.packageInfo.Format}
 
-	accidentEvents := len(update.events.ObjectAccidentsChangeState)
-	if accidentEvents > 0 {
-		item.Accidents = make([]accidentEventInfo, accidentEvents)
-		i := 0
-		for k, v := range update.events.ObjectAccidentsChangeState {
+	rawData, rawDataRequest := getRawData(update.rawDataPolicy, update.packageInfo, id, processingTime)
+	item.rawDataFields = rawData
 
-			item.Accidents[i] = accidentEventInfo{ObjectId: k.ObjectId,
-				AlgorithmId:    k.AccidentId,
-				AccidentTypeId: v.AccidentType,
-				StartTime:      core.GetUnixMillisecondsFromTime(v.StartTime),
-				EndTime:        core.GetUnixMillisecondsFromTime(v.EndTime)}
-			i++
-		}
-	}
+	item.Sds = getSdsEvents(update.events.ObjectStates, update.stateChanges)
+	item.Failures = getFailureEvents(update.events.ObjectFailuresChangeState)
+	item.Accidents = getAccidentEvents(update.events.ObjectAccidentsChangeState)
 
 	nwaEvents := len(update.events.ObjectNwaChangeState)
 	if nwaEvents > 0 {
-		item.Nwa = make([]nwaEventInfo, nwaEvents)
+		item.Nwa = make([]NwaEvent, nwaEvents)
 		i := 0
 		for _, v := range update.events.ObjectNwaChangeState {
 
-			item.Nwa[i] = nwaEventInfo{ObjectId: v.ObjectId,
+			item.Nwa[i] = NwaEvent{ObjectId: v.ObjectId,
 				AlgorithmId: v.AlgorithmId,
 				StateId:     v.StateId,
 				IsStarted:   v.IsStarted,
@@ -151,11 +203,11 @@ func (update *objectChangeEventUpdateEventInfo) getArchiveServerRequest() []*Req
 
 	fpEvents := len(update.events.ObjectFpChangeState)
 	if fpEvents > 0 {
-		item.Fp = make([]fpEventInfo, fpEvents)
+		item.Fp = make([]FpEvent, fpEvents)
 		i := 0
 		for _, v := range update.events.ObjectFpChangeState {
 
-			item.Fp[i] = fpEventInfo{ObjectId: v.ObjectId,
+			item.Fp[i] = FpEvent{ObjectId: v.ObjectId,
 				AlgorithmId: v.AlgorithmId,
 				StepIndex:   v.StepIndex,
 				EventTime:   core.GetUnixMillisecondsFromTime(v.EventTime)}
@@ -165,11 +217,11 @@ func (update *objectChangeEventUpdateEventInfo) getArchiveServerRequest() []*Req
 
 	nwaStateEvents := len(update.events.ObjectNwaStateLeaveEnter)
 	if nwaStateEvents > 0 {
-		item.NwaState = make([]nwaStateEventInfo, nwaStateEvents)
+		item.NwaState = make([]NwaStateEvent, nwaStateEvents)
 		i := 0
 		for _, v := range update.events.ObjectNwaStateLeaveEnter {
 
-			item.NwaState[i] = nwaStateEventInfo{ObjectId: v.ObjectId,
+			item.NwaState[i] = NwaStateEvent{ObjectId: v.ObjectId,
 				StateId:   v.NwaStateId,
 				EventTime: core.GetUnixMillisecondsFromTime(v.EventTime)}
 			i++
@@ -181,5 +233,10 @@ func (update *objectChangeEventUpdateEventInfo) getArchiveServerRequest() []*Req
 		return nil
 	}
 
-	return []*RequestItem{{string(buf), string(itemBuf)}}
+	result := []*RequestItem{{string(buf), string(itemBuf)}}
+	if rawDataRequest != nil {
+		result = append(result, rawDataRequest)
+	}
+
+	return result
 }
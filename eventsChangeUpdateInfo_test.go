@@ -48,7 +48,7 @@ func TestEventsServerRequest(t *testing.T) {
 
 	item := res[0]
 
-	var eventInfo eventChangeItemInfo
+	var eventInfo EventsDocument
 	err = json.Unmarshal([]byte(item.item), &eventInfo)
 
 	assert.Nil(t, err)
@@ -61,7 +61,7 @@ func TestEventsServerRequest(t *testing.T) {
 	expectedEventTime := core.GetUnixMillisecondsFromTime(aTime)
 	assert.Equal(t, expectedEventTime, eventInfo.Time)
 
-	assert.ElementsMatch(t, []sdsEventInfo{
+	assert.ElementsMatch(t, []StateEvent{
 		{ObjectId: objectId2, StateId: uint16(objectState2)},
 		{ObjectId: objectId1, StateId: uint16(objectState1)},
 	}, eventInfo.Sds)
@@ -135,7 +135,7 @@ func TestAccidentEventsServerRequest(t *testing.T) {
 
 	item := res[0]
 
-	var eventInfo eventChangeItemInfo
+	var eventInfo EventsDocument
 	err = json.Unmarshal([]byte(item.item), &eventInfo)
 
 	assert.Nil(t, err)
@@ -148,7 +148,7 @@ func TestAccidentEventsServerRequest(t *testing.T) {
 	expectedEventTime := core.GetUnixMillisecondsFromTime(aTime)
 	assert.Equal(t, expectedEventTime, eventInfo.Time)
 
-	assert.ElementsMatch(t, []accidentEventInfo{
+	assert.ElementsMatch(t, []AccidentEvent{
 		{ObjectId: objectId1,
 			StartTime:      expectedEventTime,
 			EndTime:        expectedEventTime,
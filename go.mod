@@ -4,7 +4,12 @@ go 1.13
 
 require (
 	github.com/deckarep/golang-set v1.8.0
+	github.com/fraugster/parquet-go v0.11.0
 	github.com/imsat-spb/go-apkdk-configuration v1.2.2
 	github.com/imsat-spb/go-apkdk-core v1.2.1
+	github.com/mochi-co/mqtt v1.0.0
+	github.com/prometheus/client_golang v1.12.2
 	github.com/stretchr/testify v1.8.0
+	google.golang.org/grpc v1.40.1
+	google.golang.org/protobuf v1.27.1
 )
@@ -0,0 +1,39 @@
+package archive
+
+import (
+	"github.com/imsat-spb/go-apkdk-core"
+	"time"
+)
+
+// getTestDataPackage пакет измерений устройства 5, value содержит значение датчика 1
+func getTestDataPackage(now time.Time, value []byte) *core.DataPackage {
+	return &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(now),
+		DeviceId:      5,
+		Format:        core.PackageFormatData,
+		Data:          append([]byte{0, 0, 0, 0}, value...),
+		BitsPerSensor: 32,
+		DataSize:      8,
+		SensorCount:   2}
+}
+
+// getTestConfigurationInfo датчик 1 устройства 5 привязан к измерению 7 объекта 100 (станция 30000)
+// и атрибуту 8 объекта 200 (станция 33000)
+func getTestConfigurationInfo() *ConfigurationInfo {
+	return &ConfigurationInfo{
+		Objects: map[int]*ObjectInfo{
+			100: {objectId: 100, stationId: 30000, hostId: 800},
+			200: {objectId: 200, stationId: 33000, hostId: 800},
+		},
+		mappings: map[int]map[int][]*archiveMeasureOrAttributeInfo{
+			5: {1: []*archiveMeasureOrAttributeInfo{
+				{objectId: 100, measureOrAttributeId: 7, stationId: 30000, unitOfMeasure: "В"},
+				{objectId: 200, measureOrAttributeId: 8, stationId: 33000, isAttribute: true},
+			}},
+		},
+	}
+}
+
+func getTestRuntimeConfiguration(opts ...RuntimeOption) *RuntimeConfiguration {
+	return NewRuntimeConfiguration(getTestConfigurationInfo(), opts...)
+}
@@ -0,0 +1,179 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// InfluxNaNPolicy определяет запись неопределенных значений, которые не поддерживаются InfluxDB
+type InfluxNaNPolicy int
+
+const (
+	// Неопределенные значения не записываются
+	InfluxNaNSkip InfluxNaNPolicy = iota
+	// Вместо значения записывается поле undefined=true
+	InfluxNaNFlag
+)
+
+// InfluxOption задает параметры InfluxEncoder
+type InfluxOption func(encoder *InfluxEncoder)
+
+// WithInfluxNaNPolicy задает запись неопределенных значений. По умолчанию они не записываются
+func WithInfluxNaNPolicy(policy InfluxNaNPolicy) InfluxOption {
+	return func(encoder *InfluxEncoder) {
+		encoder.nanPolicy = policy
+	}
+}
+
+// InfluxEncoder преобразует измененные значения в строки line protocol InfluxDB.
+// Для каждого измерения или атрибута используется отдельный measurement (measure_<id> или attribute_<id>),
+// объект, тип объекта, станция и единица измерения записываются тегами. Время записывается в наносекундах
+type InfluxEncoder struct {
+	nanPolicy InfluxNaNPolicy
+}
+
+// NewInfluxEncoder создает преобразователь в line protocol
+func NewInfluxEncoder(opts ...InfluxOption) *InfluxEncoder {
+	result := &InfluxEncoder{}
+
+	for _, opt := range opts {
+		opt(result)
+	}
+
+	return result
+}
+
+var influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func writeInfluxTag(builder *strings.Builder, key string, value string) {
+	if value == "" {
+		return
+	}
+
+	builder.WriteByte(',')
+	builder.WriteString(key)
+	builder.WriteByte('=')
+	builder.WriteString(influxTagEscaper.Replace(value))
+}
+
+// AppendRecord добавляет в buf строку для значения. Возвращает buf без изменений,
+// если значение не определено и такие значения не записываются
+func (encoder *InfluxEncoder) AppendRecord(buf []byte, record *MeasureRecord) []byte {
+	isNaN := core.IsNaN(record.Value)
+	if isNaN && encoder.nanPolicy == InfluxNaNSkip {
+		return buf
+	}
+
+	var builder strings.Builder
+
+	kind := dictionaryKindMeasure
+	if record.IsAttribute {
+		kind = dictionaryKindAttribute
+	}
+	builder.WriteString(influxMeasurementEscaper.Replace(fmt.Sprintf("%s_%d", kind, record.MeasureId)))
+
+	// Теги записываются в порядке сортировки ключей, как рекомендует InfluxDB
+	writeInfluxTag(&builder, "name", record.MeasureName)
+	writeInfluxTag(&builder, "object", strconv.Itoa(record.ObjectId))
+	writeInfluxTag(&builder, "objectName", record.ObjectName)
+	if record.ObjectTypeId != 0 {
+		writeInfluxTag(&builder, "objectType", strconv.Itoa(record.ObjectTypeId))
+	}
+	writeInfluxTag(&builder, "objectTypeName", record.ObjectTypeName)
+	if record.StationId != 0 {
+		writeInfluxTag(&builder, "station", strconv.Itoa(record.StationId))
+	}
+	writeInfluxTag(&builder, "stationName", record.StationName)
+	writeInfluxTag(&builder, "unit", record.Unit)
+
+	if isNaN {
+		builder.WriteString(" undefined=true ")
+	} else {
+		builder.WriteString(" value=")
+		builder.WriteString(strconv.FormatFloat(float64(record.Value), 'f', -1, 32))
+		builder.WriteByte(' ')
+	}
+
+	builder.WriteString(strconv.FormatInt(record.Time.UnixNano(), 10))
+	builder.WriteByte('\n')
+
+	return append(buf, builder.String()...)
+}
+
+// Encode возвращает строки line protocol для всех значений обновления
+func (encoder *InfluxEncoder) Encode(update *MeasureUpdate) []byte {
+	var result []byte
+
+	for _, record := range update.Records {
+		result = encoder.AppendRecord(result, record)
+	}
+
+	return result
+}
+
+// InfluxSink записывает строки line protocol через HTTP API InfluxDB 2.x (/api/v2/write)
+type InfluxSink struct {
+	writeUrl   string
+	token      string
+	httpClient *http.Client
+}
+
+// NewInfluxSink создает получателя для сервера baseUrl (например http://localhost:8086), организации и корзины.
+// Если token пустой, запрос отправляется без авторизации. Если httpClient не задан, используется http.DefaultClient
+func NewInfluxSink(baseUrl string, org string, bucket string, token string, httpClient *http.Client) *InfluxSink {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	query := url.Values{}
+	query.Set("org", org)
+	query.Set("bucket", bucket)
+	query.Set("precision", "ns")
+
+	return &InfluxSink{
+		writeUrl:   strings.TrimRight(baseUrl, "/") + "/api/v2/write?" + query.Encode(),
+		token:      token,
+		httpClient: httpClient}
+}
+
+// Write отправляет строки line protocol
+func (sink *InfluxSink) Write(ctx context.Context, lines []byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	request, err := http.NewRequest(http.MethodPost, sink.writeUrl, bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if sink.token != "" {
+		request.Header.Set("Authorization", "Token "+sink.token)
+	}
+
+	response, err := sink.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("influx write failed with status %d: %s", response.StatusCode, string(responseBody))
+	}
+
+	return nil
+}
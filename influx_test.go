@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"context"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInfluxEncoderFromRuntime(t *testing.T) {
+	var updates []*MeasureUpdate
+
+	info := getTestRuntimeConfiguration(WithMeasureListener(func(update *MeasureUpdate) {
+		updates = append(updates, update)
+	}))
+
+	packageTime := time.Unix(1000, 123456000)
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(packageTime, []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	// Значение не изменилось, получатель не вызывается
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(packageTime.Add(time.Second), []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	assert.Len(t, updates, 1)
+	assert.Equal(t, packageTime, updates[0].Time)
+	assert.Equal(t, int32(5), updates[0].DeviceId)
+
+	lines := NewInfluxEncoder().Encode(updates[0])
+
+	assert.Equal(t, "measure_7,object=100,station=30000,unit=В value=1 1000123456000\n"+
+		"attribute_8,object=200,station=33000 value=1 1000123456000\n", string(lines))
+}
+
+func TestInfluxEncoderEscapingAndNaN(t *testing.T) {
+	record := &MeasureRecord{
+		Time:           time.Unix(1, 0),
+		ObjectId:       100,
+		ObjectName:     "Стрелка 1,2",
+		ObjectTypeId:   3,
+		ObjectTypeName: "Стрелка",
+		MeasureId:      7,
+		MeasureName:    "U=фаза A",
+		Unit:           "В",
+		StationId:      30000,
+		StationName:    "Станция",
+		Value:          core.GetNaN()}
+
+	assert.Empty(t, NewInfluxEncoder().AppendRecord(nil, record))
+
+	lines := NewInfluxEncoder(WithInfluxNaNPolicy(InfluxNaNFlag)).AppendRecord(nil, record)
+	assert.Equal(t, `measure_7,name=U\=фаза\ A,object=100,objectName=Стрелка\ 1\,2,objectType=3,objectTypeName=Стрелка,`+
+		`station=30000,stationName=Станция,unit=В undefined=true 1000000000`+"\n", string(lines))
+
+	record.Value = -0.25
+	lines = NewInfluxEncoder(WithInfluxNaNPolicy(InfluxNaNFlag)).AppendRecord([]byte("x\n"), record)
+	assert.Contains(t, string(lines), "x\nmeasure_7,")
+	assert.Contains(t, string(lines), " value=-0.25 1000000000\n")
+}
+
+func TestInfluxSink_Write(t *testing.T) {
+	var request *http.Request
+	var body string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		buf, _ := ioutil.ReadAll(r.Body)
+		body = string(buf)
+
+		if r.URL.Query().Get("bucket") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":"not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxSink(server.URL+"/", "apkdk", "measures", "secret", server.Client())
+
+	assert.Nil(t, sink.Write(context.Background(), []byte("measure_7,object=100 value=1 1\n")))
+	assert.Equal(t, "/api/v2/write", request.URL.Path)
+	assert.Equal(t, "apkdk", request.URL.Query().Get("org"))
+	assert.Equal(t, "ns", request.URL.Query().Get("precision"))
+	assert.Equal(t, "Token secret", request.Header.Get("Authorization"))
+	assert.Equal(t, "measure_7,object=100 value=1 1\n", body)
+
+	request = nil
+	assert.Nil(t, sink.Write(context.Background(), nil))
+	assert.Nil(t, request)
+
+	sink = NewInfluxSink(server.URL, "apkdk", "missing", "", nil)
+	assert.NotNil(t, sink.Write(context.Background(), []byte("measure_7,object=100 value=1 1\n")))
+	assert.Empty(t, request.Header.Get("Authorization"))
+}
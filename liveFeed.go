@@ -0,0 +1,534 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DocumentListener получает документы архива, сформированные по каждому пакету
+type DocumentListener func(items []*RequestItem)
+
+// WithDocumentListener добавляет получателя документов. Получатель вызывается в потоке
+// GetUpdateRequestItemsFromPackage и не должен надолго его задерживать
+func WithDocumentListener(listener DocumentListener) RuntimeOption {
+	return func(runtimeConfig *RuntimeConfiguration) {
+		runtimeConfig.documentListeners = append(runtimeConfig.documentListeners, listener)
+	}
+}
+
+func (runtimeConfig *RuntimeConfiguration) notifyDocumentListeners(items []*RequestItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	for _, listener := range runtimeConfig.documentListeners {
+		listener(items)
+	}
+}
+
+// Виды документов в ленте изменений, передаются как тип события SSE
+const (
+	LiveFeedKindMeasures  = "measures"
+	LiveFeedKindEvents    = "events"
+	LiveFeedKindFullState = "fullState"
+	LiveFeedKindRollup    = "rollup"
+	LiveFeedKindGap       = "gap"
+)
+
+var liveFeedKinds = map[string]bool{
+	LiveFeedKindMeasures:  true,
+	LiveFeedKindEvents:    true,
+	LiveFeedKindFullState: true,
+	LiveFeedKindRollup:    true,
+	LiveFeedKindGap:       true}
+
+// Списки документа, элементы которых относятся к объектам
+var liveFeedObjectLists = []string{"measures", "attributes", "sds", "failures", "accidents", "anr", "ap", "sanr"}
+
+// LiveFeedDropPolicy определяет поведение при переполнении буфера клиента
+type LiveFeedDropPolicy int
+
+const (
+	// Отбрасываются самые старые документы буфера
+	LiveFeedDropOldest LiveFeedDropPolicy = iota
+	// Отбрасываются новые документы
+	LiveFeedDropNewest
+	// Клиент отключается
+	LiveFeedDisconnect
+)
+
+const (
+	defaultLiveFeedBufferSize = 256
+	defaultLiveFeedKeepAlive  = 30 * time.Second
+)
+
+// LiveFeedOption задает параметры LiveFeed
+type LiveFeedOption func(feed *LiveFeed)
+
+// WithLiveFeedBufferSize задает количество документов в буфере каждого клиента. По умолчанию 256
+func WithLiveFeedBufferSize(size int) LiveFeedOption {
+	return func(feed *LiveFeed) {
+		feed.bufferSize = size
+	}
+}
+
+// WithLiveFeedDropPolicy задает поведение при переполнении буфера клиента. По умолчанию отбрасываются старые документы
+func WithLiveFeedDropPolicy(policy LiveFeedDropPolicy) LiveFeedOption {
+	return func(feed *LiveFeed) {
+		feed.dropPolicy = policy
+	}
+}
+
+// WithLiveFeedKeepAlive задает интервал отправки комментария для поддержания соединения. По умолчанию 30 секунд.
+// Неположительный интервал игнорируется
+func WithLiveFeedKeepAlive(interval time.Duration) LiveFeedOption {
+	return func(feed *LiveFeed) {
+		if interval > 0 {
+			feed.keepAlive = interval
+		}
+	}
+}
+
+// LiveFeedDocument документ архива, подготовленный для отбора подписчикам
+type LiveFeedDocument struct {
+	index string
+	id    string
+	kind  string
+	item  string
+	doc   map[string]interface{}
+}
+
+// Index возвращает индекс архива документа
+func (document *LiveFeedDocument) Index() string {
+	return document.index
+}
+
+// Id возвращает идентификатор документа
+func (document *LiveFeedDocument) Id() string {
+	return document.id
+}
+
+// Kind возвращает вид документа, например LiveFeedKindMeasures
+func (document *LiveFeedDocument) Kind() string {
+	return document.kind
+}
+
+type liveFeedMessage struct {
+	id   string
+	kind string
+	data []byte
+}
+
+// LiveFeedFilter отбор документов и значений для подписчика
+type LiveFeedFilter struct {
+	stations   map[int]bool
+	objects    map[int]bool
+	measures   map[int]bool
+	attributes map[int]bool
+	kinds      map[string]bool
+}
+
+// NewLiveFeedFilter создает отбор по станциям и объектам. Пустой список не ограничивает отбор
+func NewLiveFeedFilter(stationIds []int, objectIds []int) *LiveFeedFilter {
+	return &LiveFeedFilter{
+		stations: addFilterIds(nil, stationIds),
+		objects:  addFilterIds(nil, objectIds)}
+}
+
+type liveFeedClient struct {
+	filter   *LiveFeedFilter
+	messages chan *liveFeedMessage
+	// Закрывается при отключении клиента из-за переполнения буфера
+	closed  chan struct{}
+	dropped int
+}
+
+// LiveFeed передает документы архива подписчикам через Server-Sent Events по мере их формирования.
+// Параметры запроса station, object, measure, attribute и kind (через запятую или повторением) отбирают документы.
+// Отбор по объекту, измерению и атрибуту оставляет в документе только подходящие элементы.
+// Для медленного клиента документы копятся в буфере, при переполнении применяется LiveFeedDropPolicy,
+// а количество отброшенных документов передается событием dropped
+type LiveFeed struct {
+	lock       sync.Mutex
+	clients    map[*liveFeedClient]bool
+	bufferSize int
+	dropPolicy LiveFeedDropPolicy
+	keepAlive  time.Duration
+}
+
+// NewLiveFeed создает ленту изменений. Документы передаются в ленту через Listener или Publish
+func NewLiveFeed(opts ...LiveFeedOption) *LiveFeed {
+	result := &LiveFeed{
+		clients:    make(map[*liveFeedClient]bool),
+		bufferSize: defaultLiveFeedBufferSize,
+		keepAlive:  defaultLiveFeedKeepAlive}
+
+	for _, opt := range opts {
+		opt(result)
+	}
+
+	return result
+}
+
+// Listener возвращает получателя для WithDocumentListener
+func (feed *LiveFeed) Listener() DocumentListener {
+	return feed.Publish
+}
+
+func getLiveFeedIds(query url.Values, name string) (map[int]bool, error) {
+	var result map[int]bool
+
+	for _, value := range query[name] {
+		for _, s := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("incorrect %s %q", name, s)
+			}
+			result = addFilterIds(result, []int{id})
+		}
+	}
+
+	return result, nil
+}
+
+func getLiveFeedFilter(query url.Values) (*LiveFeedFilter, error) {
+	result := &LiveFeedFilter{}
+
+	var err error
+	if result.stations, err = getLiveFeedIds(query, "station"); err != nil {
+		return nil, err
+	}
+	if result.objects, err = getLiveFeedIds(query, "object"); err != nil {
+		return nil, err
+	}
+	if result.measures, err = getLiveFeedIds(query, "measure"); err != nil {
+		return nil, err
+	}
+	if result.attributes, err = getLiveFeedIds(query, "attribute"); err != nil {
+		return nil, err
+	}
+
+	for _, value := range query["kind"] {
+		for _, kind := range strings.Split(value, ",") {
+			kind = strings.TrimSpace(kind)
+			if !liveFeedKinds[kind] {
+				return nil, fmt.Errorf("unknown document kind %q", kind)
+			}
+			if result.kinds == nil {
+				result.kinds = make(map[string]bool)
+			}
+			result.kinds[kind] = true
+		}
+	}
+
+	return result, nil
+}
+
+func getLiveFeedInt(value interface{}) (int, bool) {
+	number, ok := value.(float64)
+	return int(number), ok
+}
+
+func (filter *LiveFeedFilter) isElementAllowed(list string, element interface{}) bool {
+	fields, ok := element.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	if len(filter.objects) != 0 {
+		if objectId, ok := getLiveFeedInt(fields["objectId"]); !ok || !filter.objects[objectId] {
+			return false
+		}
+	}
+
+	// При отборе по измерениям или атрибутам остаются только они
+	if len(filter.measures) != 0 || len(filter.attributes) != 0 {
+		switch list {
+		case "measures":
+			id, _ := getLiveFeedInt(fields["measureId"])
+			return filter.measures[id]
+		case "attributes":
+			id, _ := getLiveFeedInt(fields["attributeId"])
+			return filter.attributes[id]
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsRecordAllowed проверяет, подходит ли значение измерения или атрибута под отбор по станциям и объектам
+func (filter *LiveFeedFilter) IsRecordAllowed(record *MeasureRecord) bool {
+	return (len(filter.stations) == 0 || filter.stations[record.StationId]) &&
+		(len(filter.objects) == 0 || filter.objects[record.ObjectId])
+}
+
+// Apply возвращает содержимое документа для подписчика или nil, если документ не подходит
+func (filter *LiveFeedFilter) Apply(document *LiveFeedDocument) []byte {
+	if len(filter.kinds) != 0 && !filter.kinds[document.kind] {
+		return nil
+	}
+
+	doc := document.doc
+
+	if len(filter.stations) != 0 {
+		found := false
+		stations, _ := doc["stations"].([]interface{})
+		for _, station := range stations {
+			if stationId, ok := getLiveFeedInt(station); ok && filter.stations[stationId] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	if len(filter.objects) == 0 && len(filter.measures) == 0 && len(filter.attributes) == 0 {
+		return []byte(document.item)
+	}
+
+	// Агрегаты и пропуски относятся к одному объекту и измерению
+	if _, ok := doc["objectId"]; ok {
+		list := "measures"
+		if _, ok := doc["attributeId"]; ok {
+			list = "attributes"
+		}
+		if !filter.isElementAllowed(list, doc) {
+			return nil
+		}
+		return []byte(document.item)
+	}
+
+	result := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		result[key] = value
+	}
+
+	found := false
+	for _, list := range liveFeedObjectLists {
+		elements, ok := doc[list].([]interface{})
+		if !ok {
+			continue
+		}
+
+		var allowed []interface{}
+		for _, element := range elements {
+			if filter.isElementAllowed(list, element) {
+				allowed = append(allowed, element)
+			}
+		}
+
+		if len(allowed) == 0 {
+			delete(result, list)
+			continue
+		}
+
+		result[list] = allowed
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// GetLiveFeedDocument разбирает документ архива. Для запросов без документа и исходных пакетов возвращает nil
+func GetLiveFeedDocument(item *RequestItem) (*LiveFeedDocument, error) {
+	var rq map[string]*createRequest
+	if err := json.Unmarshal([]byte(item.request), &rq); err != nil {
+		return nil, err
+	}
+
+	action := getRequestAction(rq)
+	if action == nil {
+		return nil, nil
+	}
+
+	result := &LiveFeedDocument{index: action.Index, id: action.Id, item: item.item}
+	if err := json.Unmarshal([]byte(item.item), &result.doc); err != nil {
+		return nil, err
+	}
+
+	switch action.Index {
+	case defaultArchiveIndex:
+		format, _ := getLiveFeedInt(result.doc["format"])
+		kind, err := GetDocumentKind(byte(format))
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case DocumentKindMeasures:
+			result.kind = LiveFeedKindMeasures
+		case DocumentKindEvents:
+			result.kind = LiveFeedKindEvents
+		default:
+			result.kind = LiveFeedKindFullState
+		}
+	case rollupIndex:
+		result.kind = LiveFeedKindRollup
+	case gapIndex:
+		result.kind = LiveFeedKindGap
+	default:
+		// Исходные пакеты в ленту не передаются
+		return nil, nil
+	}
+
+	return result, nil
+}
+
+func (feed *LiveFeed) enqueue(client *liveFeedClient, message *liveFeedMessage) {
+	select {
+	case client.messages <- message:
+		return
+	default:
+	}
+
+	client.dropped++
+
+	switch feed.dropPolicy {
+	case LiveFeedDropOldest:
+		select {
+		case <-client.messages:
+		default:
+		}
+		select {
+		case client.messages <- message:
+		default:
+		}
+	case LiveFeedDisconnect:
+		delete(feed.clients, client)
+		close(client.closed)
+	}
+}
+
+// Publish передает документы подписчикам. Вызов не блокируется медленными клиентами.
+// Без подписчиков документы не разбираются
+func (feed *LiveFeed) Publish(items []*RequestItem) {
+	feed.lock.Lock()
+	hasClients := len(feed.clients) > 0
+	feed.lock.Unlock()
+
+	if !hasClients {
+		return
+	}
+
+	var documents []*LiveFeedDocument
+
+	for _, item := range items {
+		document, err := GetLiveFeedDocument(item)
+		if err != nil || document == nil {
+			continue
+		}
+		documents = append(documents, document)
+	}
+
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+
+	for client := range feed.clients {
+		for _, document := range documents {
+			// Отключенный клиент удален из списка
+			if !feed.clients[client] {
+				break
+			}
+
+			if data := client.filter.Apply(document); data != nil {
+				feed.enqueue(client, &liveFeedMessage{id: document.id, kind: document.kind, data: data})
+			}
+		}
+	}
+}
+
+func (feed *LiveFeed) subscribe(filter *LiveFeedFilter) *liveFeedClient {
+	client := &liveFeedClient{
+		filter:   filter,
+		messages: make(chan *liveFeedMessage, feed.bufferSize),
+		closed:   make(chan struct{})}
+
+	feed.lock.Lock()
+	feed.clients[client] = true
+	feed.lock.Unlock()
+
+	return client
+}
+
+func (feed *LiveFeed) unsubscribe(client *liveFeedClient) {
+	feed.lock.Lock()
+	delete(feed.clients, client)
+	feed.lock.Unlock()
+}
+
+func (feed *LiveFeed) takeDropped(client *liveFeedClient) int {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+
+	result := client.dropped
+	client.dropped = 0
+	return result
+}
+
+// ServeHTTP передает документы клиенту, пока он не отключится
+func (feed *LiveFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := getLiveFeedFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := feed.subscribe(filter)
+	defer feed.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(feed.keepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.closed:
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case message := <-client.messages:
+			if dropped := feed.takeDropped(client); dropped != 0 {
+				_, err = fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", dropped)
+			}
+			if err == nil {
+				_, err = fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", message.kind, message.id, message.data)
+			}
+		}
+
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
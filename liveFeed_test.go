@@ -0,0 +1,248 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getLiveFeedTestMessages(client *liveFeedClient) []*liveFeedMessage {
+	var result []*liveFeedMessage
+	for {
+		select {
+		case message := <-client.messages:
+			result = append(result, message)
+		default:
+			return result
+		}
+	}
+}
+
+func getLiveFeedTestItems(t *testing.T) []*RequestItem {
+	var result []*RequestItem
+
+	info := getTestRuntimeConfiguration(WithRollups(RollupMinute), WithDocumentListener(func(items []*RequestItem) {
+		result = append(result, items...)
+	}))
+
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(1000, 0), []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(1070, 0), []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	result = append(result, getTestEventRequestItem("7_8_2000", `{"time":2000,"stations":[33000],"deviceId":7,"format":8,`+
+		`"sds":[{"objectId":200,"stateId":2}],"failures":[{"objectId":201,"faultId":1,"isStarted":true,"failureTime":2000}]}`))
+
+	// Два документа измерений, два агрегата за минуту и документ событий
+	assert.Len(t, result, 5)
+
+	return result
+}
+
+func TestLiveFeedFilter(t *testing.T) {
+	items := getLiveFeedTestItems(t)
+
+	var documents []*LiveFeedDocument
+	for _, item := range items {
+		document, err := GetLiveFeedDocument(item)
+		assert.Nil(t, err)
+		documents = append(documents, document)
+	}
+
+	assert.Equal(t, LiveFeedKindMeasures, documents[0].kind)
+	assert.Equal(t, "5_0_1000000", documents[0].id)
+	assert.Equal(t, LiveFeedKindRollup, documents[2].kind)
+	assert.Equal(t, LiveFeedKindEvents, documents[4].kind)
+
+	apply := func(query string) []string {
+		values, err := url.ParseQuery(query)
+		assert.Nil(t, err)
+		filter, err := getLiveFeedFilter(values)
+		assert.Nil(t, err)
+
+		var result []string
+		for _, document := range documents {
+			if data := filter.Apply(document); data != nil {
+				result = append(result, string(data))
+			}
+		}
+		return result
+	}
+
+	assert.Len(t, apply(""), 5)
+	assert.Equal(t, []string{items[0].item, items[1].item}, apply("kind=measures"))
+	assert.Len(t, apply("kind=measures,rollup"), 4)
+	assert.Len(t, apply("station=33000"), 4)
+	assert.Equal(t, []string{items[0].item, items[1].item, items[2].item}, apply("station=30000"))
+
+	// Отбор по объекту оставляет в документе только элементы объекта
+	result := apply("object=200")
+	assert.Len(t, result, 4)
+
+	var doc MeasuresDocument
+	assert.Nil(t, json.Unmarshal([]byte(result[0]), &doc))
+	assert.Empty(t, doc.Measures)
+	assert.Len(t, doc.Attributes, 1)
+	assert.Equal(t, 200, doc.Attributes[0].ObjectId)
+	assert.Equal(t, items[3].item, result[2])
+
+	var events EventsDocument
+	assert.Nil(t, json.Unmarshal([]byte(result[3]), &events))
+	assert.Len(t, events.Sds, 1)
+	assert.Empty(t, events.Failures)
+
+	result = apply("measure=7")
+	assert.Len(t, result, 3)
+
+	var measuresDoc MeasuresDocument
+	assert.Nil(t, json.Unmarshal([]byte(result[0]), &measuresDoc))
+	assert.Len(t, measuresDoc.Measures, 1)
+	assert.Empty(t, measuresDoc.Attributes)
+
+	assert.Empty(t, apply("measure=7&object=200"))
+	assert.Len(t, apply("attribute=8&object=200"), 3)
+
+	_, err := getLiveFeedFilter(url.Values{"station": {"1,x"}})
+	assert.NotNil(t, err)
+	_, err = getLiveFeedFilter(url.Values{"kind": {"raw"}})
+	assert.NotNil(t, err)
+}
+
+func TestLiveFeedDropPolicy(t *testing.T) {
+	items := getLiveFeedTestItems(t)
+
+	feed := NewLiveFeed(WithLiveFeedBufferSize(2))
+	client := feed.subscribe(&LiveFeedFilter{})
+	feed.Publish(items[:3])
+
+	messages := getLiveFeedTestMessages(client)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, items[1].item, string(messages[0].data))
+	assert.Equal(t, 1, feed.takeDropped(client))
+	assert.Equal(t, 0, feed.takeDropped(client))
+
+	feed = NewLiveFeed(WithLiveFeedBufferSize(2), WithLiveFeedDropPolicy(LiveFeedDropNewest))
+	client = feed.subscribe(&LiveFeedFilter{})
+	feed.Publish(items)
+
+	messages = getLiveFeedTestMessages(client)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, items[0].item, string(messages[0].data))
+	assert.Equal(t, 3, feed.takeDropped(client))
+
+	feed = NewLiveFeed(WithLiveFeedBufferSize(2), WithLiveFeedDropPolicy(LiveFeedDisconnect))
+	client = feed.subscribe(&LiveFeedFilter{})
+	other := feed.subscribe(&LiveFeedFilter{kinds: map[string]bool{LiveFeedKindEvents: true}})
+	feed.Publish(items)
+
+	select {
+	case <-client.closed:
+	default:
+		assert.Fail(t, "client should be disconnected")
+	}
+	assert.Len(t, feed.clients, 1)
+	assert.Len(t, getLiveFeedTestMessages(other), 1)
+}
+
+func TestLiveFeedGaps(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithGapDetection(2 * time.Minute))
+
+	start := time.Unix(1000, 0)
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start, []byte{1, 0, 0, 0}))
+	assert.Nil(t, err)
+	items, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(5*time.Minute), []byte{2, 0, 0, 0}))
+	assert.Nil(t, err)
+
+	// Пропуски записываются действием index и передаются в ленту
+	feed := NewLiveFeed()
+	client := feed.subscribe(&LiveFeedFilter{kinds: map[string]bool{LiveFeedKindGap: true}})
+	feed.Publish(items)
+
+	messages := getLiveFeedTestMessages(client)
+	assert.Len(t, messages, 1)
+
+	var gap gapItemInfo
+	assert.Nil(t, json.Unmarshal(messages[0].data, &gap))
+	assert.Equal(t, "noData", gap.Kind)
+	assert.Equal(t, int64(1000000), gap.Time)
+}
+
+func TestLiveFeedKeepAlive(t *testing.T) {
+	assert.Equal(t, time.Second, NewLiveFeed(WithLiveFeedKeepAlive(time.Second)).keepAlive)
+	assert.Equal(t, defaultLiveFeedKeepAlive, NewLiveFeed(WithLiveFeedKeepAlive(0)).keepAlive)
+	assert.Equal(t, defaultLiveFeedKeepAlive, NewLiveFeed(WithLiveFeedKeepAlive(-time.Second)).keepAlive)
+}
+
+func TestLiveFeedNoClients(t *testing.T) {
+	feed := NewLiveFeed()
+
+	// Без подписчиков документы не разбираются, ошибочный документ не проверяется
+	feed.Publish([]*RequestItem{{request: "{", item: "{"}})
+
+	client := feed.subscribe(&LiveFeedFilter{})
+	feed.Publish(getLiveFeedTestItems(t)[:1])
+	assert.Len(t, getLiveFeedTestMessages(client), 1)
+}
+
+func TestLiveFeedServeHTTP(t *testing.T) {
+	feed := NewLiveFeed()
+
+	server := httptest.NewServer(feed)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/?bad=1&station=x")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	response.Body.Close()
+
+	response, err = http.Get(server.URL + "/?object=100&kind=measures")
+	assert.Nil(t, err)
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	// Клиент подписан до отправки заголовков ответа
+	info := getTestRuntimeConfiguration(WithDocumentListener(feed.Listener()))
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(1000, 0), []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	reader := bufio.NewReader(response.Body)
+
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		assert.Nil(t, err)
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+
+	assert.Equal(t, "event: measures", lines[0])
+	assert.Equal(t, "id: 5_0_1000000", lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "data: {"))
+
+	var doc MeasuresDocument
+	assert.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &doc))
+	assert.Len(t, doc.Measures, 1)
+	assert.Empty(t, doc.Attributes)
+
+	response.Body.Close()
+
+	// После отключения клиент удаляется из ленты
+	count := 0
+	for i := 0; i < 100; i++ {
+		feed.lock.Lock()
+		count = len(feed.clients)
+		feed.lock.Unlock()
+		if count == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"sort"
+	"time"
+)
+
+// MeasureUpdate измененные значения измерений и атрибутов из пакета данных устройства
+type MeasureUpdate struct {
+	// Время пакета с точностью до микросекунд
+	Time     time.Time
+	DeviceId int32
+	Records  []*MeasureRecord
+}
+
+// MeasureListener получает измененные значения после обработки каждого пакета данных
+type MeasureListener func(update *MeasureUpdate)
+
+// WithMeasureListener добавляет получателя измененных значений. Получатель вызывается в потоке
+// GetUpdateRequestItemsFromPackage и не должен надолго его задерживать
+func WithMeasureListener(listener MeasureListener) RuntimeOption {
+	return func(runtimeConfig *RuntimeConfiguration) {
+		runtimeConfig.measureListeners = append(runtimeConfig.measureListeners, listener)
+	}
+}
+
+func (update *measuresUpdateEventInfo) getMeasureUpdate() *MeasureUpdate {
+	result := &MeasureUpdate{
+		Time:     update.packageInfo.GetPackageTime(),
+		DeviceId: update.packageInfo.DeviceId}
+
+	for sensorId, itemWithValue := range update.changedValues {
+		for _, measureInfo := range itemWithValue.measures {
+			result.Records = append(result.Records, &MeasureRecord{
+				Time:           result.Time,
+				ObjectId:       measureInfo.objectId,
+				ObjectName:     measureInfo.objectName,
+				ObjectTypeId:   measureInfo.objectTypeId,
+				ObjectTypeName: measureInfo.objectTypeName,
+				MeasureId:      measureInfo.measureOrAttributeId,
+				IsAttribute:    measureInfo.isAttribute,
+				MeasureName:    measureInfo.measureOrAttributeName,
+				Unit:           measureInfo.unitOfMeasure,
+				StationId:      measureInfo.stationId,
+				StationName:    measureInfo.stationName,
+				DeviceId:       result.DeviceId,
+				SensorId:       sensorId,
+				Value:          itemWithValue.value})
+		}
+	}
+
+	// Измененные значения хранятся в словаре, сортируем для стабильного порядка
+	sort.Slice(result.Records, func(i, j int) bool {
+		a, b := result.Records[i], result.Records[j]
+		if a.ObjectId != b.ObjectId {
+			return a.ObjectId < b.ObjectId
+		}
+		if a.IsAttribute != b.IsAttribute {
+			return !a.IsAttribute
+		}
+		return a.MeasureId < b.MeasureId
+	})
+
+	return result
+}
+
+func (runtimeConfig *RuntimeConfiguration) notifyMeasureListeners(updateResult updateEventInfo) {
+	if len(runtimeConfig.measureListeners) == 0 {
+		return
+	}
+
+	update, ok := updateResult.(*measuresUpdateEventInfo)
+	if !ok || len(update.changedValues) == 0 {
+		return
+	}
+
+	measureUpdate := update.getMeasureUpdate()
+
+	for _, listener := range runtimeConfig.measureListeners {
+		listener(measureUpdate)
+	}
+}
@@ -7,30 +7,39 @@ import (
 	"time"
 )
 
-type eventMeasuresUpdateInfo struct {
-	Time       int64               `json:"time"`
-	RawData    string              `json:"rawData"`
-	Stations   []int               `json:"stations"`
-	DeviceId   int32               `json:"deviceId"`
-	Format     byte                `json:"format"`
-	Measures   []measureItemInfo   `json:"measures,omitempty"`
-	Attributes []attributeItemInfo `json:"attributes,omitempty"`
+// MeasuresDocument документ архива с изменениями измерений и атрибутов (DocumentKindMeasures)
+type MeasuresDocument struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Time          int64           `json:"time"`
+	Stations      []int           `json:"stations"`
+	DeviceId      int32           `json:"deviceId"`
+	Format        byte            `json:"format"`
+	Measures      []MeasureItem   `json:"measures,omitempty"`
+	Attributes    []AttributeItem `json:"attributes,omitempty"`
+	rawDataFields
 }
 
-type measureOrAttributeItemInfo struct {
-	Value        *float32 `json:"value,omitempty"`
-	ObjectId     int      `json:"objectId"`
-	Unit         string   `json:"unit"`
-	ObjectTypeId int      `json:"objectTypeId"`
+// MeasureOrAttributeItem значение измерения или атрибута объекта
+type MeasureOrAttributeItem struct {
+	Value          *float32 `json:"value,omitempty"`
+	ObjectId       int      `json:"objectId"`
+	Unit           string   `json:"unit"`
+	ObjectTypeId   int      `json:"objectTypeId"`
+	Name           string   `json:"name,omitempty"`
+	ObjectName     string   `json:"objectName,omitempty"`
+	ObjectTypeName string   `json:"objectTypeName,omitempty"`
+	StationName    string   `json:"stationName,omitempty"`
 }
 
-type measureItemInfo struct {
-	measureOrAttributeItemInfo
+// MeasureItem значение измерения объекта
+type MeasureItem struct {
+	MeasureOrAttributeItem
 	MeasureId int `json:"measureId"`
 }
 
-type attributeItemInfo struct {
-	measureOrAttributeItemInfo
+// AttributeItem значение атрибута объекта
+type AttributeItem struct {
+	MeasureOrAttributeItem
 	AttributeId int `json:"attributeId"`
 }
 
@@ -44,6 +53,7 @@ type measuresUpdateEventInfo struct {
 	changedValues  map[uint16]*updatedMeasures
 	packageInfo    *core.DataPackage
 	stations       []int
+	rawDataPolicy  RawDataPolicy
 }
 
 func (update *measuresUpdateEventInfo) getArchiveServerRequest() []*RequestItem {
@@ -64,12 +74,15 @@ func (update *measuresUpdateEventInfo) getArchiveServerRequest() []*RequestItem
 		return nil
 	}
 
-	item := &eventMeasuresUpdateInfo{
-		Time:     processingTime,
-		Stations: update.stations,
-		DeviceId: update.packageInfo.DeviceId,
-		Format:   update.packageInfo.Format,
-		RawData:  update.packageInfo.GetBase64String()}
+	item := &MeasuresDocument{
+		SchemaVersion: DocumentSchemaVersion,
+		Time:          processingTime,
+		Stations:      update.stations,
+		DeviceId:      update.packageInfo.DeviceId,
+		Format:        update.packageInfo.Format}
+
+	rawData, rawDataRequest := getRawData(update.rawDataPolicy, update.packageInfo, id, processingTime)
+	item.rawDataFields = rawData
 
 	for _, itemWithValue := range update.changedValues {
 		if len(itemWithValue.measures) == 0 {
@@ -78,22 +91,26 @@ func (update *measuresUpdateEventInfo) getArchiveServerRequest() []*RequestItem
 
 		for _, measureInfo := range itemWithValue.measures {
 
-			commonInfo := measureOrAttributeItemInfo{
-				ObjectId:     measureInfo.objectId,
-				Unit:         measureInfo.unitOfMeasure,
-				ObjectTypeId: measureInfo.objectTypeId}
+			commonInfo := MeasureOrAttributeItem{
+				ObjectId:       measureInfo.objectId,
+				Unit:           measureInfo.unitOfMeasure,
+				ObjectTypeId:   measureInfo.objectTypeId,
+				Name:           measureInfo.measureOrAttributeName,
+				ObjectName:     measureInfo.objectName,
+				ObjectTypeName: measureInfo.objectTypeName,
+				StationName:    measureInfo.stationName}
 
 			if !core.IsNaN(itemWithValue.value) {
 				commonInfo.Value = &itemWithValue.value
 			}
 
 			if measureInfo.isAttribute {
-				item.Attributes = append(item.Attributes, attributeItemInfo{
+				item.Attributes = append(item.Attributes, AttributeItem{
 					commonInfo,
 					measureInfo.measureOrAttributeId})
 
 			} else {
-				item.Measures = append(item.Measures, measureItemInfo{
+				item.Measures = append(item.Measures, MeasureItem{
 					commonInfo,
 					measureInfo.measureOrAttributeId})
 			}
@@ -105,5 +122,10 @@ func (update *measuresUpdateEventInfo) getArchiveServerRequest() []*RequestItem
 		return nil
 	}
 
-	return []*RequestItem{{string(buf), string(itemBuf)}}
+	result := []*RequestItem{{string(buf), string(itemBuf)}}
+	if rawDataRequest != nil {
+		result = append(result, rawDataRequest)
+	}
+
+	return result
 }
@@ -1,6 +1,7 @@
 package archive
 
 import (
+	"encoding/json"
 	"github.com/imsat-spb/go-apkdk-core"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -43,7 +44,7 @@ func TestGetArchiveServerRequest(t *testing.T) {
 	aTime := time.Now()
 	packageInfo := &core.DataPackage{Format: 0, DeviceId: 100}
 	updateResult := &measuresUpdateEventInfo{aTime, map[uint16]*updatedMeasures{
-		1: um1, 2: um2, 3: um3}, packageInfo, []int{500}}
+		1: um1, 2: um2, 3: um3}, packageInfo, []int{500}, RawDataAlways}
 
 	res := updateResult.getArchiveServerRequest()
 
@@ -51,3 +52,40 @@ func TestGetArchiveServerRequest(t *testing.T) {
 
 	// TODO: check return values
 }
+
+func TestGetArchiveServerRequestWithNames(t *testing.T) {
+
+	testMeasureInfo := &archiveMeasureOrAttributeInfo{
+		isAttribute:            false,
+		measureOrAttributeId:   100,
+		objectId:               200,
+		objectTypeId:           1,
+		stationId:              500,
+		unitOfMeasure:          "с",
+		objectName:             "Object",
+		measureOrAttributeName: "P",
+		objectTypeName:         "Type",
+		stationName:            "Station",
+	}
+
+	um := &updatedMeasures{value: 100.25, measures: []*archiveMeasureOrAttributeInfo{testMeasureInfo}}
+
+	packageInfo := &core.DataPackage{Format: 0, DeviceId: 100}
+	updateResult := &measuresUpdateEventInfo{time.Now(), map[uint16]*updatedMeasures{1: um}, packageInfo, []int{500}, RawDataAlways}
+
+	res := updateResult.getArchiveServerRequest()
+
+	assert.Len(t, res, 1)
+
+	var eventInfo MeasuresDocument
+	err := json.Unmarshal([]byte(res[0].item), &eventInfo)
+
+	assert.Nil(t, err)
+	assert.Len(t, eventInfo.Measures, 1)
+
+	m := eventInfo.Measures[0]
+	assert.Equal(t, "Object", m.ObjectName)
+	assert.Equal(t, "P", m.Name)
+	assert.Equal(t, "Type", m.ObjectTypeName)
+	assert.Equal(t, "Station", m.StationName)
+}
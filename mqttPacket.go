@@ -0,0 +1,205 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Типы пакетов MQTT 3.1.1, которые использует MqttPublisher
+const (
+	mqttPacketConnect    = 1
+	mqttPacketConnack    = 2
+	mqttPacketPublish    = 3
+	mqttPacketPuback     = 4
+	mqttPacketPingreq    = 12
+	mqttPacketPingresp   = 13
+	mqttPacketDisconnect = 14
+)
+
+// Максимальная длина пакета, которую можно записать в поле оставшейся длины
+const mqttMaxPacketLength = 268435455
+
+type mqttPacket struct {
+	packetType byte
+	flags      byte
+	body       []byte
+}
+
+func appendMqttString(buf []byte, value string) []byte {
+	buf = append(buf, byte(len(value)>>8), byte(len(value)))
+	return append(buf, value...)
+}
+
+func readMqttString(body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, errors.New("mqtt: string length is missing")
+	}
+
+	length := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+length {
+		return "", nil, fmt.Errorf("mqtt: string length %d exceeds packet", length)
+	}
+
+	return string(body[2 : 2+length]), body[2+length:], nil
+}
+
+func writeMqttPacket(w io.Writer, packetType byte, flags byte, body []byte) error {
+	if len(body) > mqttMaxPacketLength {
+		return fmt.Errorf("mqtt: packet length %d is too large", len(body))
+	}
+
+	buf := make([]byte, 0, len(body)+5)
+	buf = append(buf, packetType<<4|flags&0x0f)
+
+	// Оставшаяся длина записывается по 7 бит, старший бит означает продолжение
+	length := len(body)
+	for {
+		b := byte(length & 0x7f)
+		length >>= 7
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(buf, body...))
+	return err
+}
+
+func readMqttPacket(r *bufio.Reader) (*mqttPacket, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length := 0
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errors.New("mqtt: malformed remaining length")
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		length |= int(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	result := &mqttPacket{packetType: header >> 4, flags: header & 0x0f, body: make([]byte, length)}
+	if _, err = io.ReadFull(r, result.body); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func getMqttConnectBody(clientId string, username string, password string, keepAlive time.Duration) []byte {
+	// Чистая сессия: недоставленные сообщения хранит MqttPublisher, а не брокер
+	flags := byte(0x02)
+	if username != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := appendMqttString(nil, "MQTT")
+	body = append(body, 4, flags)
+
+	seconds := int(keepAlive / time.Second)
+	if seconds > 0xffff {
+		seconds = 0xffff
+	}
+	body = append(body, byte(seconds>>8), byte(seconds))
+
+	body = appendMqttString(body, clientId)
+	if username != "" {
+		body = appendMqttString(body, username)
+		if password != "" {
+			body = appendMqttString(body, password)
+		}
+	}
+
+	return body
+}
+
+func getMqttConnackError(packet *mqttPacket) error {
+	if packet.packetType != mqttPacketConnack || len(packet.body) != 2 {
+		return fmt.Errorf("mqtt: expected CONNACK, received packet type %d", packet.packetType)
+	}
+
+	switch code := packet.body[1]; code {
+	case 0:
+		return nil
+	case 1:
+		return errors.New("mqtt: connection refused, unacceptable protocol version")
+	case 2:
+		return errors.New("mqtt: connection refused, identifier rejected")
+	case 3:
+		return errors.New("mqtt: connection refused, server unavailable")
+	case 4:
+		return errors.New("mqtt: connection refused, bad user name or password")
+	case 5:
+		return errors.New("mqtt: connection refused, not authorized")
+	default:
+		return fmt.Errorf("mqtt: connection refused, return code %d", code)
+	}
+}
+
+// getMqttPublishFlags возвращает флаги пакета PUBLISH. Флаг dup устанавливается при повторной передаче
+// неподтвержденного сообщения
+func getMqttPublishFlags(qos byte, retain bool, dup bool) byte {
+	flags := qos << 1
+	if retain {
+		flags |= 0x01
+	}
+	if dup {
+		flags |= 0x08
+	}
+	return flags
+}
+
+func getMqttPublishBody(topic string, qos byte, packetId uint16, payload []byte) []byte {
+	body := appendMqttString(make([]byte, 0, len(topic)+len(payload)+4), topic)
+	if qos > 0 {
+		body = append(body, byte(packetId>>8), byte(packetId))
+	}
+	return append(body, payload...)
+}
+
+// parseMqttPublish возвращает топик, идентификатор пакета (для QoS 1 и 2) и данные пакета PUBLISH
+func parseMqttPublish(packet *mqttPacket) (string, uint16, []byte, error) {
+	topic, rest, err := readMqttString(packet.body)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	var packetId uint16
+	if (packet.flags>>1)&0x03 > 0 {
+		if len(rest) < 2 {
+			return "", 0, nil, errors.New("mqtt: packet identifier is missing")
+		}
+		packetId = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+
+	return topic, packetId, rest, nil
+}
+
+func getMqttPacketId(packet *mqttPacket) (uint16, error) {
+	if len(packet.body) < 2 {
+		return 0, fmt.Errorf("mqtt: packet type %d has no identifier", packet.packetType)
+	}
+	return binary.BigEndian.Uint16(packet.body), nil
+}
@@ -0,0 +1,700 @@
+package archive
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMqttTopicPrefix = "apkdk"
+	defaultMqttClientId    = "apkdk-archive"
+	defaultMqttBufferSize  = 10000
+	defaultMqttKeepAlive   = 30 * time.Second
+	defaultMqttMinBackoff  = time.Second
+	defaultMqttMaxBackoff  = time.Minute
+	// Время ожидания соединения, CONNACK, записи пакета и PUBACK
+	mqttTimeout = 30 * time.Second
+)
+
+type mqttPublisherOptions struct {
+	clientId   string
+	username   string
+	password   string
+	tlsConfig  *tls.Config
+	qos        byte
+	retain     bool
+	prefix     string
+	bufferSize int
+	keepAlive  time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// MqttOption задает параметры MqttPublisher
+type MqttOption func(options *mqttPublisherOptions)
+
+// WithMqttClientId задает идентификатор клиента. По умолчанию apkdk-archive
+func WithMqttClientId(clientId string) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.clientId = clientId
+	}
+}
+
+// WithMqttCredentials задает имя пользователя и пароль для подключения к брокеру
+func WithMqttCredentials(username string, password string) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.username = username
+		options.password = password
+	}
+}
+
+// WithMqttTLS задает подключение к брокеру по TLS
+func WithMqttTLS(config *tls.Config) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.tlsConfig = config
+	}
+}
+
+// WithMqttQoS задает уровень качества обслуживания 0 или 1. По умолчанию 0.
+// Уровень 2 не поддерживается, NewMqttPublisher возвращает ошибку
+func WithMqttQoS(qos byte) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.qos = qos
+	}
+}
+
+// WithMqttRetain задает публикацию сообщений с флагом retain, чтобы брокер хранил последнее значение
+// каждого топика для новых подписчиков. По умолчанию включено
+func WithMqttRetain(retain bool) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.retain = retain
+	}
+}
+
+// WithMqttTopicPrefix задает первый уровень топиков. По умолчанию apkdk
+func WithMqttTopicPrefix(prefix string) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.prefix = prefix
+	}
+}
+
+// WithMqttBufferSize задает количество сообщений, которые хранятся при отсутствии соединения.
+// При переполнении отбрасываются самые старые сообщения. По умолчанию 10000
+func WithMqttBufferSize(size int) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.bufferSize = size
+	}
+}
+
+// WithMqttKeepAlive задает интервал keep alive соединения. По умолчанию 30 секунд
+func WithMqttKeepAlive(interval time.Duration) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.keepAlive = interval
+	}
+}
+
+// WithMqttReconnectBackoff задает начальную и максимальную паузу перед повторным подключением.
+// После каждой неудачной попытки пауза удваивается. По умолчанию от 1 секунды до 1 минуты
+func WithMqttReconnectBackoff(min time.Duration, max time.Duration) MqttOption {
+	return func(options *mqttPublisherOptions) {
+		options.minBackoff = min
+		options.maxBackoff = max
+	}
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	// Идентификатор пакета и признак отправки сообщения с QoS 1. Неподтвержденное сообщение
+	// передается повторно с тем же идентификатором и флагом DUP
+	packetId uint16
+	sent     bool
+}
+
+type mqttValuePayload struct {
+	Time         int64    `json:"time"`
+	Value        *float32 `json:"value"`
+	Unit         string   `json:"unit,omitempty"`
+	ObjectTypeId int      `json:"objectTypeId,omitempty"`
+	DeviceId     int32    `json:"deviceId"`
+	SensorId     uint16   `json:"sensorId"`
+}
+
+type mqttStatePayload struct {
+	Time      int64 `json:"time"`
+	DeviceId  int32 `json:"deviceId"`
+	FullState bool  `json:"fullState,omitempty"`
+	StateEvent
+}
+
+type mqttFailurePayload struct {
+	Time      int64 `json:"time"`
+	DeviceId  int32 `json:"deviceId"`
+	FullState bool  `json:"fullState,omitempty"`
+	FailureEvent
+}
+
+type mqttAccidentPayload struct {
+	Time      int64 `json:"time"`
+	DeviceId  int32 `json:"deviceId"`
+	FullState bool  `json:"fullState,omitempty"`
+	AccidentEvent
+}
+
+// MqttPublisher публикует изменения значений и события объектов в брокер MQTT 3.1.1.
+// Топики строятся как {prefix}/{station}/{objectId}/measure/{measureId} и
+// {prefix}/{station}/{objectId}/attribute/{attributeId} для значений,
+// {prefix}/{station}/{objectId}/state, {prefix}/{station}/{objectId}/failure/{faultId} и
+// {prefix}/{station}/{objectId}/accident/{algorithmId} для событий. Данные сообщения передаются в JSON.
+// Сообщения передаются по очереди в фоновом соединении. При обрыве соединения публикатор подключается
+// повторно с увеличивающейся паузой, а сообщения копятся в буфере. Сообщение с QoS 1 удаляется из буфера
+// после подтверждения брокера, поэтому после переподключения оно может быть доставлено повторно с флагом DUP
+type MqttPublisher struct {
+	address string
+	info    *ConfigurationInfo
+	options mqttPublisherOptions
+
+	lock      sync.Mutex
+	queue     []*mqttMessage
+	idle      chan struct{}
+	dropped   uint64
+	connected bool
+	packetId  uint16
+	err       error
+
+	notify    chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewMqttPublisher создает публикатор и начинает подключение к брокеру address (host:port).
+// Конфигурация info используется для определения станции объекта в событиях, может быть nil
+func NewMqttPublisher(address string, info *ConfigurationInfo, opts ...MqttOption) (*MqttPublisher, error) {
+	options := mqttPublisherOptions{
+		clientId:   defaultMqttClientId,
+		retain:     true,
+		prefix:     defaultMqttTopicPrefix,
+		bufferSize: defaultMqttBufferSize,
+		keepAlive:  defaultMqttKeepAlive,
+		minBackoff: defaultMqttMinBackoff,
+		maxBackoff: defaultMqttMaxBackoff}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.qos > 1 {
+		return nil, fmt.Errorf("mqtt: QoS %d is not supported", options.qos)
+	}
+
+	result := &MqttPublisher{
+		address: address,
+		info:    info,
+		options: options,
+		idle:    make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{})}
+
+	// Пустой буфер: Flush не ждет
+	close(result.idle)
+
+	go result.run()
+
+	return result, nil
+}
+
+func (publisher *MqttPublisher) enqueue(messages []*mqttMessage) {
+	if len(messages) == 0 {
+		return
+	}
+
+	publisher.lock.Lock()
+
+	if len(publisher.queue) == 0 {
+		publisher.idle = make(chan struct{})
+	}
+
+	publisher.queue = append(publisher.queue, messages...)
+	if overflow := len(publisher.queue) - publisher.options.bufferSize; overflow > 0 {
+		for i := 0; i < overflow; i++ {
+			publisher.queue[i] = nil
+		}
+		publisher.queue = publisher.queue[overflow:]
+		publisher.dropped += uint64(overflow)
+	}
+
+	publisher.lock.Unlock()
+
+	select {
+	case publisher.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (publisher *MqttPublisher) head() *mqttMessage {
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+
+	if len(publisher.queue) == 0 {
+		return nil
+	}
+	return publisher.queue[0]
+}
+
+// remove удаляет переданное сообщение из начала буфера. Если оно уже вытеснено при переполнении, буфер не меняется
+func (publisher *MqttPublisher) remove(message *mqttMessage) {
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+
+	if len(publisher.queue) == 0 || publisher.queue[0] != message {
+		return
+	}
+
+	publisher.queue[0] = nil
+	publisher.queue = publisher.queue[1:]
+
+	if len(publisher.queue) == 0 {
+		close(publisher.idle)
+	}
+}
+
+func (publisher *MqttPublisher) nextPacketId() uint16 {
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+
+	publisher.packetId++
+	if publisher.packetId == 0 {
+		publisher.packetId = 1
+	}
+	return publisher.packetId
+}
+
+func (publisher *MqttPublisher) setConnected(connected bool) {
+	publisher.lock.Lock()
+	publisher.connected = connected
+	publisher.lock.Unlock()
+}
+
+func (publisher *MqttPublisher) setError(err error) {
+	publisher.lock.Lock()
+	if publisher.err == nil {
+		publisher.err = err
+	}
+	publisher.lock.Unlock()
+}
+
+func (publisher *MqttPublisher) connect() (net.Conn, *bufio.Reader, error) {
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+
+	var conn net.Conn
+	var err error
+	if publisher.options.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", publisher.address, publisher.options.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", publisher.address)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := &publisher.options
+	reader := bufio.NewReader(conn)
+
+	err = conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if err == nil {
+		err = writeMqttPacket(conn, mqttPacketConnect, 0,
+			getMqttConnectBody(options.clientId, options.username, options.password, options.keepAlive))
+	}
+
+	var packet *mqttPacket
+	if err == nil {
+		packet, err = readMqttPacket(reader)
+	}
+	if err == nil {
+		err = getMqttConnackError(packet)
+	}
+	if err == nil {
+		err = conn.SetDeadline(time.Time{})
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, reader, nil
+}
+
+// read передает подтверждения PUBACK, пока соединение не будет закрыто
+func (publisher *MqttPublisher) read(conn net.Conn, reader *bufio.Reader, acks chan<- uint16, errs chan<- error,
+	stop <-chan struct{}) {
+
+	for {
+		// Брокер отвечает на PINGREQ, поэтому молчание дольше интервала keep alive означает обрыв
+		if publisher.options.keepAlive > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(publisher.options.keepAlive * 3 / 2)); err != nil {
+				errs <- err
+				return
+			}
+		}
+
+		packet, err := readMqttPacket(reader)
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		if packet.packetType != mqttPacketPuback {
+			continue
+		}
+
+		packetId, err := getMqttPacketId(packet)
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		select {
+		case acks <- packetId:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (publisher *MqttPublisher) write(conn net.Conn, packetType byte, flags byte, body []byte) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(mqttTimeout)); err != nil {
+		return err
+	}
+	return writeMqttPacket(conn, packetType, flags, body)
+}
+
+func (publisher *MqttPublisher) waitAck(packetId uint16, acks <-chan uint16, errs <-chan error) error {
+	timer := time.NewTimer(mqttTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case id := <-acks:
+			// Подтверждения пакетов, отправленных до истечения ожидания, пропускаются
+			if id == packetId {
+				return nil
+			}
+		case err := <-errs:
+			return err
+		case <-timer.C:
+			return fmt.Errorf("mqtt: PUBACK for packet %d is not received", packetId)
+		case <-publisher.closed:
+			return errors.New("mqtt: publisher is closed")
+		}
+	}
+}
+
+// serve передает сообщения буфера, пока соединение не оборвется или публикатор не будет закрыт
+func (publisher *MqttPublisher) serve(conn net.Conn, reader *bufio.Reader) error {
+	acks := make(chan uint16)
+	errs := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go publisher.read(conn, reader, acks, errs, stop)
+
+	var ping <-chan time.Time
+	if publisher.options.keepAlive > 0 {
+		ticker := time.NewTicker(publisher.options.keepAlive / 2)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	options := &publisher.options
+
+	for {
+		select {
+		case <-publisher.closed:
+			return publisher.write(conn, mqttPacketDisconnect, 0, nil)
+		default:
+		}
+
+		message := publisher.head()
+		if message == nil {
+			select {
+			case <-publisher.closed:
+			case <-publisher.notify:
+			case err := <-errs:
+				return err
+			case <-ping:
+				if err := publisher.write(conn, mqttPacketPingreq, 0, nil); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if options.qos > 0 && !message.sent {
+			message.packetId = publisher.nextPacketId()
+		}
+
+		err := publisher.write(conn, mqttPacketPublish, getMqttPublishFlags(options.qos, options.retain, message.sent),
+			getMqttPublishBody(message.topic, options.qos, message.packetId, message.payload))
+
+		// Брокер мог получить сообщение и при ошибке записи
+		message.sent = options.qos > 0
+
+		if err != nil {
+			return err
+		}
+
+		if options.qos > 0 {
+			if err = publisher.waitAck(message.packetId, acks, errs); err != nil {
+				return err
+			}
+		}
+
+		publisher.remove(message)
+	}
+}
+
+func (publisher *MqttPublisher) run() {
+	defer close(publisher.done)
+
+	backoff := publisher.options.minBackoff
+
+	for {
+		conn, reader, err := publisher.connect()
+		if err == nil {
+			publisher.setConnected(true)
+			backoff = publisher.options.minBackoff
+
+			// Причина обрыва не важна: сообщения остаются в буфере до следующего подключения
+			_ = publisher.serve(conn, reader)
+
+			publisher.setConnected(false)
+			conn.Close()
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-publisher.closed:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > publisher.options.maxBackoff {
+			backoff = publisher.options.maxBackoff
+		}
+	}
+}
+
+func (publisher *MqttPublisher) getObjectStation(objectId uint32, stations []int) int {
+	if publisher.info != nil {
+		if obj, ok := publisher.info.Objects[int(objectId)]; ok {
+			return obj.stationId
+		}
+	}
+
+	// Объект не входит в конфигурацию, станцию можно определить только по документу с одной станцией
+	if len(stations) == 1 {
+		return stations[0]
+	}
+	return 0
+}
+
+func (publisher *MqttPublisher) getTopic(stationId int, objectId int, levels ...interface{}) string {
+	topic := fmt.Sprintf("%s/%d/%d", publisher.options.prefix, stationId, objectId)
+	for _, level := range levels {
+		topic += fmt.Sprintf("/%v", level)
+	}
+	return topic
+}
+
+func (publisher *MqttPublisher) appendMessage(messages []*mqttMessage, topic string, payload interface{}) ([]*mqttMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return messages, err
+	}
+	return append(messages, &mqttMessage{topic: topic, payload: data}), nil
+}
+
+// PublishUpdate добавляет в буфер сообщения об измененных значениях. Неопределенное значение передается как null
+func (publisher *MqttPublisher) PublishUpdate(update *MeasureUpdate) error {
+	var messages []*mqttMessage
+	var result error
+
+	for _, record := range update.Records {
+		payload := &mqttValuePayload{
+			Time:         core.GetUnixMillisecondsFromTime(record.Time),
+			Unit:         record.Unit,
+			ObjectTypeId: record.ObjectTypeId,
+			DeviceId:     record.DeviceId,
+			SensorId:     record.SensorId}
+
+		if !core.IsNaN(record.Value) {
+			value := record.Value
+			payload.Value = &value
+		}
+
+		kind := dictionaryKindMeasure
+		if record.IsAttribute {
+			kind = dictionaryKindAttribute
+		}
+
+		var err error
+		messages, err = publisher.appendMessage(messages,
+			publisher.getTopic(record.StationId, record.ObjectId, kind, record.MeasureId), payload)
+		if err != nil && result == nil {
+			result = err
+		}
+	}
+
+	publisher.enqueue(messages)
+
+	return result
+}
+
+func (publisher *MqttPublisher) appendEventMessages(messages []*mqttMessage, eventTime int64, deviceId int32, stations []int,
+	fullState bool, sds []StateEvent, failures []FailureEvent, accidents []AccidentEvent) ([]*mqttMessage, error) {
+
+	var err error
+
+	for _, e := range sds {
+		topic := publisher.getTopic(publisher.getObjectStation(e.ObjectId, stations), int(e.ObjectId), "state")
+		messages, err = publisher.appendMessage(messages, topic, &mqttStatePayload{eventTime, deviceId, fullState, e})
+		if err != nil {
+			return messages, err
+		}
+	}
+
+	for _, e := range failures {
+		topic := publisher.getTopic(publisher.getObjectStation(e.ObjectId, stations), int(e.ObjectId), "failure", e.Fault)
+		messages, err = publisher.appendMessage(messages, topic, &mqttFailurePayload{eventTime, deviceId, fullState, e})
+		if err != nil {
+			return messages, err
+		}
+	}
+
+	for _, e := range accidents {
+		topic := publisher.getTopic(publisher.getObjectStation(e.ObjectId, stations), int(e.ObjectId), "accident", e.AlgorithmId)
+		messages, err = publisher.appendMessage(messages, topic, &mqttAccidentPayload{eventTime, deviceId, fullState, e})
+		if err != nil {
+			return messages, err
+		}
+	}
+
+	return messages, nil
+}
+
+// PublishRequestItems добавляет в буфер сообщения о событиях объектов из документов архива:
+// смене состояний, отказах и предотказах. Значения измерений передаются через PublishUpdate,
+// поэтому документы измерений, как и документы других индексов и события АНР и АП, пропускаются
+func (publisher *MqttPublisher) PublishRequestItems(items []*RequestItem) error {
+	var messages []*mqttMessage
+	var result error
+
+	for _, item := range items {
+		var rq map[string]*createRequest
+		if err := json.Unmarshal([]byte(item.request), &rq); err != nil {
+			return err
+		}
+
+		if action := getRequestAction(rq); action == nil || action.Index != defaultArchiveIndex {
+			continue
+		}
+
+		decoded, err := DecodeDocument([]byte(item.item))
+		if err != nil {
+			return err
+		}
+
+		switch doc := decoded.(type) {
+		case *EventsDocument:
+			messages, err = publisher.appendEventMessages(messages, doc.Time, doc.DeviceId, doc.Stations, false,
+				doc.Sds, doc.Failures, doc.Accidents)
+		case *FullStateDocument:
+			messages, err = publisher.appendEventMessages(messages, doc.Time, doc.DeviceId, doc.Stations, true,
+				doc.Sds, doc.Failures, doc.Accidents)
+		}
+
+		if err != nil && result == nil {
+			result = err
+		}
+	}
+
+	publisher.enqueue(messages)
+
+	return result
+}
+
+// MeasureListener возвращает получателя измененных значений для WithMeasureListener.
+// Первая ошибка возвращается из Close
+func (publisher *MqttPublisher) MeasureListener() MeasureListener {
+	return func(update *MeasureUpdate) {
+		if err := publisher.PublishUpdate(update); err != nil {
+			publisher.setError(err)
+		}
+	}
+}
+
+// DocumentListener возвращает получателя документов для WithDocumentListener.
+// Первая ошибка возвращается из Close
+func (publisher *MqttPublisher) DocumentListener() DocumentListener {
+	return func(items []*RequestItem) {
+		if err := publisher.PublishRequestItems(items); err != nil {
+			publisher.setError(err)
+		}
+	}
+}
+
+// IsConnected возвращает true, если соединение с брокером установлено
+func (publisher *MqttPublisher) IsConnected() bool {
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+
+	return publisher.connected
+}
+
+// Dropped возвращает количество сообщений, отброшенных из-за переполнения буфера
+func (publisher *MqttPublisher) Dropped() uint64 {
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+
+	return publisher.dropped
+}
+
+// Flush ожидает передачи всех сообщений буфера брокеру
+func (publisher *MqttPublisher) Flush(ctx context.Context) error {
+	publisher.lock.Lock()
+	idle := publisher.idle
+	publisher.lock.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close отключается от брокера. Сообщения, оставшиеся в буфере, не передаются
+func (publisher *MqttPublisher) Close() error {
+	publisher.closeOnce.Do(func() {
+		close(publisher.closed)
+	})
+
+	<-publisher.done
+
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+
+	return publisher.err
+}
@@ -0,0 +1,337 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	mqtt "github.com/mochi-co/mqtt/server"
+	"github.com/mochi-co/mqtt/server/listeners"
+	"github.com/mochi-co/mqtt/server/listeners/auth"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	mqttTestPacketSubscribe = 8
+	mqttTestPacketSuback    = 9
+)
+
+func getMqttTestAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func startMqttTestBroker(t *testing.T, address string) *mqtt.Server {
+	broker := mqtt.New()
+	assert.Nil(t, broker.AddListener(listeners.NewTCP("tcp", address), &listeners.Config{Auth: new(auth.Allow)}))
+	// Serve публикует системные топики без синхронизации с подключением клиентов (гонка в mochi v1.0.0),
+	// поэтому запускаются только слушатели
+	broker.Listeners.ServeAll(broker.EstablishConnection)
+
+	return broker
+}
+
+type mqttTestMessage struct {
+	payload string
+	qos     byte
+	retain  bool
+}
+
+type mqttTestSubscriber struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Подписывается на топики filter с уровнем качества обслуживания qos
+func newMqttTestSubscriber(t *testing.T, address string, filter string, qos byte) *mqttTestSubscriber {
+	conn, err := net.Dial("tcp", address)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	result := &mqttTestSubscriber{conn: conn, reader: bufio.NewReader(conn)}
+
+	assert.Nil(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	assert.Nil(t, writeMqttPacket(conn, mqttPacketConnect, 0, getMqttConnectBody("subscriber", "", "", 0)))
+	packet, err := readMqttPacket(result.reader)
+	assert.Nil(t, err)
+	assert.Nil(t, getMqttConnackError(packet))
+
+	body := append([]byte{0, 1}, appendMqttString(nil, filter)...)
+	assert.Nil(t, writeMqttPacket(conn, mqttTestPacketSubscribe, 0x02, append(body, qos)))
+
+	packet, err = readMqttPacket(result.reader)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(mqttTestPacketSuback), packet.packetType)
+
+	return result
+}
+
+// Получает count сообщений, для каждого топика возвращается последнее сообщение
+func (subscriber *mqttTestSubscriber) receive(t *testing.T, count int) map[string]*mqttTestMessage {
+	result := make(map[string]*mqttTestMessage)
+
+	for i := 0; i < count; i++ {
+		packet, err := readMqttPacket(subscriber.reader)
+		if !assert.Nil(t, err) {
+			break
+		}
+		if !assert.Equal(t, byte(mqttPacketPublish), packet.packetType) {
+			continue
+		}
+
+		topic, packetId, payload, err := parseMqttPublish(packet)
+		assert.Nil(t, err)
+
+		message := &mqttTestMessage{payload: string(payload), qos: (packet.flags >> 1) & 0x03, retain: packet.flags&0x01 != 0}
+		if message.qos > 0 {
+			assert.Nil(t, writeMqttPacket(subscriber.conn, mqttPacketPuback, 0, []byte{byte(packetId >> 8), byte(packetId)}))
+		}
+
+		result[topic] = message
+	}
+
+	return result
+}
+
+func waitMqttTestConnected(t *testing.T, publisher *MqttPublisher, connected bool) {
+	for i := 0; i < 500 && publisher.IsConnected() != connected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, connected, publisher.IsConnected())
+}
+
+func flushMqttTestPublisher(publisher *MqttPublisher, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return publisher.Flush(ctx)
+}
+
+func TestMqttPacket(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 20000, 3000000} {
+		var buf bytes.Buffer
+		body := bytes.Repeat([]byte{7}, size)
+
+		assert.Nil(t, writeMqttPacket(&buf, mqttPacketPublish, 0x03, body))
+
+		packet, err := readMqttPacket(bufio.NewReader(&buf))
+		assert.Nil(t, err)
+		assert.Equal(t, byte(mqttPacketPublish), packet.packetType)
+		assert.Equal(t, byte(0x03), packet.flags)
+		assert.Equal(t, body, packet.body)
+		assert.Equal(t, 0, buf.Len())
+	}
+
+	assert.Equal(t, byte(0x0b), getMqttPublishFlags(1, true, true))
+
+	packet := &mqttPacket{packetType: mqttPacketPublish, flags: getMqttPublishFlags(1, true, false),
+		body: getMqttPublishBody("apkdk/1/2/state", 1, 513, []byte(`{}`))}
+	topic, packetId, payload, err := parseMqttPublish(packet)
+	assert.Nil(t, err)
+	assert.Equal(t, "apkdk/1/2/state", topic)
+	assert.Equal(t, uint16(513), packetId)
+	assert.Equal(t, []byte(`{}`), payload)
+
+	_, err = readMqttPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01})))
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, getMqttConnackError(&mqttPacket{packetType: mqttPacketConnack, body: []byte{0, 5}}))
+}
+
+func TestMqttPublisher(t *testing.T) {
+	address := getMqttTestAddress(t)
+	broker := startMqttTestBroker(t, address)
+	defer broker.Close()
+
+	info := getTestConfigurationInfo()
+
+	// Уровень 2 не поддерживается
+	_, err := NewMqttPublisher(address, info, WithMqttQoS(2))
+	assert.NotNil(t, err)
+
+	publisher, err := NewMqttPublisher(address, info, WithMqttQoS(1), WithMqttClientId("archive-test"))
+	assert.Nil(t, err)
+
+	runtimeConfig := NewRuntimeConfiguration(info,
+		WithMeasureListener(publisher.MeasureListener()), WithDocumentListener(publisher.DocumentListener()))
+
+	_, err = runtimeConfig.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(1000, 0), []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	// Объект 201 не входит в конфигурацию, станция определяется по документу
+	assert.Nil(t, publisher.PublishRequestItems([]*RequestItem{
+		getTestEventRequestItem("7_8_2000", `{"time":2000,"stations":[33000],"deviceId":7,"format":8,`+
+			`"sds":[{"objectId":200,"stateId":2,"stateName":"Занята"}],`+
+			`"failures":[{"objectId":201,"faultId":12,"isStarted":true,"failureTime":1900}]}`),
+		getTestEventRequestItem("7_5_3000", `{"time":3000,"stations":[30000,33000],"deviceId":7,"format":5,`+
+			`"accidents":[{"objectId":100,"algorithmId":4,"accidentType":1,"startTime":2950}]}`),
+		{request: `{"create":{"_index":"rollups","_id":"x"}}`, item: `{}`}}))
+
+	assert.Nil(t, flushMqttTestPublisher(publisher, 5*time.Second))
+
+	// Новое неопределенное значение заменяет сохраненное брокером
+	_, err = runtimeConfig.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(1001, 0), []byte{0, 0, 0, 0x80}))
+	assert.Nil(t, err)
+	assert.Nil(t, flushMqttTestPublisher(publisher, 5*time.Second))
+
+	// Новый подписчик получает последние значения, сохраненные брокером
+	subscriber := newMqttTestSubscriber(t, address, "apkdk/#", 1)
+	defer subscriber.conn.Close()
+
+	messages := subscriber.receive(t, 5)
+	assert.Len(t, messages, 5)
+	for _, message := range messages {
+		assert.True(t, message.retain)
+	}
+
+	assert.Equal(t, `{"time":1001000,"value":null,"unit":"В","deviceId":5,"sensorId":1}`,
+		messages["apkdk/30000/100/measure/7"].payload)
+	assert.Equal(t, `{"time":1001000,"value":null,"deviceId":5,"sensorId":1}`,
+		messages["apkdk/33000/200/attribute/8"].payload)
+	assert.Equal(t, `{"time":2000,"deviceId":7,"objectId":200,"stateId":2,"stateName":"Занята"}`,
+		messages["apkdk/33000/200/state"].payload)
+	assert.Equal(t, `{"time":2000,"deviceId":7,"objectId":201,"faultId":12,"isStarted":true,"failureTime":1900}`,
+		messages["apkdk/33000/201/failure/12"].payload)
+	assert.Equal(t, `{"time":3000,"deviceId":7,"fullState":true,"objectId":100,"algorithmId":4,"accidentType":1,"startTime":2950}`,
+		messages["apkdk/30000/100/accident/4"].payload)
+
+	assert.Nil(t, publisher.Close())
+	assert.False(t, publisher.IsConnected())
+	assert.Equal(t, uint64(0), publisher.Dropped())
+}
+
+func TestMqttPublisherReconnect(t *testing.T) {
+	address := getMqttTestAddress(t)
+	broker := startMqttTestBroker(t, address)
+
+	publisher, err := NewMqttPublisher(address, nil, WithMqttRetain(true), WithMqttTopicPrefix("scada"),
+		WithMqttReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	assert.Nil(t, err)
+	defer publisher.Close()
+
+	waitMqttTestConnected(t, publisher, true)
+
+	assert.Nil(t, broker.Close())
+	waitMqttTestConnected(t, publisher, false)
+
+	// Пока брокер недоступен, сообщения хранятся в буфере
+	update := &MeasureUpdate{Records: []*MeasureRecord{
+		{Time: time.Unix(5, 0), ObjectId: 100, MeasureId: 7, StationId: 30000, DeviceId: 5, SensorId: 1, Value: 2.5}}}
+	assert.Nil(t, publisher.PublishUpdate(update))
+	assert.Equal(t, context.DeadlineExceeded, flushMqttTestPublisher(publisher, 100*time.Millisecond))
+
+	broker = startMqttTestBroker(t, address)
+	defer broker.Close()
+
+	assert.Nil(t, flushMqttTestPublisher(publisher, 5*time.Second))
+	assert.True(t, publisher.IsConnected())
+
+	subscriber := newMqttTestSubscriber(t, address, "scada/+/100/#", 0)
+	defer subscriber.conn.Close()
+
+	messages := subscriber.receive(t, 1)
+	if assert.Contains(t, messages, "scada/30000/100/measure/7") {
+		assert.Equal(t, `{"time":5000,"value":2.5,"deviceId":5,"sensorId":1}`, messages["scada/30000/100/measure/7"].payload)
+	}
+}
+
+func TestMqttPublisherQoS(t *testing.T) {
+	// Встроенный брокер передает подписчикам сообщения с уровнем подписки,
+	// поэтому подтверждения проверяются на соединении, которое принимает тест
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	publisher, err := NewMqttPublisher(listener.Addr().String(), nil, WithMqttQoS(1), WithMqttRetain(false),
+		WithMqttCredentials("user", "secret"), WithMqttReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	assert.Nil(t, err)
+	defer publisher.Close()
+
+	accept := func() (net.Conn, *bufio.Reader) {
+		conn, err := listener.Accept()
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+
+		assert.Nil(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+		reader := bufio.NewReader(conn)
+
+		packet, err := readMqttPacket(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, byte(mqttPacketConnect), packet.packetType)
+		assert.Equal(t, getMqttConnectBody(defaultMqttClientId, "user", "secret", defaultMqttKeepAlive), packet.body)
+		assert.Nil(t, writeMqttPacket(conn, mqttPacketConnack, 0, []byte{0, 0}))
+
+		return conn, reader
+	}
+
+	conn, reader := accept()
+
+	assert.Nil(t, publisher.PublishUpdate(&MeasureUpdate{Records: []*MeasureRecord{
+		{Time: time.Unix(5, 0), ObjectId: 100, MeasureId: 7, StationId: 30000, Value: 1}}}))
+
+	packet, err := readMqttPacket(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(mqttPacketPublish), packet.packetType)
+	assert.Equal(t, getMqttPublishFlags(1, false, false), packet.flags)
+
+	topic, packetId, _, err := parseMqttPublish(packet)
+	assert.Nil(t, err)
+	assert.Equal(t, "apkdk/30000/100/measure/7", topic)
+
+	// Без подтверждения сообщение остается в буфере
+	assert.Equal(t, context.DeadlineExceeded, flushMqttTestPublisher(publisher, 100*time.Millisecond))
+
+	// После обрыва соединения сообщение передается повторно с тем же идентификатором и флагом DUP
+	assert.Nil(t, conn.Close())
+	conn, reader = accept()
+	defer conn.Close()
+
+	packet, err = readMqttPacket(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, getMqttPublishFlags(1, false, true), packet.flags)
+
+	_, resentPacketId, _, err := parseMqttPublish(packet)
+	assert.Nil(t, err)
+	assert.Equal(t, packetId, resentPacketId)
+
+	assert.Nil(t, writeMqttPacket(conn, mqttPacketPuback, 0, []byte{byte(packetId >> 8), byte(packetId)}))
+	assert.Nil(t, flushMqttTestPublisher(publisher, 5*time.Second))
+
+	assert.Nil(t, publisher.Close())
+
+	packet, err = readMqttPacket(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(mqttPacketDisconnect), packet.packetType)
+}
+
+func TestMqttPublisherBuffer(t *testing.T) {
+	// Брокер недоступен, при переполнении буфера отбрасываются самые старые сообщения
+	publisher, err := NewMqttPublisher(getMqttTestAddress(t), nil, WithMqttBufferSize(2),
+		WithMqttReconnectBackoff(time.Hour, time.Hour))
+	assert.Nil(t, err)
+
+	update := &MeasureUpdate{}
+	for i := 1; i <= 3; i++ {
+		update.Records = append(update.Records, &MeasureRecord{Time: time.Unix(5, 0), ObjectId: 100, MeasureId: i, StationId: 30000})
+	}
+
+	assert.Nil(t, publisher.PublishUpdate(update))
+	assert.Nil(t, publisher.PublishUpdate(update))
+	assert.Equal(t, uint64(4), publisher.Dropped())
+
+	publisher.lock.Lock()
+	assert.Len(t, publisher.queue, 2)
+	assert.Equal(t, "apkdk/30000/100/measure/2", publisher.queue[0].topic)
+	assert.Equal(t, "apkdk/30000/100/measure/3", publisher.queue[1].topic)
+	publisher.lock.Unlock()
+
+	// Close не ждет паузы перед переподключением
+	assert.Nil(t, publisher.Close())
+}
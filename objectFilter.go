@@ -0,0 +1,99 @@
+package archive
+
+// Отбор объектов, которые записываются в архив
+type objectFilter struct {
+	stations    map[int]bool
+	objectTypes map[int]bool
+	hosts       map[int]bool
+	// Объекты, которые записываются независимо от станции, типа и хоста
+	allowed map[int]bool
+	// Объекты, которые не записываются в любом случае
+	denied map[int]bool
+}
+
+func addFilterIds(set map[int]bool, ids []int) map[int]bool {
+	if set == nil {
+		set = make(map[int]bool)
+	}
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func (filter *objectFilter) isEmpty() bool {
+	return filter == nil || len(filter.stations) == 0 && len(filter.objectTypes) == 0 && len(filter.hosts) == 0 &&
+		len(filter.allowed) == 0 && len(filter.denied) == 0
+}
+
+func (filter *objectFilter) match(objectId int, stationId int, typeId int, hostId int) bool {
+	if filter.isEmpty() {
+		return true
+	}
+
+	if filter.denied[objectId] {
+		return false
+	}
+
+	if filter.allowed[objectId] {
+		return true
+	}
+
+	hasSelectors := len(filter.stations) != 0 || len(filter.objectTypes) != 0 || len(filter.hosts) != 0
+	if !hasSelectors {
+		// Если задан только список разрешенных объектов, остальные объекты не записываются
+		return len(filter.allowed) == 0
+	}
+
+	return (len(filter.stations) == 0 || filter.stations[stationId]) &&
+		(len(filter.objectTypes) == 0 || filter.objectTypes[typeId]) &&
+		(len(filter.hosts) == 0 || filter.hosts[hostId])
+}
+
+func (options *configurationOptions) getFilter() *objectFilter {
+	if options.filter == nil {
+		options.filter = &objectFilter{}
+	}
+	return options.filter
+}
+
+// WithStations оставляет в конфигурации только объекты указанных станций
+func WithStations(stationIds ...int) ConfigurationOption {
+	return func(options *configurationOptions) {
+		filter := options.getFilter()
+		filter.stations = addFilterIds(filter.stations, stationIds)
+	}
+}
+
+// WithObjectTypes оставляет в конфигурации только объекты указанных типов
+func WithObjectTypes(typeIds ...int) ConfigurationOption {
+	return func(options *configurationOptions) {
+		filter := options.getFilter()
+		filter.objectTypes = addFilterIds(filter.objectTypes, typeIds)
+	}
+}
+
+// WithHosts оставляет в конфигурации только объекты указанных хостов
+func WithHosts(hostIds ...int) ConfigurationOption {
+	return func(options *configurationOptions) {
+		filter := options.getFilter()
+		filter.hosts = addFilterIds(filter.hosts, hostIds)
+	}
+}
+
+// WithObjects добавляет объекты в конфигурацию независимо от отбора по станциям, типам и хостам.
+// Если других условий отбора нет, в конфигурации остаются только указанные объекты
+func WithObjects(objectIds ...int) ConfigurationOption {
+	return func(options *configurationOptions) {
+		filter := options.getFilter()
+		filter.allowed = addFilterIds(filter.allowed, objectIds)
+	}
+}
+
+// WithoutObjects исключает объекты из конфигурации
+func WithoutObjects(objectIds ...int) ConfigurationOption {
+	return func(options *configurationOptions) {
+		filter := options.getFilter()
+		filter.denied = addFilterIds(filter.denied, objectIds)
+	}
+}
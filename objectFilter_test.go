@@ -0,0 +1,120 @@
+package archive
+
+import (
+	configuration "github.com/imsat-spb/go-apkdk-configuration"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestObjectFilterMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ConfigurationOption
+		objectId int
+		expected bool
+	}{
+		{"noFilter", nil, 1, true},
+		{"station", []ConfigurationOption{WithStations(1000)}, 1, true},
+		{"otherStation", []ConfigurationOption{WithStations(2000)}, 1, false},
+		{"stationAndType", []ConfigurationOption{WithStations(1000), WithObjectTypes(2)}, 1, false},
+		{"host", []ConfigurationOption{WithHosts(175, 176)}, 1, true},
+		{"allowedOnly", []ConfigurationOption{WithObjects(2)}, 1, false},
+		{"allowedOverridesStation", []ConfigurationOption{WithStations(2000), WithObjects(1)}, 1, true},
+		{"denied", []ConfigurationOption{WithoutObjects(1)}, 1, false},
+		{"deniedOverridesAllowed", []ConfigurationOption{WithObjects(1), WithoutObjects(1)}, 1, false},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+			options := &configurationOptions{}
+			for _, opt := range test.opts {
+				opt(options)
+			}
+
+			assert.Equal(t, test.expected, options.filter.match(test.objectId, 1000, 1, 175))
+		})
+	}
+}
+
+func TestNewConfigurationInfoSubset(t *testing.T) {
+	project := getDiffTestProject()
+	project.Objects[2] = &configuration.ObjectInfo{Id: 2, TypeId: 1, StationId: 2000}
+
+	info, err := NewConfigurationInfo(project, WithStations(2000))
+
+	assert.Nil(t, err)
+	assert.True(t, info.isSubset)
+	assert.Len(t, info.Objects, 1)
+	assert.NotNil(t, info.Objects[2])
+	assert.Equal(t, []MeasureMappingInfo{
+		{ObjectId: 2, MeasureId: 100, DeviceId: 3, SensorId: 2, UnitOfMeasure: "В"}}, info.GetDeviceMappings(3))
+	// Отброшенные объекты не считаются ошибкой привязки
+	assert.False(t, info.GetValidationReport().HasFindings())
+
+	info, err = NewConfigurationInfo(project)
+
+	assert.Nil(t, err)
+	assert.False(t, info.isSubset)
+	assert.Len(t, info.Objects, 2)
+}
+
+func TestRuntimeSubsetDropsEvents(t *testing.T) {
+	const hostId = 800
+
+	info := NewRuntimeConfiguration(&ConfigurationInfo{
+		Objects: map[int]*ObjectInfo{
+			100: {objectId: 100, stationId: 30000, hostId: hostId},
+		},
+		isSubset: true,
+	})
+
+	now := time.Now()
+	eventsPackage := &core.DataPackage{
+		Time:     core.GetUnixMicrosecondsFromTime(now),
+		DeviceId: core.GetSpecialDeviceForHost(hostId),
+		Format:   core.PackageFormatEvents,
+		Data: []byte{
+			core.PackageEventTypeObjectState, 100, 0, 0, 0, 1, 0,
+			core.PackageEventTypeObjectState, 200, 0, 0, 0, 1, 0},
+		BitsPerSensor: 8,
+		DataSize:      14,
+		SensorCount:   14}
+
+	updateItem, err := info.updateFromPackage(eventsPackage)
+
+	assert.Nil(t, err)
+
+	update := updateItem.(*objectChangeEventUpdateEventInfo)
+	assert.Equal(t, map[uint32]uint16{100: 1}, update.events.ObjectStates)
+	assert.Equal(t, DroppedStatistics{Packages: 0, Events: 1}, info.GetDroppedStatistics())
+
+	// Пакет только с чужими объектами отбрасывается без ошибки
+	eventsPackage.Data = []byte{core.PackageEventTypeObjectState, 200, 0, 0, 0, 1, 0}
+	eventsPackage.DataSize = 7
+	eventsPackage.SensorCount = 7
+
+	res, err := info.GetUpdateRequestItemsFromPackage(eventsPackage)
+
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	assert.Equal(t, DroppedStatistics{Packages: 1, Events: 2}, info.GetDroppedStatistics())
+
+	// Полное состояние чужого хоста
+	fullStatePackage := &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(now),
+		DeviceId:      core.GetSpecialDeviceForHost(900),
+		Format:        core.PackageFormatFullObjectStates,
+		Data:          []byte{core.PackageEventTypeObjectState, 200, 0, 0, 0, 1, 0},
+		BitsPerSensor: 8,
+		DataSize:      7,
+		SensorCount:   7}
+
+	res, err = info.GetUpdateRequestItemsFromPackage(fullStatePackage)
+
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	assert.Equal(t, 2, info.GetDroppedStatistics().Packages)
+}
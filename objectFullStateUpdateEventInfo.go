@@ -1,24 +1,70 @@
 package archive
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"github.com/imsat-spb/go-apkdk-core"
 	"time"
 )
 
-type eventItemInfo struct {
-	Time     int64  `json:"time"`
-	RawData  string `json:"rawData"`
-	Stations []int  `json:"stations"`
-	DeviceId int32  `json:"deviceId"`
-	Format   byte   `json:"format"`
+// FullStateDocument документ архива с полным состоянием объектов (DocumentKindFullState)
+type FullStateDocument struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Time          int64           `json:"time"`
+	Stations      []int           `json:"stations"`
+	DeviceId      int32           `json:"deviceId"`
+	Format        byte            `json:"format"`
+	Sds           []StateEvent    `json:"sds,omitempty"`
+	Failures      []FailureEvent  `json:"failures,omitempty"`
+	Accidents     []AccidentEvent `json:"accidents,omitempty"`
+	rawDataFields
 }
 
 type objectFullStateUpdateEventInfo struct {
 	processingTime time.Time
 	packageInfo    *core.DataPackage
 	stations       []int
+	rawDataPolicy  RawDataPolicy
+	// Разобранное содержимое пакета, заполняется в зависимости от формата пакета
+	objectStates map[uint32]uint16
+	stateChanges map[uint32]*objectStateChange
+	failures     map[core.ObjectFailureKey]*core.ObjectFailureEventInfo
+	accidents    map[core.ObjectAccidentKey]*core.ObjectAccidentEventInfo
+}
+
+const accidentRecordSize = 26
+
+// В core нет разбора пакета полного состояния инцидентов, формат записи совпадает с записью в пакете событий
+func parseFullAccidentStatePackage(data *core.DataPackage) (map[core.ObjectAccidentKey]*core.ObjectAccidentEventInfo, error) {
+	if data.Format != core.PackageFormatFullAccidentStates {
+		return nil, fmt.Errorf("expected full accident package format")
+	}
+
+	if len(data.Data)%accidentRecordSize != 0 {
+		return nil, fmt.Errorf("accident full state message.events data size should be %d * nItems", accidentRecordSize)
+	}
+
+	var result = make(map[core.ObjectAccidentKey]*core.ObjectAccidentEventInfo)
+
+	for i := 0; i < len(data.Data)/accidentRecordSize; i++ {
+		record := data.Data[i*accidentRecordSize:]
+
+		if record[0] != core.PackageEventTypeAccidentInfo {
+			return nil, fmt.Errorf("unexpected marker %d in accident full state message", record[0])
+		}
+
+		accident := &core.ObjectAccidentEventInfo{
+			AccidentType: record[1],
+			AlgorithmId:  int32(binary.LittleEndian.Uint32(record[2:])),
+			ObjectId:     binary.LittleEndian.Uint32(record[6:]),
+			StartTime:    core.GetTimeFromUnixMicroseconds(binary.LittleEndian.Uint64(record[10:])),
+			EndTime:      core.GetTimeFromUnixMicroseconds(binary.LittleEndian.Uint64(record[18:]))}
+
+		result[core.ObjectAccidentKey{ObjectId: accident.ObjectId, AccidentId: accident.AlgorithmId}] = accident
+	}
+
+	return result, nil
 }
 
 func (update *objectFullStateUpdateEventInfo) getArchiveServerRequest() []*RequestItem {
@@ -39,17 +85,29 @@ func (update *objectFullStateUpdateEventInfo) getArchiveServerRequest() []*Reque
 		return nil
 	}
 
-	item := &eventItemInfo{
-		Time:     processingTime,
-		Stations: update.stations,
-		DeviceId: update.packageInfo.DeviceId,
-		Format:   update.packageInfo.Format,
-		RawData:  update.packageInfo.GetBase64String()}
+	item := &FullStateDocument{
+		SchemaVersion: DocumentSchemaVersion,
+		Time:          processingTime,
+		Stations:      update.stations,
+		DeviceId:      update.packageInfo.DeviceId,
+		Format:        update.packageInfo.Format}
+
+	item.Sds = getSdsEvents(update.objectStates, update.stateChanges)
+	item.Failures = getFailureEvents(update.failures)
+	item.Accidents = getAccidentEvents(update.accidents)
+
+	rawData, rawDataRequest := getRawData(update.rawDataPolicy, update.packageInfo, id, processingTime)
+	item.rawDataFields = rawData
 
 	itemBuf, err := json.Marshal(item)
 	if err != nil {
 		return nil
 	}
 
-	return []*RequestItem{{string(buf), string(itemBuf)}}
+	result := []*RequestItem{{string(buf), string(itemBuf)}}
+	if rawDataRequest != nil {
+		result = append(result, rawDataRequest)
+	}
+
+	return result
 }
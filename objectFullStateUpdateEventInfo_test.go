@@ -40,7 +40,7 @@ func TestObjectFullStateGetArchiveServerRequest(t *testing.T) {
 
 	item := res[0]
 
-	var eventInfo eventItemInfo
+	var eventInfo FullStateDocument
 	err := json.Unmarshal([]byte(item.item), &eventInfo)
 
 	assert.Nil(t, err)
@@ -92,3 +92,100 @@ func TestObjectFullStateNoStationsGetArchiveServerRequest(t *testing.T) {
 
 	assert.Nil(t, res)
 }
+
+func TestObjectFullStateDecodedGetArchiveServerRequest(t *testing.T) {
+
+	const objectId1 = 100
+	const objectId2 = 200
+	const stationId1 = 30000
+	const hostId = 800
+
+	const objectState1 byte = 10
+	const objectState2 byte = 17
+
+	aTime := time.Now()
+	testPackage := &core.DataPackage{
+		Time:     core.GetUnixMicrosecondsFromTime(aTime),
+		DeviceId: core.GetSpecialDeviceForHost(hostId),
+		Format:   core.PackageFormatFullObjectStates,
+		Data: []byte{
+			core.PackageEventTypeObjectState, objectId1, 0, 0, 0, objectState1, 0,
+			core.PackageEventTypeObjectState, objectId2, 0, 0, 0, objectState2, 0},
+		BitsPerSensor: 8,
+		DataSize:      14,
+		SensorCount:   14}
+
+	info := NewRuntimeConfiguration(&ConfigurationInfo{
+		Objects: map[int]*ObjectInfo{
+			objectId1: {objectId: objectId1, stationId: stationId1, hostId: hostId},
+		},
+	})
+
+	res, err := info.GetUpdateRequestItemsFromPackage(testPackage)
+
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+
+	var eventInfo FullStateDocument
+	err = json.Unmarshal([]byte(res[0].item), &eventInfo)
+
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []StateEvent{
+		{ObjectId: objectId1, StateId: uint16(objectState1)},
+		{ObjectId: objectId2, StateId: uint16(objectState2)},
+	}, eventInfo.Sds)
+	assert.Empty(t, eventInfo.Failures)
+	assert.Empty(t, eventInfo.Accidents)
+	assert.Equal(t, testPackage.GetBase64String(), eventInfo.RawData)
+}
+
+func TestParseFullAccidentStatePackage(t *testing.T) {
+	const objectId1 = 100
+
+	aTime := time.Now()
+	startTime, startBuf := getTimeAndSlice(aTime.Add(-time.Minute))
+
+	testData := append([]byte{core.PackageEventTypeAccidentInfo, 2}, getSliceFromInt32(15)...)
+	testData = append(testData, []byte{objectId1, 0, 0, 0}...)
+	testData = append(testData, startBuf...)
+	testData = append(testData, make([]byte, 8)...)
+
+	testPackage := &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(aTime),
+		DeviceId:      core.GetSpecialDeviceForHost(800),
+		Format:        core.PackageFormatFullAccidentStates,
+		Data:          testData,
+		BitsPerSensor: 8,
+		DataSize:      uint16(len(testData)),
+		SensorCount:   uint16(len(testData))}
+
+	accidents, err := parseFullAccidentStatePackage(testPackage)
+
+	assert.Nil(t, err)
+	assert.Len(t, accidents, 1)
+
+	accident := accidents[core.ObjectAccidentKey{ObjectId: objectId1, AccidentId: 15}]
+	assert.NotNil(t, accident)
+	assert.Equal(t, byte(2), accident.AccidentType)
+	assert.Equal(t, startTime, accident.StartTime)
+
+	updateResult := &objectFullStateUpdateEventInfo{packageInfo: testPackage, processingTime: aTime,
+		stations: []int{30000}, accidents: accidents}
+
+	res := updateResult.getArchiveServerRequest()
+	assert.Len(t, res, 1)
+
+	var eventInfo FullStateDocument
+	err = json.Unmarshal([]byte(res[0].item), &eventInfo)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []AccidentEvent{{
+		ObjectId:       objectId1,
+		AlgorithmId:    15,
+		AccidentTypeId: 2,
+		StartTime:      core.GetUnixMillisecondsFromTime(startTime)}}, eventInfo.Accidents)
+
+	testPackage.Data = testData[:len(testData)-1]
+	_, err = parseFullAccidentStatePackage(testPackage)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,338 @@
+package archive
+
+import (
+	"fmt"
+	goparquet "github.com/fraugster/parquet-go"
+	"github.com/fraugster/parquet-go/parquet"
+	"github.com/fraugster/parquet-go/parquetschema"
+	"github.com/imsat-spb/go-apkdk-core"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultParquetMaxFileSize     = 64 << 20
+	defaultParquetMaxRowGroupSize = 8 << 20
+)
+
+// Схема файла значений измерений и атрибутов
+const parquetMeasuresSchema = `message measures {
+	required int64 time (TIMESTAMP(MICROS, true));
+	required int32 deviceId;
+	required int32 sensorId;
+	required int32 objectId;
+	required int32 objectTypeId;
+	required int32 measureId;
+	required boolean isAttribute;
+	optional float value;
+	required binary unit (STRING);
+}`
+
+type parquetOptions struct {
+	maxFileSize     int
+	maxRowGroupSize int
+	maxFileDuration time.Duration
+	location        *time.Location
+	compression     parquet.CompressionCodec
+}
+
+// ParquetOption задает параметры ParquetSink
+type ParquetOption func(options *parquetOptions)
+
+// WithParquetMaxFileSize задает примерный размер файла, после которого начинается новый файл. По умолчанию 64 МБ
+func WithParquetMaxFileSize(size int) ParquetOption {
+	return func(options *parquetOptions) {
+		options.maxFileSize = size
+	}
+}
+
+// WithParquetMaxRowGroupSize задает примерный размер группы строк (row group), после которого группа
+// записывается в файл. По умолчанию 8 МБ
+func WithParquetMaxRowGroupSize(size int) ParquetOption {
+	return func(options *parquetOptions) {
+		options.maxRowGroupSize = size
+	}
+}
+
+// WithParquetCompression задает сжатие колонок. По умолчанию Snappy
+func WithParquetCompression(codec parquet.CompressionCodec) ParquetOption {
+	return func(options *parquetOptions) {
+		options.compression = codec
+	}
+}
+
+// WithParquetMaxFileDuration задает максимальный интервал времени значений в одном файле.
+// По умолчанию файл ограничен только датой
+func WithParquetMaxFileDuration(duration time.Duration) ParquetOption {
+	return func(options *parquetOptions) {
+		options.maxFileDuration = duration
+	}
+}
+
+// WithParquetLocation задает часовой пояс для разбиения файлов по датам. По умолчанию UTC
+func WithParquetLocation(location *time.Location) ParquetOption {
+	return func(options *parquetOptions) {
+		options.location = location
+	}
+}
+
+type parquetPartition struct {
+	date      string
+	stationId int
+}
+
+type parquetPartitionFile struct {
+	fileName  string
+	file      *os.File
+	writer    *goparquet.FileWriter
+	startTime time.Time
+}
+
+// ParquetSink записывает измененные значения измерений и атрибутов в файлы Apache Parquet.
+// Файлы разбиваются по дате и станции в каталоги <dir>/date=2006-01-02/station=<id>.
+// Колонки файла: time, deviceId, sensorId, objectId, objectTypeId, measureId, isAttribute, value, unit.
+// Неопределенное значение записывается как null. Значения записываются группами строк при достижении
+// размера группы и в Flush, файл появляется в каталоге после завершения при смене файла или в Close
+type ParquetSink struct {
+	dir        string
+	options    parquetOptions
+	lock       sync.Mutex
+	partitions map[parquetPartition]*parquetPartitionFile
+	files      []string
+	sequence   int
+	err        error
+}
+
+// NewParquetSink создает получателя значений, записывающего файлы в каталог dir
+func NewParquetSink(dir string, opts ...ParquetOption) *ParquetSink {
+	result := &ParquetSink{
+		dir:        dir,
+		partitions: make(map[parquetPartition]*parquetPartitionFile),
+		options: parquetOptions{
+			maxFileSize:     defaultParquetMaxFileSize,
+			maxRowGroupSize: defaultParquetMaxRowGroupSize,
+			location:        time.UTC,
+			compression:     parquet.CompressionCodec_SNAPPY}}
+
+	for _, opt := range opts {
+		opt(&result.options)
+	}
+
+	return result
+}
+
+func (sink *ParquetSink) openPartition(partition parquetPartition, startTime time.Time) (*parquetPartitionFile, error) {
+	schema, err := parquetschema.ParseSchemaDefinition(parquetMeasuresSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(sink.dir, "date="+partition.date, fmt.Sprintf("station=%d", partition.stationId))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	sink.sequence++
+	fileName := filepath.Join(dir, fmt.Sprintf("measures_%d_%d.parquet",
+		core.GetUnixMillisecondsFromTime(startTime), sink.sequence))
+
+	// Файл появляется в каталоге только после полной записи
+	file, err := os.Create(fileName + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	writer := goparquet.NewFileWriter(file,
+		goparquet.WithSchemaDefinition(schema),
+		goparquet.WithCompressionCodec(sink.options.compression),
+		goparquet.WithMaxRowGroupSize(int64(sink.options.maxRowGroupSize)),
+		goparquet.WithCreator("go-apkdk-archive"))
+
+	return &parquetPartitionFile{fileName: fileName, file: file, writer: writer, startTime: startTime}, nil
+}
+
+func (current *parquetPartitionFile) add(record *MeasureRecord) error {
+	data := map[string]interface{}{
+		"time":         record.Time.UnixNano() / int64(time.Microsecond),
+		"deviceId":     record.DeviceId,
+		"sensorId":     int32(record.SensorId),
+		"objectId":     int32(record.ObjectId),
+		"objectTypeId": int32(record.ObjectTypeId),
+		"measureId":    int32(record.MeasureId),
+		"isAttribute":  record.IsAttribute,
+		"unit":         []byte(record.Unit)}
+
+	if !core.IsNaN(record.Value) {
+		data["value"] = record.Value
+	}
+
+	return current.writer.AddData(data)
+}
+
+// Размер записанных групп строк и оценка размера текущей группы без сжатия
+func (current *parquetPartitionFile) size() int {
+	return int(current.writer.CurrentFileSize() + current.writer.CurrentRowGroupSize())
+}
+
+func (sink *ParquetSink) writePartition(partition parquetPartition) error {
+	current := sink.partitions[partition]
+	delete(sink.partitions, partition)
+
+	tempFileName := current.file.Name()
+
+	err := current.writer.Close()
+	if closeErr := current.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFileName, current.fileName)
+	}
+	if err != nil {
+		_ = os.Remove(tempFileName)
+		return err
+	}
+
+	sink.files = append(sink.files, current.fileName)
+	return nil
+}
+
+// writePartitions записывает файлы разделов, удовлетворяющих условию, в стабильном порядке
+func (sink *ParquetSink) writePartitions(match func(partition parquetPartition) bool) error {
+	var partitions []parquetPartition
+	for partition := range sink.partitions {
+		if match(partition) {
+			partitions = append(partitions, partition)
+		}
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].date != partitions[j].date {
+			return partitions[i].date < partitions[j].date
+		}
+		return partitions[i].stationId < partitions[j].stationId
+	})
+
+	for _, partition := range partitions {
+		if err := sink.writePartition(partition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sink *ParquetSink) writeRecord(record *MeasureRecord) error {
+	partition := parquetPartition{
+		date:      record.Time.In(sink.options.location).Format("2006-01-02"),
+		stationId: record.StationId}
+
+	current, ok := sink.partitions[partition]
+	if ok && sink.options.maxFileDuration > 0 && !record.Time.Before(current.startTime.Add(sink.options.maxFileDuration)) {
+		if err := sink.writePartition(partition); err != nil {
+			return err
+		}
+		ok = false
+	}
+
+	if !ok {
+		var err error
+		if current, err = sink.openPartition(partition, record.Time); err != nil {
+			return err
+		}
+		sink.partitions[partition] = current
+	}
+
+	if err := current.add(record); err != nil {
+		return err
+	}
+
+	if current.size() >= sink.options.maxFileSize {
+		return sink.writePartition(partition)
+	}
+
+	return nil
+}
+
+// WriteUpdate добавляет измененные значения. Файлы предыдущих дат записываются при получении значений новой даты
+func (sink *ParquetSink) WriteUpdate(update *MeasureUpdate) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	for _, record := range update.Records {
+		date := record.Time.In(sink.options.location).Format("2006-01-02")
+
+		err := sink.writePartitions(func(partition parquetPartition) bool {
+			return partition.date < date
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = sink.writeRecord(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Listener возвращает получателя для WithMeasureListener. Первая ошибка записи
+// сохраняется и возвращается из Close, последующие значения не записываются
+func (sink *ParquetSink) Listener() MeasureListener {
+	return func(update *MeasureUpdate) {
+		sink.lock.Lock()
+		failed := sink.err != nil
+		sink.lock.Unlock()
+
+		if failed {
+			return
+		}
+
+		if err := sink.WriteUpdate(update); err != nil {
+			sink.lock.Lock()
+			sink.err = err
+			sink.lock.Unlock()
+		}
+	}
+}
+
+// Flush записывает накопленные значения незавершенных файлов отдельными группами строк
+func (sink *ParquetSink) Flush() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	for _, current := range sink.partitions {
+		if err := current.writer.FlushRowGroup(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close записывает все незавершенные файлы
+func (sink *ParquetSink) Close() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	err := sink.writePartitions(func(partition parquetPartition) bool {
+		return true
+	})
+
+	if sink.err != nil {
+		return sink.err
+	}
+
+	return err
+}
+
+// Files возвращает имена записанных файлов в порядке записи
+func (sink *ParquetSink) Files() []string {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	return append([]string(nil), sink.files...)
+}
@@ -0,0 +1,195 @@
+package archive
+
+import (
+	"encoding/binary"
+	goparquet "github.com/fraugster/parquet-go"
+	"github.com/fraugster/parquet-go/parquet"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Файл читается независимой реализацией Parquet, чтобы проверить совместимость формата
+func readParquetTestFile(t *testing.T, fileName string) ([]string, [][]interface{}) {
+	file, err := os.Open(fileName)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	reader, err := goparquet.NewFileReader(file)
+	assert.Nil(t, err)
+
+	var names []string
+	for _, column := range reader.GetSchemaDefinition().RootColumn.Children {
+		names = append(names, column.SchemaElement.Name)
+	}
+
+	var rows [][]interface{}
+	for {
+		data, err := reader.NextRow()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+
+		// Значение null отсутствует в строке
+		row := make([]interface{}, len(names))
+		for i, name := range names {
+			row[i] = data[name]
+			if value, ok := row[i].([]byte); ok {
+				row[i] = string(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	assert.Equal(t, reader.NumRows(), int64(len(rows)))
+
+	return names, rows
+}
+
+func TestParquetSinkFromRuntime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := NewParquetSink(dir)
+	info := getTestRuntimeConfiguration(WithMeasureListener(sink.Listener()))
+
+	firstTime := time.Date(2024, 1, 1, 23, 59, 59, 500000000, time.UTC)
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(firstTime, []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+	assert.Empty(t, sink.Files())
+
+	// Значения новой даты завершают файлы предыдущей даты
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(firstTime.Add(750*time.Millisecond), []byte{0, 0, 0, 0x80}))
+	assert.Nil(t, err)
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(firstTime.Add(2*time.Second), []byte{0xc4, 0x09, 0, 0}))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		filepath.Join(dir, "date=2024-01-01", "station=30000", "measures_1704153599500_1.parquet"),
+		filepath.Join(dir, "date=2024-01-01", "station=33000", "measures_1704153599500_2.parquet"),
+	}, sink.Files())
+
+	assert.Nil(t, sink.Close())
+	files := sink.Files()
+	assert.Len(t, files, 4)
+	assert.Equal(t, filepath.Join(dir, "date=2024-01-02", "station=30000", "measures_1704153600250_3.parquet"), files[2])
+
+	names, rows := readParquetTestFile(t, files[0])
+	assert.Equal(t, []string{"time", "deviceId", "sensorId", "objectId", "objectTypeId", "measureId", "isAttribute", "value", "unit"}, names)
+	assert.Equal(t, [][]interface{}{
+		{int64(1704153599500000), int32(5), int32(1), int32(100), int32(0), int32(7), false, float32(1), "В"},
+	}, rows)
+
+	_, rows = readParquetTestFile(t, files[2])
+	assert.Equal(t, [][]interface{}{
+		{int64(1704153600250000), int32(5), int32(1), int32(100), int32(0), int32(7), false, nil, "В"},
+		{int64(1704153601500000), int32(5), int32(1), int32(100), int32(0), int32(7), false, float32(2.5), "В"},
+	}, rows)
+
+	_, rows = readParquetTestFile(t, files[3])
+	assert.Equal(t, [][]interface{}{
+		{int64(1704153600250000), int32(5), int32(1), int32(200), int32(0), int32(8), true, nil, ""},
+		{int64(1704153601500000), int32(5), int32(1), int32(200), int32(0), int32(8), true, float32(2.5), ""},
+	}, rows)
+
+	// Временные файлы не остаются
+	tempFiles, err := filepath.Glob(filepath.Join(dir, "*", "*", "*.tmp"))
+	assert.Nil(t, err)
+	assert.Empty(t, tempFiles)
+}
+
+func getParquetTestUpdate(now time.Time, values ...float32) *MeasureUpdate {
+	result := &MeasureUpdate{Time: now, DeviceId: 5}
+
+	for i, value := range values {
+		result.Records = append(result.Records, &MeasureRecord{
+			Time: now, ObjectId: 100, ObjectTypeId: 3, MeasureId: 7 + i, StationId: 30000,
+			DeviceId: 5, SensorId: uint16(i + 1), Value: value})
+	}
+
+	return result
+}
+
+func TestParquetSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	sink := NewParquetSink(dir, WithParquetMaxFileDuration(time.Minute))
+	assert.Nil(t, sink.WriteUpdate(getParquetTestUpdate(now, 1)))
+	assert.Nil(t, sink.WriteUpdate(getParquetTestUpdate(now.Add(30*time.Second), 2)))
+	assert.Nil(t, sink.WriteUpdate(getParquetTestUpdate(now.Add(time.Minute), 3)))
+	assert.Nil(t, sink.Close())
+
+	files := sink.Files()
+	assert.Len(t, files, 2)
+	_, rows := readParquetTestFile(t, files[0])
+	assert.Len(t, rows, 2)
+	_, rows = readParquetTestFile(t, files[1])
+	assert.Equal(t, [][]interface{}{
+		{int64(1704103260000000), int32(5), int32(1), int32(100), int32(3), int32(7), false, float32(3), ""},
+	}, rows)
+
+	// Файл завершается при достижении размера
+	sink = NewParquetSink(dir, WithParquetMaxFileSize(120))
+	assert.Nil(t, sink.WriteUpdate(getParquetTestUpdate(now, 1, 2, core.GetNaN())))
+	assert.Len(t, sink.Files(), 0)
+	assert.Nil(t, sink.WriteUpdate(getParquetTestUpdate(now.Add(time.Second), 4, 5, 6)))
+	assert.Len(t, sink.Files(), 1)
+	assert.Nil(t, sink.Close())
+	assert.Len(t, sink.Files(), 2)
+
+	_, rows = readParquetTestFile(t, sink.Files()[0])
+	assert.Len(t, rows, 4)
+	assert.Nil(t, rows[2][7])
+	assert.Equal(t, int32(9), rows[2][5])
+}
+
+func TestParquetSinkRowGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// Каждый вызов Flush записывает отдельную группу строк
+	sink := NewParquetSink(dir)
+	assert.Nil(t, sink.WriteUpdate(getParquetTestUpdate(now, 1, core.GetNaN())))
+	assert.Nil(t, sink.Flush())
+	assert.Nil(t, sink.WriteUpdate(getParquetTestUpdate(now.Add(time.Second), 3)))
+	assert.Nil(t, sink.Close())
+
+	files := sink.Files()
+	assert.Len(t, files, 1)
+
+	file, err := os.Open(files[0])
+	assert.Nil(t, err)
+	defer file.Close()
+
+	meta, err := goparquet.ReadFileMetaData(file, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), meta.NumRows)
+	assert.Len(t, meta.RowGroups, 2)
+	assert.Equal(t, int64(2), meta.RowGroups[0].NumRows)
+
+	// Колонки сжаты и содержат статистику значений
+	timeColumn := meta.RowGroups[0].Columns[0].MetaData
+	assert.Equal(t, parquet.CompressionCodec_SNAPPY, timeColumn.Codec)
+	assert.Equal(t, uint64(1704103200000000), binary.LittleEndian.Uint64(timeColumn.Statistics.MinValue))
+
+	valueColumn := meta.RowGroups[0].Columns[7].MetaData
+	assert.Equal(t, int64(1), *valueColumn.Statistics.NullCount)
+
+	_, rows := readParquetTestFile(t, files[0])
+	assert.Len(t, rows, 3)
+	assert.Equal(t, float32(3), rows[2][7])
+}
@@ -0,0 +1,314 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PostgresConnection соединение с PostgreSQL или TimescaleDB. Временные таблицы загрузки
+// создаются в сессии соединения, поэтому все вызовы должны выполняться в одной сессии.
+// Для pgx.Conn CopyFrom реализуется вызовом conn.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+type PostgresConnection interface {
+	Exec(ctx context.Context, sql string) error
+	CopyFrom(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error)
+}
+
+type postgresColumn struct {
+	name    string
+	sqlType string
+}
+
+type postgresTable struct {
+	name       string
+	columns    []postgresColumn
+	primaryKey []string
+}
+
+// Общие колонки всех таблиц. Идентификатор документа архива вместе с ключом записи
+// в документе образуют первичный ключ, что делает повторную загрузку документов безопасной.
+// События документа собираются по ключам объекта, поэтому документ содержит не больше одного
+// состояния объекта, одного события каждого отказа объекта и одной аварии каждого алгоритма объекта
+var postgresDocumentColumns = []postgresColumn{
+	{"time", "timestamptz NOT NULL"},
+	{"document_id", "text NOT NULL"},
+	{"device_id", "integer NOT NULL"},
+	{"stations", "integer[] NOT NULL"}}
+
+const (
+	postgresMeasuresTable     = "apkdk_measures"
+	postgresAttributesTable   = "apkdk_attributes"
+	postgresObjectStatesTable = "apkdk_object_states"
+	postgresFailuresTable     = "apkdk_failures"
+	postgresAccidentsTable    = "apkdk_accidents"
+)
+
+var postgresTables = []*postgresTable{
+	{
+		name: postgresMeasuresTable,
+		columns: append(postgresDocumentColumns[:len(postgresDocumentColumns):len(postgresDocumentColumns)],
+			postgresColumn{"object_id", "integer NOT NULL"},
+			postgresColumn{"object_type_id", "integer NOT NULL"},
+			postgresColumn{"measure_id", "integer NOT NULL"},
+			postgresColumn{"value", "real"},
+			postgresColumn{"unit", "text NOT NULL"}),
+		primaryKey: []string{"time", "document_id", "object_id", "measure_id"}},
+	{
+		name: postgresAttributesTable,
+		columns: append(postgresDocumentColumns[:len(postgresDocumentColumns):len(postgresDocumentColumns)],
+			postgresColumn{"object_id", "integer NOT NULL"},
+			postgresColumn{"object_type_id", "integer NOT NULL"},
+			postgresColumn{"attribute_id", "integer NOT NULL"},
+			postgresColumn{"value", "real"},
+			postgresColumn{"unit", "text NOT NULL"}),
+		primaryKey: []string{"time", "document_id", "object_id", "attribute_id"}},
+	{
+		name: postgresObjectStatesTable,
+		columns: append(postgresDocumentColumns[:len(postgresDocumentColumns):len(postgresDocumentColumns)],
+			postgresColumn{"full_state", "boolean NOT NULL"},
+			postgresColumn{"object_id", "bigint NOT NULL"},
+			postgresColumn{"state_id", "integer NOT NULL"},
+			postgresColumn{"state_name", "text NOT NULL"},
+			postgresColumn{"severity", "integer NOT NULL"},
+			postgresColumn{"prev_state_id", "integer"},
+			postgresColumn{"prev_state_name", "text NOT NULL"}),
+		primaryKey: []string{"time", "document_id", "object_id"}},
+	{
+		name: postgresFailuresTable,
+		columns: append(postgresDocumentColumns[:len(postgresDocumentColumns):len(postgresDocumentColumns)],
+			postgresColumn{"full_state", "boolean NOT NULL"},
+			postgresColumn{"object_id", "bigint NOT NULL"},
+			postgresColumn{"failure_id", "bigint NOT NULL"},
+			postgresColumn{"is_started", "boolean NOT NULL"},
+			postgresColumn{"failure_time", "timestamptz NOT NULL"}),
+		primaryKey: []string{"time", "document_id", "object_id", "failure_id"}},
+	{
+		name: postgresAccidentsTable,
+		columns: append(postgresDocumentColumns[:len(postgresDocumentColumns):len(postgresDocumentColumns)],
+			postgresColumn{"full_state", "boolean NOT NULL"},
+			postgresColumn{"object_id", "bigint NOT NULL"},
+			postgresColumn{"algorithm_id", "integer NOT NULL"},
+			postgresColumn{"accident_type", "smallint NOT NULL"},
+			postgresColumn{"start_time", "timestamptz NOT NULL"},
+			postgresColumn{"end_time", "timestamptz"}),
+		primaryKey: []string{"time", "document_id", "object_id", "algorithm_id"}},
+}
+
+func (table *postgresTable) getColumnNames() []string {
+	result := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		result[i] = column.name
+	}
+	return result
+}
+
+func (table *postgresTable) getStageName() string {
+	return table.name + "_stage"
+}
+
+// GetPostgresSchema возвращает DDL таблиц. Для TimescaleDB таблицы преобразуются в гипертаблицы по колонке time
+func GetPostgresSchema(timescale bool) []string {
+	var result []string
+
+	for _, table := range postgresTables {
+		var builder strings.Builder
+
+		builder.WriteString("CREATE TABLE IF NOT EXISTS ")
+		builder.WriteString(table.name)
+		builder.WriteString(" (\n")
+		for _, column := range table.columns {
+			builder.WriteString(fmt.Sprintf("\t%s %s,\n", column.name, column.sqlType))
+		}
+		builder.WriteString(fmt.Sprintf("\tPRIMARY KEY (%s)\n)", strings.Join(table.primaryKey, ", ")))
+
+		result = append(result, builder.String())
+
+		if timescale {
+			result = append(result, fmt.Sprintf("SELECT create_hypertable('%s', 'time', if_not_exists => TRUE)", table.name))
+		}
+	}
+
+	return result
+}
+
+type postgresTableRows struct {
+	table *postgresTable
+	rows  [][]interface{}
+}
+
+type postgresRows map[string]*postgresTableRows
+
+func (rows postgresRows) add(table string, values ...interface{}) {
+	rows[table].rows = append(rows[table].rows, values)
+}
+
+func getPostgresTime(ms int64) time.Time {
+	return getTimeFromUnixMilliseconds(ms).UTC()
+}
+
+// getPostgresStations возвращает упорядоченный список станций: порядок станций в документе не определен
+func getPostgresStations(stations []int) []int32 {
+	result := make([]int32, len(stations))
+	for i, stationId := range stations {
+		result[i] = int32(stationId)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+func getPostgresValue(value *float32) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func (rows postgresRows) addStateEvents(header []interface{}, fullState bool,
+	sds []StateEvent, failures []FailureEvent, accidents []AccidentEvent) {
+
+	for _, e := range sds {
+		var prevStateId interface{}
+		if e.PrevStateId != nil {
+			prevStateId = int32(*e.PrevStateId)
+		}
+
+		rows.add(postgresObjectStatesTable, append(header, fullState, int64(e.ObjectId), int32(e.StateId),
+			e.StateName, int32(e.Severity), prevStateId, e.PrevStateName)...)
+	}
+
+	for _, e := range failures {
+		rows.add(postgresFailuresTable, append(header, fullState, int64(e.ObjectId), int64(e.Fault),
+			e.IsStarted, getPostgresTime(e.FailureTime))...)
+	}
+
+	for _, e := range accidents {
+		var endTime interface{}
+		if e.EndTime != 0 {
+			endTime = getPostgresTime(e.EndTime)
+		}
+
+		rows.add(postgresAccidentsTable, append(header, fullState, int64(e.ObjectId), e.AlgorithmId,
+			int16(e.AccidentTypeId), getPostgresTime(e.StartTime), endTime)...)
+	}
+}
+
+// getPostgresRows преобразует документы архива в строки таблиц. Документы других индексов
+// и события АНР и АП пропускаются
+func getPostgresRows(items []*RequestItem) (postgresRows, error) {
+	result := make(postgresRows)
+	for _, table := range postgresTables {
+		result[table.name] = &postgresTableRows{table: table}
+	}
+
+	for _, item := range items {
+		var rq map[string]*createRequest
+		if err := json.Unmarshal([]byte(item.request), &rq); err != nil {
+			return nil, err
+		}
+
+		action := getRequestAction(rq)
+		if action == nil || action.Index != defaultArchiveIndex {
+			continue
+		}
+
+		decoded, err := DecodeDocument([]byte(item.item))
+		if err != nil {
+			return nil, err
+		}
+
+		// Литерал общих колонок не имеет запаса емкости, поэтому append создает для каждой строки новый срез
+		switch doc := decoded.(type) {
+		case *MeasuresDocument:
+			header := []interface{}{getPostgresTime(doc.Time), action.Id, doc.DeviceId, getPostgresStations(doc.Stations)}
+			for _, m := range doc.Measures {
+				result.add(postgresMeasuresTable, append(header, int32(m.ObjectId), int32(m.ObjectTypeId),
+					int32(m.MeasureId), getPostgresValue(m.Value), m.Unit)...)
+			}
+			for _, a := range doc.Attributes {
+				result.add(postgresAttributesTable, append(header, int32(a.ObjectId), int32(a.ObjectTypeId),
+					int32(a.AttributeId), getPostgresValue(a.Value), a.Unit)...)
+			}
+		case *EventsDocument:
+			header := []interface{}{getPostgresTime(doc.Time), action.Id, doc.DeviceId, getPostgresStations(doc.Stations)}
+			result.addStateEvents(header, false, doc.Sds, doc.Failures, doc.Accidents)
+		case *FullStateDocument:
+			header := []interface{}{getPostgresTime(doc.Time), action.Id, doc.DeviceId, getPostgresStations(doc.Stations)}
+			result.addStateEvents(header, true, doc.Sds, doc.Failures, doc.Accidents)
+		}
+	}
+
+	return result, nil
+}
+
+// PostgresSink загружает документы архива в нормализованные таблицы PostgreSQL или TimescaleDB
+// по протоколу COPY. Строки загружаются во временные таблицы и переносятся в основные таблицы
+// с пропуском уже загруженных строк, поэтому повторная загрузка документов не создает дубликатов
+type PostgresSink struct {
+	conn PostgresConnection
+}
+
+// NewPostgresSink создает получателя документов для соединения conn
+func NewPostgresSink(conn PostgresConnection) *PostgresSink {
+	return &PostgresSink{conn: conn}
+}
+
+// CreateTables создает таблицы, если они не существуют
+func (sink *PostgresSink) CreateTables(ctx context.Context, timescale bool) error {
+	for _, statement := range GetPostgresSchema(timescale) {
+		if err := sink.conn.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *PostgresSink) copyRows(ctx context.Context, tableRows *postgresTableRows) error {
+	table := tableRows.table
+	stage := table.getStageName()
+
+	statements := []string{
+		fmt.Sprintf("CREATE TEMP TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS)", stage, table.name),
+		fmt.Sprintf("TRUNCATE %s", stage)}
+
+	for _, statement := range statements {
+		if err := sink.conn.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	count, err := sink.conn.CopyFrom(ctx, stage, table.getColumnNames(), tableRows.rows)
+	if err != nil {
+		return err
+	}
+
+	if count != int64(len(tableRows.rows)) {
+		return fmt.Errorf("copy to %s: expected %d rows, copied %d", stage, len(tableRows.rows), count)
+	}
+
+	return sink.conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s SELECT * FROM %s ON CONFLICT DO NOTHING", table.name, stage))
+}
+
+// WriteRequestItems загружает документы, сформированные RuntimeConfiguration.
+// PostgresSink может использоваться как получатель Replay
+func (sink *PostgresSink) WriteRequestItems(ctx context.Context, items []*RequestItem) error {
+	rows, err := getPostgresRows(items)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range postgresTables {
+		tableRows := rows[table.name]
+		if len(tableRows.rows) == 0 {
+			continue
+		}
+
+		if err = sink.copyRows(ctx, tableRows); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
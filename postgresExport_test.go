@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Замена базы данных: хранит строки таблиц по первичному ключу
+type testPostgresConnection struct {
+	statements []string
+	stages     map[string][][]interface{}
+	tables     map[string]map[string][]interface{}
+}
+
+func newTestPostgresConnection() *testPostgresConnection {
+	return &testPostgresConnection{
+		stages: make(map[string][][]interface{}),
+		tables: make(map[string]map[string][]interface{})}
+}
+
+func getTestPostgresTable(name string) *postgresTable {
+	for _, table := range postgresTables {
+		if table.name == name {
+			return table
+		}
+	}
+	return nil
+}
+
+func (conn *testPostgresConnection) Exec(ctx context.Context, sql string) error {
+	conn.statements = append(conn.statements, sql)
+
+	var tableName, stageName string
+	if n, _ := fmt.Sscanf(sql, "TRUNCATE %s", &stageName); n == 1 {
+		delete(conn.stages, stageName)
+		return nil
+	}
+
+	if n, _ := fmt.Sscanf(sql, "INSERT INTO %s SELECT * FROM %s ON CONFLICT DO NOTHING", &tableName, &stageName); n != 2 {
+		return nil
+	}
+
+	table := getTestPostgresTable(tableName)
+	if conn.tables[tableName] == nil {
+		conn.tables[tableName] = make(map[string][]interface{})
+	}
+
+	for _, row := range conn.stages[stageName] {
+		var key []string
+		for _, keyColumn := range table.primaryKey {
+			for i, column := range table.columns {
+				if column.name == keyColumn {
+					key = append(key, fmt.Sprint(row[i]))
+				}
+			}
+		}
+
+		if _, ok := conn.tables[tableName][strings.Join(key, "|")]; !ok {
+			conn.tables[tableName][strings.Join(key, "|")] = row
+		}
+	}
+
+	return nil
+}
+
+func (conn *testPostgresConnection) CopyFrom(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	target := getTestPostgresTable(strings.TrimSuffix(table, "_stage"))
+	if target == nil {
+		return 0, fmt.Errorf("unknown table %s", table)
+	}
+
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			return 0, fmt.Errorf("row size %d, expected %d", len(row), len(columns))
+		}
+	}
+
+	conn.stages[table] = append(conn.stages[table], rows...)
+	return int64(len(rows)), nil
+}
+
+func getTestEventRequestItem(id string, doc string) *RequestItem {
+	return &RequestItem{
+		request: fmt.Sprintf(`{"create":{"_index":"events","_id":"%s","_type":"_doc"}}`, id),
+		item:    strings.Replace(doc, "{", fmt.Sprintf(`{"schemaVersion":%d,`, DocumentSchemaVersion), 1)}
+}
+
+func TestGetPostgresSchema(t *testing.T) {
+	statements := GetPostgresSchema(false)
+	assert.Len(t, statements, 5)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS apkdk_measures (\n"+
+		"\ttime timestamptz NOT NULL,\n"+
+		"\tdocument_id text NOT NULL,\n"+
+		"\tdevice_id integer NOT NULL,\n"+
+		"\tstations integer[] NOT NULL,\n"+
+		"\tobject_id integer NOT NULL,\n"+
+		"\tobject_type_id integer NOT NULL,\n"+
+		"\tmeasure_id integer NOT NULL,\n"+
+		"\tvalue real,\n"+
+		"\tunit text NOT NULL,\n"+
+		"\tPRIMARY KEY (time, document_id, object_id, measure_id)\n)", statements[0])
+
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS apkdk_failures (\n"+
+		"\ttime timestamptz NOT NULL,\n"+
+		"\tdocument_id text NOT NULL,\n"+
+		"\tdevice_id integer NOT NULL,\n"+
+		"\tstations integer[] NOT NULL,\n"+
+		"\tfull_state boolean NOT NULL,\n"+
+		"\tobject_id bigint NOT NULL,\n"+
+		"\tfailure_id bigint NOT NULL,\n"+
+		"\tis_started boolean NOT NULL,\n"+
+		"\tfailure_time timestamptz NOT NULL,\n"+
+		"\tPRIMARY KEY (time, document_id, object_id, failure_id)\n)", statements[3])
+
+	statements = GetPostgresSchema(true)
+	assert.Len(t, statements, 10)
+	assert.Equal(t, "SELECT create_hypertable('apkdk_accidents', 'time', if_not_exists => TRUE)", statements[9])
+
+	conn := newTestPostgresConnection()
+	assert.Nil(t, NewPostgresSink(conn).CreateTables(context.Background(), true))
+	assert.Equal(t, statements, conn.statements)
+}
+
+func TestPostgresSink(t *testing.T) {
+	info := getTestRuntimeConfiguration()
+
+	items, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(1000, 0), []byte{0xc4, 0x09, 0, 0}))
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+
+	items = append(items,
+		getTestEventRequestItem("7_8_2000", `{"time":2000,"stations":[30000],"deviceId":7,"format":8,`+
+			`"sds":[{"objectId":100,"stateId":2,"stateName":"Занята","severity":1,"prevStateId":1,"prevStateName":"Свободна"}]}`),
+		getTestEventRequestItem("7_1_3000", `{"time":3000,"stations":[30000],"deviceId":7,"format":1,`+
+			`"failures":[{"objectId":100,"faultId":12,"isStarted":true,"failureTime":2900}],`+
+			`"accidents":[{"objectId":100,"algorithmId":4,"accidentType":1,"startTime":2950}]}`),
+		getTestEventRequestItem("7_6_4000", `{"time":4000,"stations":[30000],"deviceId":7,"format":6,`+
+			`"sds":[{"objectId":100,"stateId":2},{"objectId":101,"stateId":1}]}`),
+		// Документы других индексов пропускаются
+		&RequestItem{request: `{"create":{"_index":"rollups","_id":"x"}}`, item: `{}`})
+
+	conn := newTestPostgresConnection()
+	sink := NewPostgresSink(conn)
+
+	assert.Nil(t, sink.WriteRequestItems(context.Background(), items))
+
+	assert.Equal(t, []string{
+		"CREATE TEMP TABLE IF NOT EXISTS apkdk_measures_stage (LIKE apkdk_measures INCLUDING DEFAULTS)",
+		"TRUNCATE apkdk_measures_stage",
+		"INSERT INTO apkdk_measures SELECT * FROM apkdk_measures_stage ON CONFLICT DO NOTHING",
+	}, conn.statements[:3])
+	assert.Len(t, conn.statements, 15)
+
+	stations := []int32{30000}
+	measureTime := time.Unix(1000, 0).UTC()
+
+	assert.Equal(t, map[string][]interface{}{
+		fmt.Sprintf("%v|5_0_1000000|100|7", measureTime): {measureTime, "5_0_1000000", int32(5), []int32{30000, 33000},
+			int32(100), int32(0), int32(7), float32(2.5), "В"},
+	}, conn.tables[postgresMeasuresTable])
+	assert.Len(t, conn.tables[postgresAttributesTable], 1)
+
+	states := conn.tables[postgresObjectStatesTable]
+	assert.Len(t, states, 3)
+	assert.Equal(t, []interface{}{time.Unix(2, 0).UTC(), "7_8_2000", int32(7), stations,
+		false, int64(100), int32(2), "Занята", int32(1), int32(1), "Свободна"},
+		states[fmt.Sprintf("%v|7_8_2000|100", time.Unix(2, 0).UTC())])
+	assert.Equal(t, []interface{}{time.Unix(4, 0).UTC(), "7_6_4000", int32(7), stations,
+		true, int64(101), int32(1), "", int32(0), nil, ""},
+		states[fmt.Sprintf("%v|7_6_4000|101", time.Unix(4, 0).UTC())])
+
+	for _, row := range conn.tables[postgresFailuresTable] {
+		assert.Equal(t, []interface{}{time.Unix(3, 0).UTC(), "7_1_3000", int32(7), stations,
+			false, int64(100), int64(12), true, time.Unix(2, 900000000).UTC()}, row)
+	}
+	for _, row := range conn.tables[postgresAccidentsTable] {
+		assert.Equal(t, []interface{}{time.Unix(3, 0).UTC(), "7_1_3000", int32(7), stations,
+			false, int64(100), int32(4), int16(1), time.Unix(2, 950000000).UTC(), nil}, row)
+	}
+
+	// Повторная загрузка тех же документов не создает дубликатов
+	assert.Nil(t, sink.WriteRequestItems(context.Background(), items))
+	assert.Len(t, conn.tables[postgresMeasuresTable], 1)
+	assert.Len(t, conn.tables[postgresObjectStatesTable], 3)
+	assert.Len(t, conn.tables[postgresFailuresTable], 1)
+	assert.Len(t, conn.tables[postgresAccidentsTable], 1)
+}
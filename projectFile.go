@@ -0,0 +1,168 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-configuration"
+	"io/ioutil"
+	"regexp"
+	"sort"
+)
+
+// Имя файла вложенного проекта в файле проекта сервера, как в configuration
+var nestedProjectFileNamePattern = regexp.MustCompile(`^project_(\d+)_\d+\.zip$`)
+
+type projectFileNamedItem struct {
+	Id   int    `xml:"Id,attr"`
+	Name string `xml:"Name,attr"`
+}
+
+// Справочные сведения вложенного проекта, которые configuration.ProjectInformation не предоставляет
+type projectFileNested struct {
+	XMLName           xml.Name                               `xml:"Project"`
+	Stations          []projectFileNamedItem                 `xml:"Stations>Station"`
+	ObjectTypes       []projectFileNamedItem                 `xml:"ObjectTypes>ObjectType"`
+	ParameterMappings []configuration.ObjectParameterMapping `xml:"ObjectParameterMappings>ObjectParameterMapping"`
+	AttributeMappings []configuration.ObjectAttributeMapping `xml:"ObjectAttributeMappings>ObjectAttributeMapping"`
+}
+
+// ProjectInfo проект сервера, загруженный LoadProjectInfo. Кроме configuration.ProjectInformation
+// предоставляет названия станций и типов объектов (ProjectNamesInformation)
+// и привязки измерений в порядке описания с повторами (ProjectMappingsInformation)
+type ProjectInfo struct {
+	configuration.ProjectInformation
+	stationNames      map[int]string
+	objectTypeNames   map[int]string
+	parameterMappings []*configuration.ObjectParameterMapping
+	attributeMappings []*configuration.ObjectAttributeMapping
+}
+
+// GetStationName возвращает название станции или пустую строку
+func (project *ProjectInfo) GetStationName(id int) string {
+	return project.stationNames[id]
+}
+
+// GetObjectTypeName возвращает название типа объекта или пустую строку
+func (project *ProjectInfo) GetObjectTypeName(id int) string {
+	return project.objectTypeNames[id]
+}
+
+// GetParameterMappings возвращает привязки измерений всех вложенных проектов, включая повторы
+func (project *ProjectInfo) GetParameterMappings() []*configuration.ObjectParameterMapping {
+	return project.parameterMappings
+}
+
+// GetAttributeMappings возвращает привязки атрибутов всех вложенных проектов, включая повторы
+func (project *ProjectInfo) GetAttributeMappings() []*configuration.ObjectAttributeMapping {
+	return project.attributeMappings
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func readNestedProjectFile(file *zip.File, subProjectId string) (*projectFileNested, error) {
+	data, err := readZipFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read nested project %s: %v", file.Name, err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open nested project %s: %v", file.Name, err)
+	}
+
+	entryName := fmt.Sprintf("project_%s.prj", subProjectId)
+	for _, entry := range reader.File {
+		if entry.Name != entryName {
+			continue
+		}
+
+		data, err = readZipFile(entry)
+		if err != nil {
+			return nil, fmt.Errorf("read nested project %s: %v", file.Name, err)
+		}
+
+		var result projectFileNested
+		if err = xml.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("parse nested project %s: %v", file.Name, err)
+		}
+		return &result, nil
+	}
+
+	return nil, fmt.Errorf("nested project %s has no %s", file.Name, entryName)
+}
+
+// readNestedProjects читает вложенные проекты файла проекта сервера в порядке имен файлов
+func readNestedProjects(projectFilePath string) ([]*projectFileNested, error) {
+	reader, err := zip.OpenReader(projectFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	files := append([]*zip.File(nil), reader.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var result []*projectFileNested
+	for _, file := range files {
+		match := nestedProjectFileNamePattern.FindStringSubmatch(file.Name)
+		if match == nil {
+			continue
+		}
+
+		nested, err := readNestedProjectFile(file, match[1])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, nested)
+	}
+
+	return result, nil
+}
+
+// LoadProjectInfo загружает проект сервера из файла project_<id>_<version>.zip с помощью
+// configuration.LoadServerProjectInfo и дополнительно читает из вложенных проектов названия станций
+// и типов объектов и исходные списки привязок, которые configuration.ProjectInformation не предоставляет.
+// Для обогащения документов названиями (WithNames) и проверки повторных привязок проект загружается этой функцией
+func LoadProjectInfo(projectFilePath string) (*ProjectInfo, error) {
+	project, err := configuration.LoadServerProjectInfo(projectFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	nestedProjects, err := readNestedProjects(projectFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProjectInfo{
+		ProjectInformation: project,
+		stationNames:       make(map[int]string),
+		objectTypeNames:    make(map[int]string)}
+
+	for _, nested := range nestedProjects {
+		for _, station := range nested.Stations {
+			result.stationNames[station.Id] = station.Name
+		}
+		for _, objectType := range nested.ObjectTypes {
+			result.objectTypeNames[objectType.Id] = objectType.Name
+		}
+		for i := range nested.ParameterMappings {
+			result.parameterMappings = append(result.parameterMappings, &nested.ParameterMappings[i])
+		}
+		for i := range nested.AttributeMappings {
+			result.attributeMappings = append(result.attributeMappings, &nested.AttributeMappings[i])
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,211 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-configuration"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+const testServerProjectXml = `<Project>
+  <Hosts>
+    <Host Number="800">
+      <Inbound><Address Ip="127.0.0.1" Port="9000"/></Inbound>
+    </Host>
+  </Hosts>
+</Project>`
+
+// Вложенный проект: объект 100 на станции 30000, устройство 5, измерение 7 на датчике 1
+const testNestedProjectXml = `<Project>
+  <Objects>
+    <Object Id="100" Name="Стрелка 1" TypeId="10" StationId="30000"/>
+  </Objects>
+  <ObjectParameterTypes>
+    <ObjectParameter Id="7" Name="Напряжение" ShortName="U" UnitOfMeasure="Вольт,В"/>
+  </ObjectParameterTypes>
+  <ObjectParameterMappings>
+    <ObjectParameterMapping ParameterId="7" ObjectId="100" DeviceId="5" SensorId="1"/>
+  </ObjectParameterMappings>
+  <Hosts>
+    <Host Number="800">
+      <DataHub><Device ID="5" BitsOnSensor="32" SensorCount="10"/></DataHub>
+    </Host>
+  </Hosts>
+  <Stations>
+    <Station Id="30000" Name="Купчино"/>
+  </Stations>
+  <ObjectTypes>
+    <ObjectType Id="10" Name="Стрелка"/>
+  </ObjectTypes>
+  <ObjectsToHosts>
+    <Host HostId="800"><Object Id="100"/></Host>
+  </ObjectsToHosts>
+</Project>`
+
+func writeTestZipEntry(t *testing.T, writer *zip.Writer, name string, data []byte) {
+	w, err := writer.Create(name)
+	assert.Nil(t, err)
+	_, err = w.Write(data)
+	assert.Nil(t, err)
+}
+
+// writeTestProjectFile создает в каталоге файл проекта сервера project_1_1.zip с вложенными проектами
+// (идентификатор вложенного проекта на XML)
+func writeTestProjectFile(t *testing.T, dir string, nestedProjects map[int]string) string {
+	path := filepath.Join(dir, "project_1_1.zip")
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	writeTestZipEntry(t, writer, "project_1.prj", []byte(testServerProjectXml))
+
+	var ids []int
+	for id := range nestedProjects {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		var nested bytes.Buffer
+		nestedWriter := zip.NewWriter(&nested)
+		writeTestZipEntry(t, nestedWriter, fmt.Sprintf("project_%d.prj", id), []byte(nestedProjects[id]))
+		assert.Nil(t, nestedWriter.Close())
+
+		writeTestZipEntry(t, writer, fmt.Sprintf("project_%d_1.zip", id), nested.Bytes())
+	}
+
+	assert.Nil(t, writer.Close())
+	return path
+}
+
+func TestLoadProjectInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeTestProjectFile(t, dir, map[int]string{2: testNestedProjectXml})
+
+	project, err := LoadProjectInfo(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Купчино", project.GetStationName(30000))
+	assert.Equal(t, "Стрелка", project.GetObjectTypeName(10))
+	assert.Empty(t, project.GetStationName(1))
+
+	info, err := NewConfigurationInfo(project, WithNames())
+
+	assert.Nil(t, err)
+
+	m := info.mappings[5][1][0]
+	assert.Equal(t, "Стрелка 1", m.objectName)
+	assert.Equal(t, "U", m.measureOrAttributeName)
+	assert.Equal(t, "Стрелка", m.objectTypeName)
+	assert.Equal(t, "Купчино", m.stationName)
+
+	// Проект configuration не предоставляет названия станций и типов объектов
+	serverProject, err := configuration.LoadServerProjectInfo(path)
+
+	assert.Nil(t, err)
+
+	info, err = NewConfigurationInfo(serverProject, WithNames())
+
+	assert.Nil(t, info)
+	assert.Equal(t, ErrProjectNamesUnavailable, err)
+
+	info, err = NewConfigurationInfo(serverProject)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(info.mappings[5][1]))
+}
+
+func TestNestedProjectFileNamePattern(t *testing.T) {
+	assert.Equal(t, []string{"project_2_1.zip", "2"}, nestedProjectFileNamePattern.FindStringSubmatch("project_2_1.zip"))
+	assert.Nil(t, nestedProjectFileNamePattern.FindStringSubmatch("project_2_1xzip"))
+}
+
+func TestProjectObjectStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	project, err := configuration.LoadServerProjectInfo(writeTestProjectFile(t, dir, map[int]string{2: testNestedProjectXml}))
+
+	assert.Nil(t, err)
+
+	// Проект не содержит словаря состояний
+	info, err := NewConfigurationInfo(project)
+
+	assert.Nil(t, err)
+	assert.False(t, info.HasObjectStates())
+
+	states, err := LoadObjectStatesDictionary(bytes.NewBufferString(
+		`[{"typeId":10,"states":[{"id":1,"name":"Норма","severity":1},{"id":2,"name":"Отказ","severity":3}]}]`))
+
+	assert.Nil(t, err)
+
+	info, err = NewConfigurationInfo(project, WithObjectStates(states))
+
+	assert.Nil(t, err)
+	assert.True(t, info.HasObjectStates())
+	assert.Equal(t, &ObjectStateInfo{Id: 2, Name: "Отказ", Severity: 3}, info.objectStates[10][2])
+
+	_, err = LoadObjectStatesDictionary(bytes.NewBufferString(`{"typeId":10}`))
+	assert.NotNil(t, err)
+}
+
+// Второй вложенный проект повторно привязывает измерение 7 объекта 100 к датчику 2
+const testDuplicateNestedProjectXml = `<Project>
+  <ObjectParameterMappings>
+    <ObjectParameterMapping ParameterId="7" ObjectId="100" DeviceId="5" SensorId="2"/>
+  </ObjectParameterMappings>
+</Project>`
+
+func TestProjectDuplicateMappings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeTestProjectFile(t, dir, map[int]string{2: testNestedProjectXml, 3: testDuplicateNestedProjectXml})
+
+	project, err := LoadProjectInfo(path)
+
+	assert.Nil(t, err)
+	assert.Len(t, project.GetParameterMappings(), 2)
+
+	info, err := NewConfigurationInfo(project)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*MappingFinding{
+		{Reason: ReasonDuplicateMapping, ObjectId: 100, MeasureId: 7, DeviceId: 5, SensorId: 2},
+	}, info.GetValidationReport().Findings)
+
+	// Первое описание привязки остается в конфигурации
+	assert.Len(t, info.mappings[5][1], 1)
+	assert.Nil(t, info.mappings[5][2])
+
+	info, err = NewConfigurationInfo(project, WithStrictValidation())
+
+	assert.Nil(t, info)
+
+	var validationError *ValidationError
+	assert.True(t, errors.As(err, &validationError))
+	assert.Equal(t, ReasonDuplicateMapping, validationError.Report.Findings[0].Reason)
+
+	// configuration объединяет повторные привязки, повтор не определяется
+	serverProject, err := configuration.LoadServerProjectInfo(path)
+
+	assert.Nil(t, err)
+
+	info, err = NewConfigurationInfo(serverProject, WithStrictValidation())
+
+	assert.Nil(t, err)
+	assert.False(t, info.GetValidationReport().HasFindings())
+}
@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"time"
+)
+
+// PrometheusNaNPolicy определяет вывод неопределенных значений
+type PrometheusNaNPolicy int
+
+const (
+	// Неопределенные значения не выводятся
+	PrometheusNaNSkip PrometheusNaNPolicy = iota
+	// Для неопределенного значения выводится apkdk_measure_undefined со значением 1
+	PrometheusNaNFlag
+)
+
+type prometheusOptions struct {
+	stations    map[int]bool
+	objectTypes map[int]bool
+	nanPolicy   PrometheusNaNPolicy
+}
+
+// PrometheusOption задает параметры PrometheusCollector
+type PrometheusOption func(options *prometheusOptions)
+
+// WithPrometheusStations выводит только измерения объектов указанных станций
+func WithPrometheusStations(stationIds ...int) PrometheusOption {
+	return func(options *prometheusOptions) {
+		options.stations = addFilterIds(options.stations, stationIds)
+	}
+}
+
+// WithPrometheusObjectTypes выводит только измерения объектов указанных типов
+func WithPrometheusObjectTypes(typeIds ...int) PrometheusOption {
+	return func(options *prometheusOptions) {
+		options.objectTypes = addFilterIds(options.objectTypes, typeIds)
+	}
+}
+
+// WithPrometheusNaNPolicy задает вывод неопределенных значений. По умолчанию они не выводятся
+func WithPrometheusNaNPolicy(policy PrometheusNaNPolicy) PrometheusOption {
+	return func(options *prometheusOptions) {
+		options.nanPolicy = policy
+	}
+}
+
+// PrometheusCollector передает Prometheus последние известные значения измерений и атрибутов RuntimeConfiguration.
+// Реализует prometheus.Collector, регистрируется в prometheus.Registry и отдается через promhttp
+type PrometheusCollector struct {
+	runtimeConfig *RuntimeConfiguration
+	options       prometheusOptions
+	valueDesc     *prometheus.Desc
+	updateDesc    *prometheus.Desc
+	undefinedDesc *prometheus.Desc
+}
+
+// Метка measure или attribute пустая для значения другого вида, Prometheus не отличает пустую метку от отсутствующей
+var prometheusLabels = []string{"object", dictionaryKindMeasure, dictionaryKindAttribute, "station", "object_type", "unit"}
+
+// NewPrometheusCollector создает сборщик значений для Prometheus
+func NewPrometheusCollector(runtimeConfig *RuntimeConfiguration, opts ...PrometheusOption) *PrometheusCollector {
+	result := &PrometheusCollector{
+		runtimeConfig: runtimeConfig,
+		valueDesc: prometheus.NewDesc("apkdk_measure_value",
+			"Last known value of the measure or attribute.", prometheusLabels, nil),
+		updateDesc: prometheus.NewDesc("apkdk_measure_last_update_timestamp_seconds",
+			"Package time of the last value update.", prometheusLabels, nil),
+		undefinedDesc: prometheus.NewDesc("apkdk_measure_undefined",
+			"Equals 1 if the last value of the measure or attribute is undefined.", prometheusLabels, nil)}
+
+	for _, opt := range opts {
+		opt(&result.options)
+	}
+
+	return result
+}
+
+type prometheusSample struct {
+	labels     []string
+	value      float32
+	updateTime time.Time
+}
+
+func getPrometheusLabelValues(measureInfo *archiveMeasureOrAttributeInfo) []string {
+	id := strconv.Itoa(measureInfo.measureOrAttributeId)
+	measureId, attributeId := id, ""
+	if measureInfo.isAttribute {
+		measureId, attributeId = "", id
+	}
+
+	return []string{strconv.Itoa(measureInfo.objectId), measureId, attributeId, strconv.Itoa(measureInfo.stationId),
+		strconv.Itoa(measureInfo.objectTypeId), measureInfo.unitOfMeasure}
+}
+
+func (collector *PrometheusCollector) isAllowed(measureInfo *archiveMeasureOrAttributeInfo) bool {
+	options := &collector.options
+
+	return (len(options.stations) == 0 || options.stations[measureInfo.stationId]) &&
+		(len(options.objectTypes) == 0 || options.objectTypes[measureInfo.objectTypeId])
+}
+
+func (collector *PrometheusCollector) getSamples() []*prometheusSample {
+	runtimeConfig := collector.runtimeConfig
+
+	runtimeConfig.lock.Lock()
+	defer runtimeConfig.lock.Unlock()
+
+	var result []*prometheusSample
+
+	for _, deviceMapping := range runtimeConfig.mappings {
+		for _, item := range deviceMapping {
+			if !item.IsValueAssigned() {
+				continue
+			}
+
+			for _, measureInfo := range item.measures {
+				if !collector.isAllowed(measureInfo) {
+					continue
+				}
+
+				result = append(result, &prometheusSample{
+					labels:     getPrometheusLabelValues(measureInfo),
+					value:      item.currentValue,
+					updateTime: item.lastUpdateTime})
+			}
+		}
+	}
+
+	return result
+}
+
+// Describe реализует prometheus.Collector
+func (collector *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.valueDesc
+	ch <- collector.updateDesc
+
+	if collector.options.nanPolicy == PrometheusNaNFlag {
+		ch <- collector.undefinedDesc
+	}
+}
+
+// Collect реализует prometheus.Collector
+func (collector *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range collector.getSamples() {
+		updateTime := float64(core.GetUnixMillisecondsFromTime(s.updateTime)) / 1000
+
+		if !core.IsNaN(s.value) {
+			ch <- prometheus.MustNewConstMetric(collector.valueDesc, prometheus.GaugeValue, float64(s.value), s.labels...)
+			ch <- prometheus.MustNewConstMetric(collector.updateDesc, prometheus.GaugeValue, updateTime, s.labels...)
+			continue
+		}
+
+		if collector.options.nanPolicy == PrometheusNaNFlag {
+			ch <- prometheus.MustNewConstMetric(collector.updateDesc, prometheus.GaugeValue, updateTime, s.labels...)
+			ch <- prometheus.MustNewConstMetric(collector.undefinedDesc, prometheus.GaugeValue, 1, s.labels...)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getPrometheusTestRuntimeConfiguration(t *testing.T, value []byte) *RuntimeConfiguration {
+	info := getTestRuntimeConfiguration()
+
+	// Датчик 2 не привязан к измерениям и не выводится
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(1000, 500000000), value))
+	assert.Nil(t, err)
+
+	return info
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	collector := NewPrometheusCollector(getPrometheusTestRuntimeConfiguration(t, []byte{232, 3, 0, 0}))
+
+	assert.Nil(t, testutil.CollectAndCompare(collector, strings.NewReader(
+		"# HELP apkdk_measure_value Last known value of the measure or attribute.\n"+
+			"# TYPE apkdk_measure_value gauge\n"+
+			`apkdk_measure_value{attribute="",measure="7",object="100",object_type="0",station="30000",unit="В"} 1`+"\n"+
+			`apkdk_measure_value{attribute="8",measure="",object="200",object_type="0",station="33000",unit=""} 1`+"\n"+
+			"# HELP apkdk_measure_last_update_timestamp_seconds Package time of the last value update.\n"+
+			"# TYPE apkdk_measure_last_update_timestamp_seconds gauge\n"+
+			`apkdk_measure_last_update_timestamp_seconds{attribute="",measure="7",object="100",object_type="0",station="30000",unit="В"} 1000.5`+"\n"+
+			`apkdk_measure_last_update_timestamp_seconds{attribute="8",measure="",object="200",object_type="0",station="33000",unit=""} 1000.5`+"\n")))
+
+	// Сборщик регистрируется в реестре и отдается стандартным обработчиком
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, registry.Register(collector))
+
+	recorder := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `apkdk_measure_value{attribute="8",measure="",object="200",object_type="0",station="33000",unit=""} 1`)
+}
+
+func TestPrometheusCollectorStations(t *testing.T) {
+	collector := NewPrometheusCollector(getPrometheusTestRuntimeConfiguration(t, []byte{232, 3, 0, 0}),
+		WithPrometheusStations(33000))
+
+	assert.Nil(t, testutil.CollectAndCompare(collector, strings.NewReader(
+		"# HELP apkdk_measure_value Last known value of the measure or attribute.\n"+
+			"# TYPE apkdk_measure_value gauge\n"+
+			`apkdk_measure_value{attribute="8",measure="",object="200",object_type="0",station="33000",unit=""} 1`+"\n"),
+		"apkdk_measure_value"))
+
+	collector = NewPrometheusCollector(getPrometheusTestRuntimeConfiguration(t, []byte{232, 3, 0, 0}),
+		WithPrometheusObjectTypes(5))
+
+	assert.Equal(t, 0, testutil.CollectAndCount(collector))
+}
+
+func TestPrometheusCollectorNaN(t *testing.T) {
+	info := getPrometheusTestRuntimeConfiguration(t, []byte{0, 0, 0, 0x80})
+
+	assert.Equal(t, 0, testutil.CollectAndCount(NewPrometheusCollector(info)))
+
+	collector := NewPrometheusCollector(info, WithPrometheusNaNPolicy(PrometheusNaNFlag))
+
+	assert.Equal(t, 0, testutil.CollectAndCount(collector, "apkdk_measure_value"))
+	assert.Nil(t, testutil.CollectAndCompare(collector, strings.NewReader(
+		"# HELP apkdk_measure_undefined Equals 1 if the last value of the measure or attribute is undefined.\n"+
+			"# TYPE apkdk_measure_undefined gauge\n"+
+			`apkdk_measure_undefined{attribute="",measure="7",object="100",object_type="0",station="30000",unit="В"} 1`+"\n"+
+			`apkdk_measure_undefined{attribute="8",measure="",object="200",object_type="0",station="33000",unit=""} 1`+"\n"+
+			"# HELP apkdk_measure_last_update_timestamp_seconds Package time of the last value update.\n"+
+			"# TYPE apkdk_measure_last_update_timestamp_seconds gauge\n"+
+			`apkdk_measure_last_update_timestamp_seconds{attribute="",measure="7",object="100",object_type="0",station="30000",unit="В"} 1000.5`+"\n"+
+			`apkdk_measure_last_update_timestamp_seconds{attribute="8",measure="",object="200",object_type="0",station="33000",unit=""} 1000.5`+"\n")))
+}
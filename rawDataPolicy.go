@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/imsat-spb/go-apkdk-core"
+)
+
+// RawDataPolicy определяет, как исходный пакет сохраняется в документе архива
+type RawDataPolicy int
+
+const (
+	// Пакет всегда записывается в документ
+	RawDataAlways RawDataPolicy = iota
+	// Пакет не записывается в архив
+	RawDataNever
+	// Пакет записывается в документ только для пакетов полного состояния
+	RawDataFullStateOnly
+	// Пакет записывается в отдельный индекс, в документе остается ссылка и контрольная сумма
+	RawDataSeparate
+)
+
+// DocumentKind вид документа архива
+type DocumentKind int
+
+const (
+	// Документ с измерениями и атрибутами
+	DocumentKindMeasures DocumentKind = iota
+	// Документ с изменениями состояний и событиями
+	DocumentKindEvents
+	// Документ с полным состоянием
+	DocumentKindFullState
+)
+
+const rawDataIndex = "raw"
+
+type rawDataItemInfo struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Time          int64  `json:"time"`
+	RawData       string `json:"rawData"`
+	DeviceId      int32  `json:"deviceId"`
+	Format        byte   `json:"format"`
+	Checksum      string `json:"checksum"`
+}
+
+// Поля документа с исходным пакетом
+type rawDataFields struct {
+	RawData         string `json:"rawData,omitempty"`
+	RawDataId       string `json:"rawDataId,omitempty"`
+	RawDataChecksum string `json:"rawDataChecksum,omitempty"`
+}
+
+func isFullStatePackage(packageInfo *core.DataPackage) bool {
+	return packageInfo.Format == core.PackageFormatFullObjectStates ||
+		packageInfo.Format == core.PackageFormatFullFailureStates ||
+		packageInfo.Format == core.PackageFormatFullAccidentStates
+}
+
+func getRawDataChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Возвращает поля документа с исходным пакетом и, если пакет сохраняется отдельно, запрос на его запись
+func getRawData(policy RawDataPolicy, packageInfo *core.DataPackage, id string, processingTime int64) (rawDataFields, *RequestItem) {
+	switch policy {
+	case RawDataNever:
+		return rawDataFields{}, nil
+	case RawDataFullStateOnly:
+		if !isFullStatePackage(packageInfo) {
+			return rawDataFields{}, nil
+		}
+		return rawDataFields{RawData: packageInfo.GetBase64String()}, nil
+	case RawDataSeparate:
+		checksum := getRawDataChecksum(packageInfo.Bytes())
+
+		rq := map[string]*createRequest{"create": {DocType: "_doc", Index: rawDataIndex, Id: id}}
+
+		buf, err := json.Marshal(rq)
+		if err != nil {
+			return rawDataFields{}, nil
+		}
+
+		itemBuf, err := json.Marshal(&rawDataItemInfo{
+			SchemaVersion: DocumentSchemaVersion,
+			Time:          processingTime,
+			RawData:       packageInfo.GetBase64String(),
+			DeviceId:      packageInfo.DeviceId,
+			Format:        packageInfo.Format,
+			Checksum:      checksum})
+		if err != nil {
+			return rawDataFields{}, nil
+		}
+
+		return rawDataFields{RawDataId: id, RawDataChecksum: checksum}, &RequestItem{string(buf), string(itemBuf)}
+	default:
+		return rawDataFields{RawData: packageInfo.GetBase64String()}, nil
+	}
+}
+
+// Восстанавливает исходный пакет из поля rawData документа
+func decodeRawData(rawData string) (*core.DataPackage, error) {
+	buf, err := base64.StdEncoding.DecodeString(rawData)
+	if err != nil {
+		return nil, err
+	}
+
+	return readDataPackage(buf)
+}
+
+func readDataPackage(buf []byte) (*core.DataPackage, error) {
+	result := &core.DataPackage{}
+	if err := result.Read(bytes.NewReader(buf)); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package archive
+
+import (
+	"encoding/json"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGetRawData(t *testing.T) {
+	dataPackage := &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(time.Now()),
+		DeviceId:      100,
+		Format:        core.PackageFormatData,
+		Data:          []byte{1, 2, 3, 4},
+		BitsPerSensor: 8,
+		DataSize:      4,
+		SensorCount:   4}
+
+	fullStatePackage := &core.DataPackage{
+		Time:     dataPackage.Time,
+		DeviceId: 100,
+		Format:   core.PackageFormatFullObjectStates}
+
+	tests := []struct {
+		name            string
+		policy          RawDataPolicy
+		packageInfo     *core.DataPackage
+		expectedRawData string
+		expectedRequest bool
+	}{
+		{"always", RawDataAlways, dataPackage, dataPackage.GetBase64String(), false},
+		{"never", RawDataNever, dataPackage, "", false},
+		{"fullStateOnlyData", RawDataFullStateOnly, dataPackage, "", false},
+		{"fullStateOnlyFullState", RawDataFullStateOnly, fullStatePackage, fullStatePackage.GetBase64String(), false},
+		{"separate", RawDataSeparate, dataPackage, "", true},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+			fields, request := getRawData(test.policy, test.packageInfo, "id1", 1000)
+
+			assert.Equal(t, test.expectedRawData, fields.RawData)
+			assert.Equal(t, test.expectedRequest, request != nil)
+		})
+	}
+}
+
+func TestSeparateRawDataRequest(t *testing.T) {
+	dataPackage := &core.DataPackage{
+		DeviceId:      100,
+		Format:        core.PackageFormatData,
+		Data:          []byte{1, 2, 3, 4},
+		BitsPerSensor: 8,
+		DataSize:      4,
+		SensorCount:   4}
+
+	fields, request := getRawData(RawDataSeparate, dataPackage, "id1", 1000)
+
+	assert.Equal(t, "id1", fields.RawDataId)
+	assert.Equal(t, getRawDataChecksum(dataPackage.Bytes()), fields.RawDataChecksum)
+
+	var rq map[string]*createRequest
+	err := json.Unmarshal([]byte(request.request), &rq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, rawDataIndex, rq["create"].Index)
+	assert.Equal(t, "id1", rq["create"].Id)
+
+	var rawItem rawDataItemInfo
+	err = json.Unmarshal([]byte(request.item), &rawItem)
+
+	assert.Nil(t, err)
+	assert.Equal(t, dataPackage.GetBase64String(), rawItem.RawData)
+	assert.Equal(t, fields.RawDataChecksum, rawItem.Checksum)
+	assert.Equal(t, int64(1000), rawItem.Time)
+}
+
+func TestRuntimeRawDataPolicy(t *testing.T) {
+	const objectId1 = 100
+	const stationId1 = 30000
+	const hostId = 800
+
+	configInfo := &ConfigurationInfo{
+		Objects: map[int]*ObjectInfo{
+			objectId1: {objectId: objectId1, stationId: stationId1, hostId: hostId},
+		},
+	}
+
+	info := NewRuntimeConfiguration(configInfo,
+		WithRawDataPolicy(DocumentKindEvents, RawDataNever),
+		WithRawDataPolicy(DocumentKindFullState, RawDataSeparate))
+
+	eventsPackage := &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(time.Now()),
+		DeviceId:      core.GetSpecialDeviceForHost(hostId),
+		Format:        core.PackageFormatEvents,
+		Data:          []byte{core.PackageEventTypeObjectState, objectId1, 0, 0, 0, 1, 0},
+		BitsPerSensor: 8,
+		DataSize:      7,
+		SensorCount:   7}
+
+	res, err := info.GetUpdateRequestItemsFromPackage(eventsPackage)
+
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.NotContains(t, res[0].item, "rawData")
+
+	fullStatePackage := &core.DataPackage{
+		Time:          eventsPackage.Time,
+		DeviceId:      core.GetSpecialDeviceForHost(hostId),
+		Format:        core.PackageFormatFullObjectStates,
+		Data:          []byte{core.PackageEventTypeObjectState, objectId1, 0, 0, 0, 1, 0},
+		BitsPerSensor: 8,
+		DataSize:      7,
+		SensorCount:   7}
+
+	res, err = info.GetUpdateRequestItemsFromPackage(fullStatePackage)
+
+	assert.Nil(t, err)
+	assert.Len(t, res, 2)
+
+	var eventInfo FullStateDocument
+	err = json.Unmarshal([]byte(res[0].item), &eventInfo)
+
+	assert.Nil(t, err)
+	assert.Empty(t, eventInfo.RawData)
+	assert.NotEmpty(t, eventInfo.RawDataId)
+	assert.NotEmpty(t, eventInfo.RawDataChecksum)
+}
@@ -0,0 +1,461 @@
+package archive
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// ReplaySource источник документов архива для повторной обработки
+type ReplaySource interface {
+	// ReadReplayDocuments вызывает handler для документов в порядке возрастания времени
+	ReadReplayDocuments(ctx context.Context, handler func(document []byte) error) error
+}
+
+// ReplaySink получатель документов, сформированных при повторной обработке
+type ReplaySink interface {
+	WriteRequestItems(ctx context.Context, items []*RequestItem) error
+}
+
+// ReplayCheckpoint позиция последнего записанного документа, с которой продолжается повторная обработка
+type ReplayCheckpoint struct {
+	Time     int64 `json:"time"`
+	DeviceId int32 `json:"deviceId"`
+	Format   byte  `json:"format"`
+}
+
+// ReplayProgress состояние повторной обработки
+type ReplayProgress struct {
+	// Прочитано документов
+	Read int
+	// Обработано пакетов, включая пакеты до позиции продолжения
+	Replayed int
+	// Пропущено документов без исходного пакета
+	Skipped int
+	// Пакеты, которые не удалось восстановить или обработать
+	Failed int
+	// Записано запросов
+	Written    int
+	Checkpoint ReplayCheckpoint
+}
+
+type replayOptions struct {
+	index      string
+	batchSize  int
+	progress   func(progress ReplayProgress)
+	checkpoint *ReplayCheckpoint
+}
+
+// ReplayOption задает дополнительные параметры Replay
+type ReplayOption func(options *replayOptions)
+
+// WithReplayIndex задает индекс, в который записываются документы. По умолчанию документы записываются в индекс events
+func WithReplayIndex(index string) ReplayOption {
+	return func(options *replayOptions) {
+		options.index = index
+	}
+}
+
+// WithReplayBatchSize задает количество запросов, передаваемых получателю за один раз
+func WithReplayBatchSize(batchSize int) ReplayOption {
+	return func(options *replayOptions) {
+		options.batchSize = batchSize
+	}
+}
+
+// WithReplayProgress задает функцию, вызываемую после записи каждой порции запросов
+func WithReplayProgress(progress func(progress ReplayProgress)) ReplayOption {
+	return func(options *replayOptions) {
+		options.progress = progress
+	}
+}
+
+// WithReplayCheckpoint продолжает повторную обработку после позиции checkpoint.
+// Документы до этой позиции обрабатываются для восстановления состояния, но не записываются
+func WithReplayCheckpoint(checkpoint ReplayCheckpoint) ReplayOption {
+	return func(options *replayOptions) {
+		options.checkpoint = &checkpoint
+	}
+}
+
+type replayDocumentHeader struct {
+	Time            int64  `json:"time"`
+	DeviceId        int32  `json:"deviceId"`
+	Format          byte   `json:"format"`
+	Stations        []int  `json:"stations"`
+	RawData         string `json:"rawData"`
+	RawDataId       string `json:"rawDataId"`
+	RawDataChecksum string `json:"rawDataChecksum"`
+	// Контрольная сумма пакета в документе индекса raw
+	Checksum string `json:"checksum"`
+}
+
+// Документ индекса raw с исходным пакетом (RawDataSeparate)
+func (header *replayDocumentHeader) isRawDataDocument() bool {
+	return header.Stations == nil && header.Checksum != ""
+}
+
+// Документ ссылается на пакет в индексе raw, который источник должен подставить в поле rawData
+func (header *replayDocumentHeader) needsRawData() bool {
+	return header.RawData == "" && header.RawDataId != ""
+}
+
+// Добавляет в документ исходный пакет, прочитанный из индекса raw
+func setReplayRawData(document []byte, rawData string) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, err
+	}
+
+	buf, err := json.Marshal(rawData)
+	if err != nil {
+		return nil, err
+	}
+	doc["rawData"] = buf
+
+	return json.Marshal(doc)
+}
+
+func (checkpoint *ReplayCheckpoint) isAfter(header *replayDocumentHeader) bool {
+	if checkpoint.Time != header.Time {
+		return checkpoint.Time > header.Time
+	}
+	if checkpoint.DeviceId != header.DeviceId {
+		return checkpoint.DeviceId > header.DeviceId
+	}
+	return checkpoint.Format >= header.Format
+}
+
+// Переносит документ из индекса events в индекс повторной обработки, остальные индексы не меняются
+func retargetRequestItem(item *RequestItem, index string) (*RequestItem, error) {
+	var rq map[string]*createRequest
+
+	if err := json.Unmarshal([]byte(item.request), &rq); err != nil {
+		return nil, err
+	}
+
+	for _, action := range rq {
+		if action.Index == defaultArchiveIndex {
+			action.Index = index
+		}
+	}
+
+	buf, err := json.Marshal(rq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RequestItem{string(buf), item.item}, nil
+}
+
+type replay struct {
+	runtimeConfig *RuntimeConfiguration
+	sink          ReplaySink
+	options       replayOptions
+	progress      ReplayProgress
+	batch         []*RequestItem
+	batchEnd      ReplayCheckpoint
+}
+
+func (r *replay) flush(ctx context.Context) error {
+	if len(r.batch) == 0 {
+		return nil
+	}
+
+	if err := r.sink.WriteRequestItems(ctx, r.batch); err != nil {
+		return err
+	}
+
+	r.progress.Written += len(r.batch)
+	r.progress.Checkpoint = r.batchEnd
+	r.batch = nil
+
+	if r.options.progress != nil {
+		r.options.progress(r.progress)
+	}
+
+	return nil
+}
+
+func (r *replay) handle(ctx context.Context, document []byte) error {
+	r.progress.Read++
+
+	var header replayDocumentHeader
+	if err := json.Unmarshal(document, &header); err != nil {
+		r.progress.Failed++
+		return nil
+	}
+
+	// Источник подставляет пакеты из индекса raw в документы, которые на них ссылаются.
+	// Если пакет не найден, повторная обработка без него дала бы неполный архив
+	if header.needsRawData() {
+		return fmt.Errorf("replay: raw data %s of document is not found in the source", header.RawDataId)
+	}
+
+	// Документ записан без исходного пакета (RawDataNever, RawDataFullStateOnly) или это документ индекса raw
+	if header.RawData == "" || header.Stations == nil {
+		r.progress.Skipped++
+		return nil
+	}
+
+	packageInfo, err := decodeRawData(header.RawData)
+	if err != nil {
+		r.progress.Failed++
+		return nil
+	}
+
+	if header.RawDataChecksum != "" && header.RawDataChecksum != getRawDataChecksum(packageInfo.Bytes()) {
+		r.progress.Failed++
+		return nil
+	}
+
+	items, err := r.runtimeConfig.GetUpdateRequestItemsFromPackage(packageInfo)
+	r.progress.Replayed++
+	if err != nil {
+		r.progress.Failed++
+		return nil
+	}
+
+	if r.options.checkpoint != nil && r.options.checkpoint.isAfter(&header) {
+		return nil
+	}
+
+	for _, item := range items {
+		if r.options.index != "" {
+			if item, err = retargetRequestItem(item, r.options.index); err != nil {
+				return err
+			}
+		}
+		r.batch = append(r.batch, item)
+	}
+
+	r.batchEnd = ReplayCheckpoint{Time: header.Time, DeviceId: header.DeviceId, Format: header.Format}
+
+	if len(r.batch) >= r.options.batchSize {
+		return r.flush(ctx)
+	}
+
+	return nil
+}
+
+// Replay восстанавливает пакеты из поля rawData документов source, обрабатывает их в runtimeConfig
+// и передает сформированные запросы в sink. Для корректного отслеживания изменений runtimeConfig должна быть новой.
+// Пакеты, записанные в индекс raw (RawDataSeparate), подставляет источник; если пакет не найден, Replay
+// возвращает ошибку. Документы, записанные без пакета (RawDataNever), пропускаются и учитываются в Skipped.
+// При ошибке записи возвращается состояние с позицией последней записанной порции для продолжения обработки
+func Replay(ctx context.Context, source ReplaySource, runtimeConfig *RuntimeConfiguration, sink ReplaySink,
+	opts ...ReplayOption) (*ReplayProgress, error) {
+
+	r := &replay{
+		runtimeConfig: runtimeConfig,
+		sink:          sink,
+		options:       replayOptions{batchSize: 500}}
+
+	for _, opt := range opts {
+		opt(&r.options)
+	}
+
+	if r.options.checkpoint != nil {
+		r.progress.Checkpoint = *r.options.checkpoint
+	}
+
+	err := source.ReadReplayDocuments(ctx, func(document []byte) error {
+		return r.handle(ctx, document)
+	})
+
+	if err == nil {
+		err = r.flush(ctx)
+	}
+
+	return &r.progress, err
+}
+
+type ndjsonReplaySource struct {
+	documents []*ndjsonReplayDocument
+}
+
+type ndjsonReplayDocument struct {
+	header replayDocumentHeader
+	data   []byte
+}
+
+// NewNdjsonReplaySource читает выгрузку архива в формате NDJSON: по одному документу в строке, результаты поиска
+// с полем _source или запросы bulk. Документы упорядочиваются по времени, поэтому выгрузка читается целиком.
+// Документы индекса raw из выгрузки подставляются в документы, которые ссылаются на них по контрольной сумме
+func NewNdjsonReplaySource(reader io.Reader) (ReplaySource, error) {
+	result := &ndjsonReplaySource{}
+	rawData := make(map[string]string)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var hit struct {
+			Source json.RawMessage `json:"_source"`
+		}
+		if err := json.Unmarshal(line, &hit); err != nil {
+			return nil, err
+		}
+
+		data := line
+		if hit.Source != nil {
+			data = hit.Source
+		}
+
+		doc := &ndjsonReplayDocument{data: append([]byte(nil), data...)}
+		if err := json.Unmarshal(doc.data, &doc.header); err != nil {
+			return nil, err
+		}
+
+		// Строки действий bulk не содержат времени документа
+		if doc.header.Time == 0 {
+			continue
+		}
+
+		if doc.header.isRawDataDocument() {
+			rawData[doc.header.Checksum] = doc.header.RawData
+			continue
+		}
+
+		result.documents = append(result.documents, doc)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, doc := range result.documents {
+		if !doc.header.needsRawData() {
+			continue
+		}
+
+		data, ok := rawData[doc.header.RawDataChecksum]
+		if !ok {
+			continue
+		}
+
+		buf, err := setReplayRawData(doc.data, data)
+		if err != nil {
+			return nil, err
+		}
+		doc.data = buf
+		doc.header.RawData = data
+	}
+
+	sort.SliceStable(result.documents, func(i, j int) bool {
+		a, b := &result.documents[i].header, &result.documents[j].header
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		if a.DeviceId != b.DeviceId {
+			return a.DeviceId < b.DeviceId
+		}
+		return a.Format < b.Format
+	})
+
+	return result, nil
+}
+
+func (source *ndjsonReplaySource) ReadReplayDocuments(ctx context.Context, handler func(document []byte) error) error {
+	for _, doc := range source.documents {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := handler(doc.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type archiveReplaySource struct {
+	client *ArchiveClient
+	from   time.Time
+	to     time.Time
+}
+
+// GetReplaySource возвращает источник документов архива за период для повторной обработки.
+// Пакеты, записанные в индекс raw, читаются через _mget для каждой страницы документов
+func (client *ArchiveClient) GetReplaySource(from time.Time, to time.Time) ReplaySource {
+	return &archiveReplaySource{client: client, from: from, to: to}
+}
+
+type rawDataGetResponse struct {
+	Docs []struct {
+		Id     string          `json:"_id"`
+		Found  bool            `json:"found"`
+		Source rawDataItemInfo `json:"_source"`
+	} `json:"docs"`
+}
+
+// Подставляет в документы страницы пакеты, записанные в индекс raw
+func (source *archiveReplaySource) resolveRawData(ctx context.Context, documents []json.RawMessage) error {
+	indexes := make(map[string][]int)
+	var ids []string
+
+	for i, document := range documents {
+		var header replayDocumentHeader
+		if err := json.Unmarshal(document, &header); err != nil || !header.needsRawData() {
+			continue
+		}
+
+		if _, ok := indexes[header.RawDataId]; !ok {
+			ids = append(ids, header.RawDataId)
+		}
+		indexes[header.RawDataId] = append(indexes[header.RawDataId], i)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var response rawDataGetResponse
+	if err := source.client.doPost(ctx, fmt.Sprintf("/%s/_mget", rawDataIndex), map[string][]string{"ids": ids}, &response); err != nil {
+		return err
+	}
+
+	for _, doc := range response.Docs {
+		if !doc.Found {
+			continue
+		}
+
+		for _, i := range indexes[doc.Id] {
+			buf, err := setReplayRawData(documents[i], doc.Source.RawData)
+			if err != nil {
+				return err
+			}
+			documents[i] = buf
+		}
+	}
+
+	return nil
+}
+
+func (source *archiveReplaySource) ReadReplayDocuments(ctx context.Context, handler func(document []byte) error) error {
+	query := map[string]interface{}{
+		"query": getTimeRangeQuery(source.from, source.to),
+		"sort":  getTimeSort()}
+
+	return source.client.searchPages(ctx, query, func(documents []json.RawMessage) error {
+		if err := source.resolveRawData(ctx, documents); err != nil {
+			return err
+		}
+
+		for _, document := range documents {
+			if err := handler(document); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,293 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testReplaySink struct {
+	items   []*RequestItem
+	failure error
+}
+
+func (sink *testReplaySink) WriteRequestItems(ctx context.Context, items []*RequestItem) error {
+	if sink.failure != nil {
+		return sink.failure
+	}
+	sink.items = append(sink.items, items...)
+	return nil
+}
+
+func getReplayTestConfigurationInfo() *ConfigurationInfo {
+	return &ConfigurationInfo{
+		Objects: map[int]*ObjectInfo{
+			100: {objectId: 100, stationId: 30000, hostId: 800, typeId: 3},
+		},
+		objectStates: map[int]map[int]*ObjectStateInfo{
+			3: {
+				10: {Id: 10, Name: "Норма", Severity: 1},
+				17: {Id: 17, Name: "Отказ", Severity: 3},
+			},
+		},
+	}
+}
+
+// Формирует выгрузку архива в формате bulk, документы записаны в обратном порядке
+func getReplayTestExport(t *testing.T, opts ...RuntimeOption) string {
+	now := time.Unix(1000, 0)
+
+	packages := []*core.DataPackage{
+		{
+			Time:     core.GetUnixMicrosecondsFromTime(now),
+			DeviceId: core.GetSpecialDeviceForHost(800),
+			Format:   core.PackageFormatFullObjectStates,
+			Data:     []byte{core.PackageEventTypeObjectState, 100, 0, 0, 0, 10, 0},
+			DataSize: 7},
+		{
+			Time:     core.GetUnixMicrosecondsFromTime(now.Add(time.Second)),
+			DeviceId: core.GetSpecialDeviceForHost(800),
+			Format:   core.PackageFormatEvents,
+			Data:     []byte{core.PackageEventTypeObjectState, 100, 0, 0, 0, 17, 0},
+			DataSize: 7},
+	}
+
+	runtimeConfig := NewRuntimeConfiguration(getReplayTestConfigurationInfo(), opts...)
+
+	var items []*RequestItem
+	for _, p := range packages {
+		res, err := runtimeConfig.GetUpdateRequestItemsFromPackage(p)
+		assert.Nil(t, err)
+		items = append(items, res...)
+	}
+
+	var builder strings.Builder
+	for i := len(items) - 1; i >= 0; i-- {
+		items[i].AddToBuilder(&builder)
+	}
+
+	// Документ без исходного пакета не может быть обработан повторно
+	builder.WriteString(`{"time":500000,"stations":[30000],"deviceId":5,"format":0}` + "\n")
+
+	return builder.String()
+}
+
+func getRequestIndexAndId(t *testing.T, item *RequestItem) (string, string) {
+	var rq map[string]*createRequest
+	assert.Nil(t, json.Unmarshal([]byte(item.request), &rq))
+	return rq["create"].Index, rq["create"].Id
+}
+
+func TestReplay(t *testing.T) {
+	source, err := NewNdjsonReplaySource(strings.NewReader(getReplayTestExport(t)))
+	assert.Nil(t, err)
+
+	sink := &testReplaySink{}
+	var reported []ReplayProgress
+
+	progress, err := Replay(context.Background(), source, NewRuntimeConfiguration(getReplayTestConfigurationInfo()), sink,
+		WithReplayIndex("events-v2"),
+		WithReplayBatchSize(1),
+		WithReplayProgress(func(progress ReplayProgress) {
+			reported = append(reported, progress)
+		}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, progress.Read)
+	assert.Equal(t, 2, progress.Replayed)
+	assert.Equal(t, 1, progress.Skipped)
+	assert.Equal(t, 0, progress.Failed)
+	assert.Equal(t, 2, progress.Written)
+	assert.Len(t, reported, 2)
+
+	deviceId := core.GetSpecialDeviceForHost(800)
+	assert.Equal(t, ReplayCheckpoint{Time: 1001000, DeviceId: deviceId, Format: core.PackageFormatEvents}, progress.Checkpoint)
+
+	assert.Len(t, sink.items, 2)
+
+	index, id := getRequestIndexAndId(t, sink.items[0])
+	assert.Equal(t, "events-v2", index)
+	assert.Equal(t, fmt.Sprintf("%d_%d_%d", deviceId, core.PackageFormatFullObjectStates, 1000000), id)
+
+	// Полное состояние обработано раньше изменения, поэтому предыдущее состояние известно
+	var eventInfo EventsDocument
+	assert.Nil(t, json.Unmarshal([]byte(sink.items[1].item), &eventInfo))
+	assert.Equal(t, "Норма", eventInfo.Sds[0].PrevStateName)
+}
+
+func TestReplaySeparateRawData(t *testing.T) {
+	export := getReplayTestExport(t,
+		WithRawDataPolicy(DocumentKindEvents, RawDataSeparate),
+		WithRawDataPolicy(DocumentKindFullState, RawDataSeparate))
+
+	source, err := NewNdjsonReplaySource(strings.NewReader(export))
+	assert.Nil(t, err)
+
+	sink := &testReplaySink{}
+
+	progress, err := Replay(context.Background(), source, NewRuntimeConfiguration(getReplayTestConfigurationInfo()), sink)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, progress.Read)
+	assert.Equal(t, 2, progress.Replayed)
+	assert.Equal(t, 0, progress.Failed)
+	assert.Len(t, sink.items, 2)
+
+	var eventInfo EventsDocument
+	assert.Nil(t, json.Unmarshal([]byte(sink.items[1].item), &eventInfo))
+	assert.Equal(t, "Норма", eventInfo.Sds[0].PrevStateName)
+
+	// Выгрузка без документов индекса raw не может быть обработана повторно
+	var builder strings.Builder
+	for _, line := range strings.Split(export, "\n") {
+		if !strings.Contains(line, `"checksum"`) && !strings.Contains(line, `"_index":"raw"`) {
+			builder.WriteString(line + "\n")
+		}
+	}
+
+	source, err = NewNdjsonReplaySource(strings.NewReader(builder.String()))
+	assert.Nil(t, err)
+
+	_, err = Replay(context.Background(), source, NewRuntimeConfiguration(getReplayTestConfigurationInfo()), &testReplaySink{})
+	assert.NotNil(t, err)
+}
+
+func TestArchiveReplaySourceSeparateRawData(t *testing.T) {
+	runtimeConfig := NewRuntimeConfiguration(getReplayTestConfigurationInfo(),
+		WithRawDataPolicy(DocumentKindFullState, RawDataSeparate))
+
+	items, err := runtimeConfig.GetUpdateRequestItemsFromPackage(&core.DataPackage{
+		Time:     core.GetUnixMicrosecondsFromTime(time.Unix(1000, 0)),
+		DeviceId: core.GetSpecialDeviceForHost(800),
+		Format:   core.PackageFormatFullObjectStates,
+		Data:     []byte{core.PackageEventTypeObjectState, 100, 0, 0, 0, 10, 0},
+		DataSize: 7})
+	assert.Nil(t, err)
+
+	var document, rawDocument string
+	var rawId string
+	for _, item := range items {
+		index, id := getRequestIndexAndId(t, item)
+		if index == rawDataIndex {
+			rawDocument, rawId = item.item, id
+		} else {
+			document = item.item
+		}
+	}
+	assert.NotEmpty(t, rawDocument)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		switch r.URL.Path {
+		case "/events/_search":
+			_, _ = w.Write([]byte(`{"hits":{"hits":[{"_source":` + document + `,"sort":[1]}]}}`))
+		case "/raw/_mget":
+			assert.JSONEq(t, `{"ids":["`+rawId+`"]}`, string(body))
+			_, _ = w.Write([]byte(`{"docs":[{"_id":"` + rawId + `","found":true,"_source":` + rawDocument + `}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	source := NewArchiveClient(server.URL, nil).GetReplaySource(time.Unix(0, 0), time.Unix(2000, 0))
+	sink := &testReplaySink{}
+
+	progress, err := Replay(context.Background(), source, NewRuntimeConfiguration(getReplayTestConfigurationInfo()), sink)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, progress.Replayed)
+	assert.Equal(t, 0, progress.Failed)
+	assert.Len(t, sink.items, 1)
+}
+
+func TestReplayFromCheckpoint(t *testing.T) {
+	source, err := NewNdjsonReplaySource(strings.NewReader(getReplayTestExport(t)))
+	assert.Nil(t, err)
+
+	sink := &testReplaySink{}
+	deviceId := core.GetSpecialDeviceForHost(800)
+
+	progress, err := Replay(context.Background(), source, NewRuntimeConfiguration(getReplayTestConfigurationInfo()), sink,
+		WithReplayCheckpoint(ReplayCheckpoint{Time: 1000000, DeviceId: deviceId, Format: core.PackageFormatFullObjectStates}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, progress.Replayed)
+	assert.Equal(t, 1, progress.Written)
+	assert.Len(t, sink.items, 1)
+
+	index, _ := getRequestIndexAndId(t, sink.items[0])
+	assert.Equal(t, "events", index)
+
+	// Состояние восстановлено по документам до позиции продолжения
+	var eventInfo EventsDocument
+	assert.Nil(t, json.Unmarshal([]byte(sink.items[0].item), &eventInfo))
+	assert.Equal(t, "Норма", eventInfo.Sds[0].PrevStateName)
+}
+
+func TestReplaySinkFailure(t *testing.T) {
+	source, err := NewNdjsonReplaySource(strings.NewReader(getReplayTestExport(t)))
+	assert.Nil(t, err)
+
+	sink := &testReplaySink{failure: fmt.Errorf("connection refused")}
+
+	progress, err := Replay(context.Background(), source, NewRuntimeConfiguration(getReplayTestConfigurationInfo()), sink)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, progress.Written)
+	assert.Equal(t, ReplayCheckpoint{}, progress.Checkpoint)
+}
+
+func TestNewNdjsonReplaySourceSearchHits(t *testing.T) {
+	data := `{"_index":"events","_source":{"time":2000,"stations":[1],"deviceId":1,"format":0}}` + "\n" +
+		"\n" +
+		`{"_index":"events","_source":{"time":1000,"stations":[1],"deviceId":1,"format":0}}` + "\n"
+
+	source, err := NewNdjsonReplaySource(bytes.NewReader([]byte(data)))
+	assert.Nil(t, err)
+
+	var docs []string
+	err = source.ReadReplayDocuments(context.Background(), func(document []byte) error {
+		docs = append(docs, string(document))
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`{"time":1000,"stations":[1],"deviceId":1,"format":0}`,
+		`{"time":2000,"stations":[1],"deviceId":1,"format":0}`}, docs)
+}
+
+func TestArchiveClient_WriteRequestItems(t *testing.T) {
+	responses := []string{
+		`{"errors":true,"items":[{"create":{"status":201}},{"create":{"status":409,"error":{"type":"version_conflict_engine_exception"}}}]}`,
+		`{"errors":true,"items":[{"create":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`,
+	}
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		_, _ = w.Write([]byte(responses[len(bodies)-1]))
+	}))
+	defer server.Close()
+
+	client := NewArchiveClient(server.URL, nil)
+	items := []*RequestItem{{`{"create":{"_index":"events","_id":"1"}}`, `{"time":1}`}}
+
+	assert.Nil(t, client.WriteRequestItems(context.Background(), items))
+	assert.Equal(t, "{\"create\":{\"_index\":\"events\",\"_id\":\"1\"}}\n{\"time\":1}\n", bodies[0])
+
+	assert.NotNil(t, client.WriteRequestItems(context.Background(), items))
+}
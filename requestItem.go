@@ -10,6 +10,10 @@ type RequestItem struct {
 func (item *RequestItem) AddToBuilder(builder *strings.Builder) {
 	builder.WriteString(item.request)
 	builder.WriteString("\n")
+	// Запрос delete передается без документа
+	if item.item == "" {
+		return
+	}
 	builder.WriteString(item.item)
 	builder.WriteString("\n")
 }
@@ -0,0 +1,260 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+	"math"
+	"time"
+)
+
+const rollupIndex = "rollups"
+
+// Стандартные интервалы агрегирования
+const (
+	RollupMinute = time.Minute
+	RollupHour   = time.Hour
+	RollupDay    = 24 * time.Hour
+)
+
+// Агрегированные значения датчика за интервал
+type rollupBucket struct {
+	deviceId int32
+	sensorId uint16
+	interval time.Duration
+	start    time.Time
+	measures []*archiveMeasureOrAttributeInfo
+	count    int
+	nanCount int
+	min      float32
+	max      float32
+	first    float32
+	last     float32
+	sum      float64
+	// Интервал закрыт CheckRollups до получения значения следующего интервала
+	closed bool
+}
+
+type rollupItemInfo struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Time          int64  `json:"time"`
+	EndTime       int64  `json:"endTime"`
+	Interval      string `json:"interval"`
+	Stations      []int  `json:"stations"`
+	DeviceId      int32  `json:"deviceId"`
+	SensorId      int    `json:"sensorId"`
+	MeasureId     int    `json:"measureId,omitempty"`
+	AttributeId   int    `json:"attributeId,omitempty"`
+	MeasureOrAttributeItem
+	Min      *float32 `json:"min,omitempty"`
+	Max      *float32 `json:"max,omitempty"`
+	Avg      *float64 `json:"avg,omitempty"`
+	First    *float32 `json:"first,omitempty"`
+	Last     *float32 `json:"last,omitempty"`
+	Count    int      `json:"count"`
+	NanCount int      `json:"nanCount"`
+}
+
+// WithRollups включает агрегирование значений измерений и атрибутов за интервалы (например RollupMinute, RollupHour, RollupDay).
+// Документы с агрегированными значениями записываются в индекс rollups после завершения интервала.
+// Интервал завершается значением следующего интервала, CheckRollups или FlushRollups: без CheckRollups последний
+// интервал перед прекращением данных записывается только при остановке.
+// Идентификатор документа определяется объектом, измерением, интервалом и его началом, документ перезаписывается,
+// поэтому повторная обработка тех же пакетов заменяет документ. Интервал, записанный FlushRollups перед перезапуском
+// и продолженный после него, перезаписывается значениями, полученными после перезапуска.
+// Значения из пакетов, пришедших после завершения интервала, не учитываются (DroppedStatistics.LateRollupValues).
+// Неположительные интервалы игнорируются
+func WithRollups(intervals ...time.Duration) RuntimeOption {
+	return func(runtimeConfig *RuntimeConfiguration) {
+		for _, interval := range intervals {
+			if interval > 0 {
+				runtimeConfig.rollupIntervals = append(runtimeConfig.rollupIntervals, interval)
+			}
+		}
+	}
+}
+
+func formatRollupInterval(interval time.Duration) string {
+	switch {
+	case interval%RollupDay == 0:
+		return fmt.Sprintf("%dd", interval/RollupDay)
+	case interval%time.Hour == 0:
+		return fmt.Sprintf("%dh", interval/time.Hour)
+	case interval%time.Minute == 0:
+		return fmt.Sprintf("%dm", interval/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", interval/time.Second)
+	}
+}
+
+func (bucket *rollupBucket) add(value float32) {
+	if core.IsNaN(value) {
+		bucket.nanCount++
+		return
+	}
+
+	if bucket.count == 0 {
+		bucket.min, bucket.max, bucket.first = value, value, value
+	}
+
+	bucket.min = float32(math.Min(float64(bucket.min), float64(value)))
+	bucket.max = float32(math.Max(float64(bucket.max), float64(value)))
+	bucket.last = value
+	bucket.sum += float64(value)
+	bucket.count++
+}
+
+// Добавляет значение датчика в интервалы и возвращает завершенные интервалы.
+// Значение из пакета, пришедшего после завершения интервала, отбрасывается, late равно true
+func (rt *runtimeSensorMappingInfo) addRollupValue(deviceId int32, sensorId uint16, intervals []time.Duration,
+	value float32, now time.Time) (closed []*rollupBucket, late bool) {
+
+	if len(rt.rollups) == 0 {
+		rt.rollups = make([]*rollupBucket, len(intervals))
+	}
+
+	for i, interval := range intervals {
+		start := now.Truncate(interval)
+		bucket := rt.rollups[i]
+
+		if bucket != nil && (start.Before(bucket.start) || start.Equal(bucket.start) && bucket.closed) {
+			// Интервал уже записан
+			late = true
+			continue
+		}
+
+		if bucket != nil && start.After(bucket.start) {
+			if !bucket.closed {
+				closed = append(closed, bucket)
+			}
+			bucket = nil
+		}
+
+		if bucket == nil {
+			bucket = &rollupBucket{
+				deviceId: deviceId,
+				sensorId: sensorId,
+				interval: interval,
+				start:    start,
+				measures: rt.measures}
+			rt.rollups[i] = bucket
+		}
+
+		bucket.add(value)
+	}
+
+	return closed, late
+}
+
+func (bucket *rollupBucket) getRequestItems() []*RequestItem {
+	var result []*RequestItem
+
+	startTime := core.GetUnixMillisecondsFromTime(bucket.start)
+	interval := formatRollupInterval(bucket.interval)
+
+	for _, measureInfo := range bucket.measures {
+		item := &rollupItemInfo{
+			SchemaVersion: DocumentSchemaVersion,
+			Time:          startTime,
+			EndTime:       core.GetUnixMillisecondsFromTime(bucket.start.Add(bucket.interval)),
+			Interval:      interval,
+			Stations:      []int{measureInfo.stationId},
+			DeviceId:      bucket.deviceId,
+			SensorId:      int(bucket.sensorId),
+			MeasureOrAttributeItem: MeasureOrAttributeItem{
+				ObjectId:       measureInfo.objectId,
+				Unit:           measureInfo.unitOfMeasure,
+				ObjectTypeId:   measureInfo.objectTypeId,
+				Name:           measureInfo.measureOrAttributeName,
+				ObjectName:     measureInfo.objectName,
+				ObjectTypeName: measureInfo.objectTypeName,
+				StationName:    measureInfo.stationName},
+			Count:    bucket.count,
+			NanCount: bucket.nanCount}
+
+		kind := dictionaryKindMeasure
+		if measureInfo.isAttribute {
+			kind = dictionaryKindAttribute
+			item.AttributeId = measureInfo.measureOrAttributeId
+		} else {
+			item.MeasureId = measureInfo.measureOrAttributeId
+		}
+
+		if bucket.count > 0 {
+			min, max, first, last := bucket.min, bucket.max, bucket.first, bucket.last
+			avg := bucket.sum / float64(bucket.count)
+			item.Min, item.Max, item.First, item.Last, item.Avg = &min, &max, &first, &last, &avg
+		}
+
+		id := fmt.Sprintf("%s_%d_%d_%s_%d", kind, measureInfo.objectId, measureInfo.measureOrAttributeId, interval, startTime)
+		rq := map[string]*createRequest{"index": {DocType: "_doc", Index: rollupIndex, Id: id}}
+
+		buf, err := json.Marshal(rq)
+		if err != nil {
+			continue
+		}
+
+		itemBuf, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+
+		result = append(result, &RequestItem{string(buf), string(itemBuf)})
+	}
+
+	return result
+}
+
+// Забирает запросы на запись завершенных интервалов
+func (runtimeConfig *RuntimeConfiguration) takeRollupRequestItems() []*RequestItem {
+	runtimeConfig.lock.Lock()
+	closed := runtimeConfig.closedRollups
+	runtimeConfig.closedRollups = nil
+	runtimeConfig.lock.Unlock()
+
+	var result []*RequestItem
+	for _, bucket := range closed {
+		result = append(result, bucket.getRequestItems()...)
+	}
+
+	return result
+}
+
+// CheckRollups завершает интервалы агрегирования, закончившиеся до now, и возвращает запросы на их запись.
+// Вызывается периодически, чтобы интервалы датчиков, переставших присылать данные, попадали в архив до остановки.
+// Значения закрытых интервалов, пришедшие позже, не учитываются (DroppedStatistics.LateRollupValues)
+func (runtimeConfig *RuntimeConfiguration) CheckRollups(now time.Time) []*RequestItem {
+	runtimeConfig.lock.Lock()
+	for _, deviceMapping := range runtimeConfig.mappings {
+		for _, item := range deviceMapping {
+			for _, bucket := range item.rollups {
+				if bucket != nil && !bucket.closed && !bucket.start.Add(bucket.interval).After(now) {
+					bucket.closed = true
+					runtimeConfig.closedRollups = append(runtimeConfig.closedRollups, bucket)
+				}
+			}
+		}
+	}
+	runtimeConfig.lock.Unlock()
+
+	return runtimeConfig.takeRollupRequestItems()
+}
+
+// FlushRollups завершает все текущие интервалы агрегирования и возвращает запросы на их запись.
+// Вызывается перед остановкой, чтобы не потерять незавершенные интервалы
+func (runtimeConfig *RuntimeConfiguration) FlushRollups() []*RequestItem {
+	runtimeConfig.lock.Lock()
+	for _, deviceMapping := range runtimeConfig.mappings {
+		for _, item := range deviceMapping {
+			for _, bucket := range item.rollups {
+				if bucket != nil && !bucket.closed {
+					runtimeConfig.closedRollups = append(runtimeConfig.closedRollups, bucket)
+				}
+			}
+			item.rollups = nil
+		}
+	}
+	runtimeConfig.lock.Unlock()
+
+	return runtimeConfig.takeRollupRequestItems()
+}
@@ -0,0 +1,215 @@
+package archive
+
+import (
+	"encoding/json"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+func getRollupItems(t *testing.T, items []*RequestItem) (map[string]*rollupItemInfo, int) {
+	result := make(map[string]*rollupItemInfo)
+	others := 0
+
+	for _, item := range items {
+		var rq map[string]*createRequest
+		assert.Nil(t, json.Unmarshal([]byte(item.request), &rq))
+
+		action, ok := rq["index"]
+		if !ok || action.Index != rollupIndex {
+			others++
+			continue
+		}
+
+		var info rollupItemInfo
+		assert.Nil(t, json.Unmarshal([]byte(item.item), &info))
+		result[action.Id] = &info
+	}
+
+	return result, others
+}
+
+func TestRollups(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithRollups(RollupMinute, RollupHour))
+
+	start := time.Unix(3600*1000, 0)
+	values := [][]byte{{232, 3, 0, 0}, {0, 0, 0, 0x80}, {208, 7, 0, 0}, {184, 11, 0, 0}}
+
+	for i, value := range values {
+		res, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(time.Duration(i*10)*time.Second), value))
+		assert.Nil(t, err)
+
+		rollups, others := getRollupItems(t, res)
+		assert.Empty(t, rollups)
+		assert.Equal(t, 1, others)
+	}
+
+	// Новая минута завершает минутный интервал
+	res, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(time.Minute), []byte{1, 0, 0, 0}))
+	assert.Nil(t, err)
+
+	rollups, _ := getRollupItems(t, res)
+	assert.Len(t, rollups, 2)
+
+	startTime := core.GetUnixMillisecondsFromTime(start)
+
+	measure := rollups["measure_100_7_1m_3600000000"]
+	assert.NotNil(t, measure)
+	assert.Equal(t, startTime, measure.Time)
+	assert.Equal(t, startTime+60000, measure.EndTime)
+	assert.Equal(t, "1m", measure.Interval)
+	assert.Equal(t, []int{30000}, measure.Stations)
+	assert.Equal(t, 7, measure.MeasureId)
+	assert.Equal(t, "В", measure.Unit)
+	assert.Equal(t, float32(1), *measure.Min)
+	assert.Equal(t, float32(3), *measure.Max)
+	assert.Equal(t, float32(1), *measure.First)
+	assert.Equal(t, float32(3), *measure.Last)
+	assert.Equal(t, float64(2), *measure.Avg)
+	assert.Equal(t, 3, measure.Count)
+	assert.Equal(t, 1, measure.NanCount)
+
+	attribute := rollups["attribute_200_8_1m_3600000000"]
+	assert.NotNil(t, attribute)
+	assert.Equal(t, 8, attribute.AttributeId)
+	assert.Equal(t, []int{33000}, attribute.Stations)
+
+	// Часовой интервал не завершен и записывается при остановке
+	rollups, _ = getRollupItems(t, info.FlushRollups())
+	assert.Len(t, rollups, 4)
+
+	hour := rollups["measure_100_7_1h_3600000000"]
+	assert.NotNil(t, hour)
+	assert.Equal(t, 4, hour.Count)
+	assert.Equal(t, float32(0.001), *hour.Min)
+	assert.Equal(t, float32(0.001), *hour.Last)
+	assert.NotNil(t, rollups["measure_100_7_1m_3600060000"])
+
+	assert.Empty(t, info.FlushRollups())
+}
+
+func TestRollupsLateValues(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithRollups(RollupMinute, RollupHour))
+
+	start := time.Unix(3600*1000, 0)
+
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(time.Minute), []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	// Пакет за предыдущую минуту пришел после начала следующей минуты
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(30*time.Second), []byte{208, 7, 0, 0}))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, info.GetDroppedStatistics().LateRollupValues)
+
+	rollups, _ := getRollupItems(t, info.FlushRollups())
+
+	// Значение не попало в минутный интервал, но учтено в часовом
+	minute := rollups["measure_100_7_1m_3600060000"]
+	assert.Equal(t, 1, minute.Count)
+	assert.Equal(t, float32(1), *minute.Max)
+	assert.Nil(t, rollups["measure_100_7_1m_3600000000"])
+	assert.Equal(t, 2, rollups["measure_100_7_1h_3600000000"].Count)
+}
+
+func TestRollupsIds(t *testing.T) {
+	start := time.Unix(3600*1000, 0)
+
+	getIds := func(items []*RequestItem) []string {
+		var ids []string
+		for _, item := range items {
+			var rq map[string]*createRequest
+			assert.Nil(t, json.Unmarshal([]byte(item.request), &rq))
+			ids = append(ids, rq["index"].Id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// Интервал, записанный при остановке, после перезапуска перезаписывается тем же документом
+	first := getTestRuntimeConfiguration(WithRollups(RollupHour))
+	_, err := first.GetUpdateRequestItemsFromPackage(getTestDataPackage(start, []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+	firstIds := getIds(first.FlushRollups())
+
+	second := getTestRuntimeConfiguration(WithRollups(RollupHour))
+	_, err = second.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(time.Minute), []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"attribute_200_8_1h_3600000000", "measure_100_7_1h_3600000000"}, firstIds)
+	assert.Equal(t, firstIds, getIds(second.FlushRollups()))
+}
+
+func TestCheckRollups(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithRollups(RollupMinute, RollupHour))
+
+	start := time.Unix(3600*1000, 0)
+
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start, []byte{232, 3, 0, 0}))
+	assert.Nil(t, err)
+
+	assert.Empty(t, info.CheckRollups(start.Add(30*time.Second)))
+
+	// Минутный интервал завершается без новых значений
+	rollups, _ := getRollupItems(t, info.CheckRollups(start.Add(time.Minute)))
+	assert.Len(t, rollups, 2)
+	assert.Equal(t, 1, rollups["measure_100_7_1m_3600000000"].Count)
+	assert.Empty(t, info.CheckRollups(start.Add(time.Minute)))
+
+	// Значение закрытого интервала не учитывается и не перезаписывает документ
+	res, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(50*time.Second), []byte{208, 7, 0, 0}))
+	assert.Nil(t, err)
+	rollups, _ = getRollupItems(t, res)
+	assert.Empty(t, rollups)
+	assert.Equal(t, 1, info.GetDroppedStatistics().LateRollupValues)
+
+	// Следующий интервал не записывает закрытый интервал повторно
+	_, err = info.GetUpdateRequestItemsFromPackage(getTestDataPackage(start.Add(70*time.Second), []byte{208, 7, 0, 0}))
+	assert.Nil(t, err)
+
+	rollups, _ = getRollupItems(t, info.FlushRollups())
+	assert.Len(t, rollups, 4)
+	assert.Nil(t, rollups["measure_100_7_1m_3600000000"])
+	assert.Equal(t, 3, rollups["measure_100_7_1h_3600000000"].Count)
+}
+
+func TestRollupsOnlyNaN(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithRollups(RollupDay))
+
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(0, 0), []byte{0, 0, 0, 0x80}))
+	assert.Nil(t, err)
+
+	rollups, _ := getRollupItems(t, info.FlushRollups())
+	day := rollups["measure_100_7_1d_0"]
+
+	assert.NotNil(t, day)
+	assert.Nil(t, day.Min)
+	assert.Nil(t, day.Avg)
+	assert.Equal(t, 0, day.Count)
+	assert.Equal(t, 1, day.NanCount)
+}
+
+func TestWithoutRollups(t *testing.T) {
+	info := getTestRuntimeConfiguration()
+
+	_, err := info.GetUpdateRequestItemsFromPackage(getTestDataPackage(time.Unix(0, 0), []byte{1, 0, 0, 0}))
+	assert.Nil(t, err)
+
+	assert.Empty(t, info.FlushRollups())
+}
+
+func TestWithRollupsNonPositive(t *testing.T) {
+	info := getTestRuntimeConfiguration(WithRollups(0, -time.Minute, RollupHour))
+
+	assert.Equal(t, []time.Duration{RollupHour}, info.rollupIntervals)
+}
+
+func TestFormatRollupInterval(t *testing.T) {
+	assert.Equal(t, "1m", formatRollupInterval(RollupMinute))
+	assert.Equal(t, "1h", formatRollupInterval(RollupHour))
+	assert.Equal(t, "1d", formatRollupInterval(RollupDay))
+	assert.Equal(t, "90m", formatRollupInterval(90*time.Minute))
+	assert.Equal(t, "30s", formatRollupInterval(30*time.Second))
+}
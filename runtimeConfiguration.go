@@ -12,6 +12,8 @@ type runtimeSensorMappingInfo struct {
 	measures       []*archiveMeasureOrAttributeInfo
 	currentValue   float32
 	lastUpdateTime time.Time
+	// Текущие интервалы агрегирования в порядке RuntimeConfiguration.rollupIntervals
+	rollups []*rollupBucket
 }
 
 func (rt *runtimeSensorMappingInfo) tryUpdateValue(newValue float32, now time.Time) bool {
@@ -38,6 +40,60 @@ type RuntimeConfiguration struct {
 	mappings          map[int32]map[uint16]*runtimeSensorMappingInfo
 	objectsToStations map[int]int
 	hostToObjects     map[int]mapset.Set
+	objectTypes       map[int]int
+	// Тип объекта на словарь состояний
+	objectStates map[int]map[int]*ObjectStateInfo
+	// Последнее известное состояние объекта
+	currentObjectStates map[uint32]uint16
+	// Способ сохранения исходного пакета для вида документа
+	rawDataPolicies map[DocumentKind]RawDataPolicy
+	// Конфигурация содержит только часть объектов проекта, события остальных объектов отбрасываются
+	isSubset bool
+	dropped  DroppedStatistics
+	// Интервалы агрегирования значений и завершенные интервалы, ожидающие записи
+	rollupIntervals []time.Duration
+	closedRollups   []*rollupBucket
+	// Поиск пропусков данных и завершенные пропуски, ожидающие записи
+	gaps       *gapTracker
+	closedGaps []*DataGap
+	// Получатели измененных значений и сформированных документов
+	measureListeners  []MeasureListener
+	documentListeners []DocumentListener
+}
+
+// DroppedStatistics количество пакетов и событий, отброшенных из-за отбора объектов,
+// и значений, не учтенных в агрегировании из-за опоздания пакета
+type DroppedStatistics struct {
+	Packages int
+	Events   int
+	// Значения из пакетов, пришедших после завершения интервала агрегирования
+	LateRollupValues int
+}
+
+// GetDroppedStatistics возвращает количество отброшенных пакетов, событий и значений
+func (runtimeConfig *RuntimeConfiguration) GetDroppedStatistics() DroppedStatistics {
+	runtimeConfig.lock.Lock()
+	defer runtimeConfig.lock.Unlock()
+
+	return runtimeConfig.dropped
+}
+
+// RuntimeOption задает дополнительные параметры RuntimeConfiguration
+type RuntimeOption func(runtimeConfig *RuntimeConfiguration)
+
+// WithRawDataPolicy задает способ сохранения исходного пакета для вида документа.
+// По умолчанию пакет всегда записывается в документ
+func WithRawDataPolicy(kind DocumentKind, policy RawDataPolicy) RuntimeOption {
+	return func(runtimeConfig *RuntimeConfiguration) {
+		runtimeConfig.rawDataPolicies[kind] = policy
+	}
+}
+
+func (runtimeConfig *RuntimeConfiguration) getRawDataPolicy(kind DocumentKind) RawDataPolicy {
+	if policy, ok := runtimeConfig.rawDataPolicies[kind]; ok {
+		return policy
+	}
+	return RawDataAlways
 }
 
 func (runtimeConfig *RuntimeConfiguration) GetUpdateRequestItemsFromPackage(dataPackage *core.DataPackage) ([]*RequestItem, error) {
@@ -48,17 +104,34 @@ func (runtimeConfig *RuntimeConfiguration) GetUpdateRequestItemsFromPackage(data
 		return nil, err
 	}
 
-	if updateResult == nil {
-		return nil, nil
+	var result []*RequestItem
+	if updateResult != nil {
+		result = updateResult.getArchiveServerRequest()
+		runtimeConfig.notifyMeasureListeners(updateResult)
 	}
-	return updateResult.getArchiveServerRequest(), nil
+
+	result = append(result, runtimeConfig.takeRollupRequestItems()...)
+	result = append(result, runtimeConfig.takeGapRequestItems()...)
+
+	runtimeConfig.notifyDocumentListeners(result)
+
+	return result, nil
 }
 
-func NewRuntimeConfiguration(info *ConfigurationInfo) *RuntimeConfiguration {
+func NewRuntimeConfiguration(info *ConfigurationInfo, opts ...RuntimeOption) *RuntimeConfiguration {
 	result := &RuntimeConfiguration{
-		mappings:          make(map[int32]map[uint16]*runtimeSensorMappingInfo),
-		objectsToStations: make(map[int]int),
-		hostToObjects:     make(map[int]mapset.Set)}
+		mappings:            make(map[int32]map[uint16]*runtimeSensorMappingInfo),
+		objectsToStations:   make(map[int]int),
+		hostToObjects:       make(map[int]mapset.Set),
+		objectTypes:         make(map[int]int),
+		objectStates:        info.objectStates,
+		currentObjectStates: make(map[uint32]uint16),
+		rawDataPolicies:     make(map[DocumentKind]RawDataPolicy),
+		isSubset:            info.isSubset}
+
+	for _, opt := range opts {
+		opt(result)
+	}
 
 	for deviceId, deviceMapping := range info.mappings {
 		runTimeDeviceMap := make(map[uint16]*runtimeSensorMappingInfo)
@@ -72,6 +145,7 @@ func NewRuntimeConfiguration(info *ConfigurationInfo) *RuntimeConfiguration {
 
 	for _, obj := range info.Objects {
 		result.objectsToStations[obj.objectId] = obj.stationId
+		result.objectTypes[obj.objectId] = obj.typeId
 		if obj.hostId != 0 {
 			if aSet, ok := result.hostToObjects[obj.hostId]; ok {
 				aSet.Add(obj.objectId)
@@ -93,6 +167,10 @@ func (runtimeConfig *RuntimeConfiguration) updateFromFullStatePackage(packageInf
 	}
 
 	stations := runtimeConfig.getStationsForSpecialDevice(packageInfo.DeviceId)
+	if len(stations) == 0 && runtimeConfig.isSubset {
+		runtimeConfig.dropped.Packages++
+		return nil, nil
+	}
 	if len(stations) == 0 {
 		return nil, fmt.Errorf("no stations found for special device {%d}", packageInfo.DeviceId)
 	}
@@ -100,7 +178,28 @@ func (runtimeConfig *RuntimeConfiguration) updateFromFullStatePackage(packageInf
 	result := &objectFullStateUpdateEventInfo{
 		processingTime: now,
 		packageInfo:    packageInfo,
-		stations:       stations}
+		stations:       stations,
+		rawDataPolicy:  runtimeConfig.getRawDataPolicy(DocumentKindFullState)}
+
+	// Пакет с ошибкой в данных все равно записываем в архив, но без разобранного содержимого
+	switch packageInfo.Format {
+	case core.PackageFormatFullObjectStates:
+		if states, err := packageInfo.ParseFullObjectStatePackage(); err == nil {
+			runtimeConfig.filterObjectStates(states)
+			result.objectStates = states
+			result.stateChanges = runtimeConfig.setObjectStates(states)
+		}
+	case core.PackageFormatFullFailureStates:
+		if failures, err := packageInfo.ParseFullFailureStatePackage(); err == nil {
+			runtimeConfig.filterFailures(failures)
+			result.failures = failures
+		}
+	case core.PackageFormatFullAccidentStates:
+		if accidents, err := parseFullAccidentStatePackage(packageInfo); err == nil {
+			runtimeConfig.filterAccidents(accidents)
+			result.accidents = accidents
+		}
+	}
 
 	return result, nil
 }
@@ -118,8 +217,14 @@ func (runtimeConfig *RuntimeConfiguration) updateFromEventsPackage(packageInfo *
 		return nil, err
 	}
 
+	runtimeConfig.filterEvents(events)
+
 	stations := runtimeConfig.getStationsForEvents(events)
 
+	if len(stations) == 0 && runtimeConfig.isSubset {
+		runtimeConfig.dropped.Packages++
+		return nil, nil
+	}
 	if len(stations) == 0 {
 		return nil, fmt.Errorf("no stations found for special device {%d}", packageInfo.DeviceId)
 	}
@@ -128,11 +233,119 @@ func (runtimeConfig *RuntimeConfiguration) updateFromEventsPackage(packageInfo *
 		processingTime: now,
 		packageInfo:    packageInfo,
 		events:         events,
-		stations:       stations}
+		stateChanges:   runtimeConfig.trackObjectStates(events.ObjectStates),
+		stations:       stations,
+		rawDataPolicy:  runtimeConfig.getRawDataPolicy(DocumentKindEvents)}
 
 	return result, nil
 }
 
+func (runtimeConfig *RuntimeConfiguration) isObjectDropped(objectId uint32) bool {
+	if !runtimeConfig.isSubset {
+		return false
+	}
+
+	if _, ok := runtimeConfig.objectsToStations[int(objectId)]; ok {
+		return false
+	}
+
+	runtimeConfig.dropped.Events++
+	return true
+}
+
+func (runtimeConfig *RuntimeConfiguration) filterObjectStates(states map[uint32]uint16) {
+	for objectId := range states {
+		if runtimeConfig.isObjectDropped(objectId) {
+			delete(states, objectId)
+		}
+	}
+}
+
+func (runtimeConfig *RuntimeConfiguration) filterFailures(failures map[core.ObjectFailureKey]*core.ObjectFailureEventInfo) {
+	for key := range failures {
+		if runtimeConfig.isObjectDropped(key.ObjectId) {
+			delete(failures, key)
+		}
+	}
+}
+
+func (runtimeConfig *RuntimeConfiguration) filterAccidents(accidents map[core.ObjectAccidentKey]*core.ObjectAccidentEventInfo) {
+	for key := range accidents {
+		if runtimeConfig.isObjectDropped(key.ObjectId) {
+			delete(accidents, key)
+		}
+	}
+}
+
+// Удаляет из пакета события объектов, не входящих в конфигурацию
+func (runtimeConfig *RuntimeConfiguration) filterEvents(events *core.PackageEvents) {
+	if !runtimeConfig.isSubset {
+		return
+	}
+
+	runtimeConfig.filterObjectStates(events.ObjectStates)
+	runtimeConfig.filterFailures(events.ObjectFailuresChangeState)
+	runtimeConfig.filterAccidents(events.ObjectAccidentsChangeState)
+
+	for objectId := range events.ObjectFpChangeState {
+		if runtimeConfig.isObjectDropped(objectId) {
+			delete(events.ObjectFpChangeState, objectId)
+		}
+	}
+
+	for objectId := range events.ObjectNwaChangeState {
+		if runtimeConfig.isObjectDropped(objectId) {
+			delete(events.ObjectNwaChangeState, objectId)
+		}
+	}
+
+	for objectId := range events.ObjectNwaStateLeaveEnter {
+		if runtimeConfig.isObjectDropped(objectId) {
+			delete(events.ObjectNwaStateLeaveEnter, objectId)
+		}
+	}
+}
+
+func (runtimeConfig *RuntimeConfiguration) getObjectStateInfo(objectId uint32, stateId uint16) *ObjectStateInfo {
+	typeId, ok := runtimeConfig.objectTypes[int(objectId)]
+	if !ok {
+		return nil
+	}
+
+	return runtimeConfig.objectStates[typeId][int(stateId)]
+}
+
+// Запоминает состояния объектов из полного состояния и определяет их описание
+func (runtimeConfig *RuntimeConfiguration) setObjectStates(states map[uint32]uint16) map[uint32]*objectStateChange {
+	result := make(map[uint32]*objectStateChange)
+
+	for objectId, stateId := range states {
+		runtimeConfig.currentObjectStates[objectId] = stateId
+		result[objectId] = &objectStateChange{state: runtimeConfig.getObjectStateInfo(objectId, stateId)}
+	}
+
+	return result
+}
+
+// Определяет описание нового и предыдущего состояния объектов и запоминает новые состояния
+func (runtimeConfig *RuntimeConfiguration) trackObjectStates(states map[uint32]uint16) map[uint32]*objectStateChange {
+	result := make(map[uint32]*objectStateChange)
+
+	for objectId, stateId := range states {
+		change := &objectStateChange{state: runtimeConfig.getObjectStateInfo(objectId, stateId)}
+
+		if prevStateId, ok := runtimeConfig.currentObjectStates[objectId]; ok {
+			change.prevStateId = &prevStateId
+			change.prevState = runtimeConfig.getObjectStateInfo(objectId, prevStateId)
+		}
+
+		runtimeConfig.currentObjectStates[objectId] = stateId
+		result[objectId] = change
+	}
+
+	return result
+}
+
 func (runtimeConfig *RuntimeConfiguration) getStationsForSpecialDevice(specialDeviceId int32) []int {
 
 	hostId, err := core.GetHostForSpecialDevice(specialDeviceId)
@@ -203,11 +416,30 @@ func (runtimeConfig *RuntimeConfiguration) updateFromRawDataPackage(packageInfo
 	result := &measuresUpdateEventInfo{
 		processingTime: now,
 		packageInfo:    packageInfo,
-		changedValues:  make(map[uint16]*updatedMeasures)}
+		changedValues:  make(map[uint16]*updatedMeasures),
+		rawDataPolicy:  runtimeConfig.getRawDataPolicy(DocumentKindMeasures)}
+
+	var values map[uint16]float32
+	if runtimeConfig.gaps != nil {
+		values = make(map[uint16]float32)
+	}
 
 	for sensorId, item := range deviceMapping {
 		newValue := handler(packageInfo.Data, sensorId)
 
+		if values != nil {
+			values[sensorId] = newValue
+		}
+
+		if len(runtimeConfig.rollupIntervals) != 0 {
+			closed, late := item.addRollupValue(packageInfo.DeviceId, sensorId, runtimeConfig.rollupIntervals,
+				newValue, now)
+			runtimeConfig.closedRollups = append(runtimeConfig.closedRollups, closed...)
+			if late {
+				runtimeConfig.dropped.LateRollupValues++
+			}
+		}
+
 		// Изменение в данных или прошло больше минуты со времени последнего изменения
 		if !item.tryUpdateValue(newValue, now) {
 			continue
@@ -222,6 +454,10 @@ func (runtimeConfig *RuntimeConfiguration) updateFromRawDataPackage(packageInfo
 
 	result.stations = getIntSlice(stations)
 
+	if runtimeConfig.gaps != nil {
+		runtimeConfig.trackGaps(packageInfo, deviceMapping, values, now)
+	}
+
 	return result, nil
 }
 
@@ -1,6 +1,7 @@
 package archive
 
 import (
+	"encoding/json"
 	"github.com/deckarep/golang-set"
 	"github.com/imsat-spb/go-apkdk-core"
 	"github.com/stretchr/testify/assert"
@@ -308,3 +309,69 @@ func TestGetStationsForSpecialDevice(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateFromEventsWithObjectStates(t *testing.T) {
+	const objectId1 = 100
+	const stationId1 = 30000
+	const hostId = 800
+	const typeId = 3
+
+	const objectState1 byte = 10
+	const objectState2 byte = 17
+
+	configInfo := &ConfigurationInfo{
+		Objects: map[int]*ObjectInfo{
+			objectId1: {objectId: objectId1, stationId: stationId1, hostId: hostId, typeId: typeId},
+		},
+		objectStates: map[int]map[int]*ObjectStateInfo{
+			typeId: {
+				int(objectState1): {Id: int(objectState1), Name: "Норма", Severity: 1},
+				int(objectState2): {Id: int(objectState2), Name: "Отказ", Severity: 3},
+			},
+		},
+	}
+
+	info := NewRuntimeConfiguration(configInfo)
+
+	now := time.Now().Add(-time.Minute * 10)
+	fullStatePackage := &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(now),
+		DeviceId:      core.GetSpecialDeviceForHost(hostId),
+		Format:        core.PackageFormatFullObjectStates,
+		Data:          []byte{core.PackageEventTypeObjectState, objectId1, 0, 0, 0, objectState1, 0},
+		BitsPerSensor: 8,
+		DataSize:      7,
+		SensorCount:   7}
+
+	_, err := info.updateFromPackage(fullStatePackage)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(objectState1), info.currentObjectStates[objectId1])
+
+	eventsPackage := &core.DataPackage{
+		Time:          core.GetUnixMicrosecondsFromTime(now.Add(time.Second)),
+		DeviceId:      core.GetSpecialDeviceForHost(hostId),
+		Format:        core.PackageFormatEvents,
+		Data:          []byte{core.PackageEventTypeObjectState, objectId1, 0, 0, 0, objectState2, 0},
+		BitsPerSensor: 8,
+		DataSize:      7,
+		SensorCount:   7}
+
+	res, err := info.GetUpdateRequestItemsFromPackage(eventsPackage)
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+
+	var eventInfo EventsDocument
+	err = json.Unmarshal([]byte(res[0].item), &eventInfo)
+	assert.Nil(t, err)
+
+	prevStateId := uint16(objectState1)
+	assert.Equal(t, []StateEvent{{
+		ObjectId:      objectId1,
+		StateId:       uint16(objectState2),
+		StateName:     "Отказ",
+		Severity:      3,
+		PrevStateId:   &prevStateId,
+		PrevStateName: "Норма",
+	}}, eventInfo.Sds)
+	assert.Equal(t, uint16(objectState2), info.currentObjectStates[objectId1])
+}
@@ -0,0 +1,116 @@
+package archive
+
+import "sort"
+
+// SharedSensorKind вид привязки нескольких измерений или атрибутов к одному датчику
+type SharedSensorKind int
+
+const (
+	// Датчик намеренно используется для нескольких измерений с одной единицей измерения
+	SharedSensorFanOut SharedSensorKind = iota + 1
+	// Измерения на датчике имеют разные единицы измерения
+	SharedSensorUnitConflict
+	// К датчику привязаны и измерения, и атрибуты
+	SharedSensorAttributeMeasureConflict
+)
+
+func (kind SharedSensorKind) String() string {
+	switch kind {
+	case SharedSensorFanOut:
+		return "fan-out"
+	case SharedSensorUnitConflict:
+		return "unit conflict"
+	case SharedSensorAttributeMeasureConflict:
+		return "attribute and measure conflict"
+	default:
+		return "unknown"
+	}
+}
+
+// IsConflict возвращает true, если привязка скорее всего является ошибкой конфигурации
+func (kind SharedSensorKind) IsConflict() bool {
+	return kind == SharedSensorUnitConflict || kind == SharedSensorAttributeMeasureConflict
+}
+
+// SharedSensorInfo датчик, к которому привязано несколько измерений или атрибутов
+type SharedSensorInfo struct {
+	DeviceId int
+	SensorId int
+	Kind     SharedSensorKind
+	Measures []MeasureMappingInfo
+}
+
+func getSharedSensorKind(measures []*archiveMeasureOrAttributeInfo) SharedSensorKind {
+	result := SharedSensorFanOut
+
+	for _, m := range measures[1:] {
+		if m.isAttribute != measures[0].isAttribute {
+			return SharedSensorAttributeMeasureConflict
+		}
+		if m.unitOfMeasure != measures[0].unitOfMeasure {
+			result = SharedSensorUnitConflict
+		}
+	}
+
+	return result
+}
+
+// GetSharedSensors возвращает датчики, к которым привязано несколько измерений или атрибутов,
+// упорядоченные по устройству и номеру датчика
+func (archiveConfig *ConfigurationInfo) GetSharedSensors() []SharedSensorInfo {
+	var result []SharedSensorInfo
+
+	for deviceId, deviceMapping := range archiveConfig.mappings {
+		for sensorId, sensorMapping := range deviceMapping {
+			if len(sensorMapping) < 2 {
+				continue
+			}
+
+			shared := SharedSensorInfo{
+				DeviceId: deviceId,
+				SensorId: sensorId,
+				Kind:     getSharedSensorKind(sensorMapping)}
+
+			for _, m := range sensorMapping {
+				shared.Measures = append(shared.Measures, *newMeasureMappingInfo(deviceId, sensorId, m))
+			}
+			sortMeasureMappings(shared.Measures)
+
+			result = append(result, shared)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DeviceId != result[j].DeviceId {
+			return result[i].DeviceId < result[j].DeviceId
+		}
+		return result[i].SensorId < result[j].SensorId
+	})
+
+	return result
+}
+
+// Удаляет привязки датчиков с конфликтующими измерениями и добавляет их в отчет
+func (archiveConfig *ConfigurationInfo) rejectSensorConflicts(report *ValidationReport) {
+	for _, shared := range archiveConfig.GetSharedSensors() {
+		if !shared.Kind.IsConflict() {
+			continue
+		}
+
+		reason := ReasonUnitConflict
+		if shared.Kind == SharedSensorAttributeMeasureConflict {
+			reason = ReasonAttributeMeasureConflict
+		}
+
+		for _, m := range shared.Measures {
+			report.add(reason, NewParameterOrAttributeMappingKey(m.ObjectId, m.MeasureId, m.IsAttribute),
+				deviceMappingItem{deviceId: m.DeviceId, sensorId: m.SensorId})
+		}
+
+		deviceMapping := archiveConfig.mappings[shared.DeviceId]
+		delete(deviceMapping, shared.SensorId)
+		if len(deviceMapping) == 0 {
+			delete(archiveConfig.mappings, shared.DeviceId)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package archive
+
+import (
+	configuration "github.com/imsat-spb/go-apkdk-configuration"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getSharedSensorsTestProject() *configuration.TestProjectData {
+	project := getDiffTestProject()
+	project.Parameters[102] = &configuration.ObjectParameter{Id: 102, Name: "U1", UnitOfMeasure: "Напряжение,кВ"}
+
+	// Датчик 0: измерение 100 объектов 1 и 2 с одной единицей измерения
+	project.ParameterMappings[configuration.NewParameterMappingKey(2, 100)] =
+		&configuration.ObjectParameterMapping{Id: 100, ObjectId: 2, DeviceId: 3, SensorId: 0}
+	// Датчик 3: атрибут 200 и измерение 101 объекта 1
+	project.ParameterMappings[configuration.NewParameterMappingKey(1, 101)] =
+		&configuration.ObjectParameterMapping{Id: 101, ObjectId: 1, DeviceId: 3, SensorId: 3}
+	// Датчик 5: измерения с разными единицами
+	project.ParameterMappings[configuration.NewParameterMappingKey(2, 101)] =
+		&configuration.ObjectParameterMapping{Id: 101, ObjectId: 2, DeviceId: 3, SensorId: 5}
+	project.ParameterMappings[configuration.NewParameterMappingKey(2, 102)] =
+		&configuration.ObjectParameterMapping{Id: 102, ObjectId: 2, DeviceId: 3, SensorId: 5}
+
+	return project
+}
+
+func TestGetSharedSensors(t *testing.T) {
+	info, err := NewConfigurationInfo(getSharedSensorsTestProject())
+
+	assert.Nil(t, err)
+
+	shared := info.GetSharedSensors()
+
+	assert.Equal(t, []SharedSensorInfo{
+		{DeviceId: 3, SensorId: 0, Kind: SharedSensorFanOut, Measures: []MeasureMappingInfo{
+			{ObjectId: 1, MeasureId: 100, DeviceId: 3, SensorId: 0, UnitOfMeasure: "В"},
+			{ObjectId: 2, MeasureId: 100, DeviceId: 3, SensorId: 0, UnitOfMeasure: "В"}}},
+		{DeviceId: 3, SensorId: 3, Kind: SharedSensorAttributeMeasureConflict, Measures: []MeasureMappingInfo{
+			{ObjectId: 1, MeasureId: 101, DeviceId: 3, SensorId: 3, UnitOfMeasure: "А"},
+			{ObjectId: 1, MeasureId: 200, IsAttribute: true, DeviceId: 3, SensorId: 3, UnitOfMeasure: "В"}}},
+		{DeviceId: 3, SensorId: 5, Kind: SharedSensorUnitConflict, Measures: []MeasureMappingInfo{
+			{ObjectId: 2, MeasureId: 101, DeviceId: 3, SensorId: 5, UnitOfMeasure: "А"},
+			{ObjectId: 2, MeasureId: 102, DeviceId: 3, SensorId: 5, UnitOfMeasure: "кВ"}}},
+	}, shared)
+
+	assert.False(t, shared[0].Kind.IsConflict())
+	assert.True(t, shared[1].Kind.IsConflict())
+	assert.True(t, shared[2].Kind.IsConflict())
+}
+
+func TestRejectSensorConflicts(t *testing.T) {
+	info, err := NewConfigurationInfo(getSharedSensorsTestProject(), WithoutSensorConflicts())
+
+	assert.Nil(t, err)
+
+	shared := info.GetSharedSensors()
+	assert.Len(t, shared, 1)
+	assert.Equal(t, SharedSensorFanOut, shared[0].Kind)
+
+	assert.Nil(t, info.GetMeasureMapping(1, 200, true))
+	assert.Nil(t, info.GetMeasureMapping(1, 101, false))
+	assert.Nil(t, info.GetMeasureMapping(2, 102, false))
+	assert.NotNil(t, info.GetMeasureMapping(2, 100, false))
+
+	report := info.GetValidationReport()
+	assert.Equal(t, []*MappingFinding{
+		{Reason: ReasonAttributeMeasureConflict, ObjectId: 1, MeasureId: 101, DeviceId: 3, SensorId: 3},
+		{Reason: ReasonAttributeMeasureConflict, ObjectId: 1, MeasureId: 200, IsAttribute: true, DeviceId: 3, SensorId: 3},
+		{Reason: ReasonUnitConflict, ObjectId: 2, MeasureId: 101, DeviceId: 3, SensorId: 5},
+		{Reason: ReasonUnitConflict, ObjectId: 2, MeasureId: 102, DeviceId: 3, SensorId: 5},
+	}, report.Findings)
+
+	_, err = NewConfigurationInfo(getSharedSensorsTestProject(), WithoutSensorConflicts(), WithStrictValidation())
+	assert.NotNil(t, err)
+}
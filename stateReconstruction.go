@@ -0,0 +1,392 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+	"sort"
+	"time"
+)
+
+// DocumentReader источник документов архива для восстановления состояния объектов
+type DocumentReader interface {
+	// ReadLatestDocuments возвращает для каждого устройства последний документ станции формата format
+	// со временем не позже before
+	ReadLatestDocuments(ctx context.Context, stationId int, format byte, before time.Time) ([][]byte, error)
+	// ReadDocuments вызывает handler для документов станции указанных форматов за период в порядке возрастания времени
+	ReadDocuments(ctx context.Context, stationId int, formats []byte, from time.Time, to time.Time,
+		handler func(document []byte) error) error
+}
+
+// ObjectFailureState действующий отказ объекта
+type ObjectFailureState struct {
+	FailureId uint32
+	Time      time.Time
+}
+
+// ObjectAccidentState незавершенный инцидент объекта
+type ObjectAccidentState struct {
+	AlgorithmId  int32
+	AccidentType byte
+	StartTime    time.Time
+}
+
+// ObjectNwaState алгоритм АНР, в котором находится объект
+type ObjectNwaState struct {
+	AlgorithmId uint32
+	StateId     int32
+	Time        time.Time
+}
+
+// ObjectStateSnapshot состояние объекта на момент времени
+type ObjectStateSnapshot struct {
+	ObjectId  uint32
+	HasState  bool
+	StateId   uint16
+	StateName string
+	Severity  int
+	Failures  []ObjectFailureState
+	Accidents []ObjectAccidentState
+	Nwa       []ObjectNwaState
+	// Последнее известное САНР объекта
+	NwaStateId *int32
+}
+
+// Виды состояния, для которых есть пакет полного состояния
+const (
+	stateKindObjects = iota
+	stateKindFailures
+	stateKindAccidents
+	stateKindCount
+)
+
+var fullStateFormats = [stateKindCount]byte{
+	core.PackageFormatFullObjectStates,
+	core.PackageFormatFullFailureStates,
+	core.PackageFormatFullAccidentStates}
+
+var changeStateFormats = []byte{
+	core.PackageFormatEvents,
+	core.PackageFormatChangeObjectStates,
+	core.PackageFormatChangeFailureStates}
+
+type objectStateAccumulator struct {
+	snapshot  *ObjectStateSnapshot
+	failures  map[uint32]time.Time
+	accidents map[int32]*ObjectAccidentState
+	nwa       map[uint32]*ObjectNwaState
+}
+
+type stateReconstruction struct {
+	archiveConfig *ConfigurationInfo
+	stationId     int
+	objects       map[uint32]*objectStateAccumulator
+	// Время полного состояния каждого вида по устройствам
+	baseTimes map[int32]*[stateKindCount]int64
+}
+
+func getTimeFromUnixMilliseconds(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+func (rc *stateReconstruction) getObject(objectId uint32) *objectStateAccumulator {
+	if rc.archiveConfig != nil {
+		obj, ok := rc.archiveConfig.Objects[int(objectId)]
+		if !ok || obj.stationId != rc.stationId {
+			return nil
+		}
+	}
+
+	result, ok := rc.objects[objectId]
+	if !ok {
+		result = &objectStateAccumulator{
+			snapshot:  &ObjectStateSnapshot{ObjectId: objectId},
+			failures:  make(map[uint32]time.Time),
+			accidents: make(map[int32]*ObjectAccidentState),
+			nwa:       make(map[uint32]*ObjectNwaState)}
+		rc.objects[objectId] = result
+	}
+
+	return result
+}
+
+func (rc *stateReconstruction) getObjectStateInfo(objectId uint32, stateId uint16) *ObjectStateInfo {
+	if rc.archiveConfig == nil {
+		return nil
+	}
+
+	obj, ok := rc.archiveConfig.Objects[int(objectId)]
+	if !ok {
+		return nil
+	}
+
+	return rc.archiveConfig.objectStates[obj.typeId][int(stateId)]
+}
+
+func (rc *stateReconstruction) applySds(events []StateEvent) {
+	for _, e := range events {
+		obj := rc.getObject(e.ObjectId)
+		if obj == nil {
+			continue
+		}
+
+		obj.snapshot.HasState = true
+		obj.snapshot.StateId = e.StateId
+		obj.snapshot.StateName = e.StateName
+		obj.snapshot.Severity = e.Severity
+
+		if state := rc.getObjectStateInfo(e.ObjectId, e.StateId); state != nil {
+			obj.snapshot.StateName = state.Name
+			obj.snapshot.Severity = state.Severity
+		}
+	}
+}
+
+func (rc *stateReconstruction) applyFailures(events []FailureEvent) {
+	for _, e := range events {
+		obj := rc.getObject(e.ObjectId)
+		if obj == nil {
+			continue
+		}
+
+		if e.IsStarted {
+			obj.failures[e.Fault] = getTimeFromUnixMilliseconds(e.FailureTime)
+		} else {
+			delete(obj.failures, e.Fault)
+		}
+	}
+}
+
+func (rc *stateReconstruction) applyAccidents(events []AccidentEvent) {
+	for _, e := range events {
+		obj := rc.getObject(e.ObjectId)
+		if obj == nil {
+			continue
+		}
+
+		// Для незавершенного инцидента время завершения не заполняется
+		if e.EndTime == 0 {
+			obj.accidents[e.AlgorithmId] = &ObjectAccidentState{
+				AlgorithmId:  e.AlgorithmId,
+				AccidentType: e.AccidentTypeId,
+				StartTime:    getTimeFromUnixMilliseconds(e.StartTime)}
+		} else {
+			delete(obj.accidents, e.AlgorithmId)
+		}
+	}
+}
+
+func (rc *stateReconstruction) applyNwa(events []NwaEvent, states []NwaStateEvent) {
+	for _, e := range events {
+		obj := rc.getObject(e.ObjectId)
+		if obj == nil {
+			continue
+		}
+
+		if e.IsStarted {
+			obj.nwa[e.AlgorithmId] = &ObjectNwaState{
+				AlgorithmId: e.AlgorithmId,
+				StateId:     e.StateId,
+				Time:        getTimeFromUnixMilliseconds(e.EventTime)}
+		} else {
+			delete(obj.nwa, e.AlgorithmId)
+		}
+	}
+
+	for _, e := range states {
+		obj := rc.getObject(e.ObjectId)
+		if obj == nil {
+			continue
+		}
+
+		stateId := e.StateId
+		obj.snapshot.NwaStateId = &stateId
+	}
+}
+
+// Документы полного состояния, записанные до появления разобранных полей, содержат только исходный пакет
+func getFullStateDocument(data []byte) (*FullStateDocument, error) {
+	decoded, err := DecodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, ok := decoded.(*FullStateDocument)
+	if !ok {
+		return nil, fmt.Errorf("full state document is expected")
+	}
+
+	if doc.RawData == "" || len(doc.Sds) != 0 || len(doc.Failures) != 0 || len(doc.Accidents) != 0 {
+		return doc, nil
+	}
+
+	packageInfo, err := decodeRawData(doc.RawData)
+	if err != nil {
+		return nil, err
+	}
+
+	switch packageInfo.Format {
+	case core.PackageFormatFullObjectStates:
+		states, err := packageInfo.ParseFullObjectStatePackage()
+		if err != nil {
+			return nil, err
+		}
+		doc.Sds = getSdsEvents(states, nil)
+	case core.PackageFormatFullFailureStates:
+		failures, err := packageInfo.ParseFullFailureStatePackage()
+		if err != nil {
+			return nil, err
+		}
+		doc.Failures = getFailureEvents(failures)
+	case core.PackageFormatFullAccidentStates:
+		accidents, err := parseFullAccidentStatePackage(packageInfo)
+		if err != nil {
+			return nil, err
+		}
+		doc.Accidents = getAccidentEvents(accidents)
+	}
+
+	return doc, nil
+}
+
+func (rc *stateReconstruction) applyFullState(ctx context.Context, reader DocumentReader, at time.Time) (int64, error) {
+	var docs []*FullStateDocument
+
+	for _, format := range fullStateFormats {
+		data, err := reader.ReadLatestDocuments(ctx, rc.stationId, format, at)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, d := range data {
+			doc, err := getFullStateDocument(d)
+			if err != nil {
+				return 0, err
+			}
+			docs = append(docs, doc)
+		}
+	}
+
+	if len(docs) == 0 {
+		return 0, fmt.Errorf("full state documents are not found for station {%d} before %s",
+			rc.stationId, at.Format(time.RFC3339Nano))
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].Time < docs[j].Time
+	})
+
+	from := docs[0].Time
+
+	for _, doc := range docs {
+		base, ok := rc.baseTimes[doc.DeviceId]
+		if !ok {
+			base = &[stateKindCount]int64{}
+			rc.baseTimes[doc.DeviceId] = base
+		}
+
+		switch doc.Format {
+		case core.PackageFormatFullObjectStates:
+			base[stateKindObjects] = doc.Time
+			rc.applySds(doc.Sds)
+		case core.PackageFormatFullFailureStates:
+			base[stateKindFailures] = doc.Time
+			rc.applyFailures(doc.Failures)
+		case core.PackageFormatFullAccidentStates:
+			base[stateKindAccidents] = doc.Time
+			rc.applyAccidents(doc.Accidents)
+		}
+	}
+
+	return from, nil
+}
+
+// Изменение применяется, если оно произошло после полного состояния устройства
+func (rc *stateReconstruction) isAfterBase(deviceId int32, kind int, eventTime int64) bool {
+	base, ok := rc.baseTimes[deviceId]
+	return !ok || eventTime > base[kind]
+}
+
+func (rc *stateReconstruction) applyChanges(data []byte) error {
+	decoded, err := DecodeDocument(data)
+	if err != nil {
+		return err
+	}
+
+	doc, ok := decoded.(*EventsDocument)
+	if !ok {
+		return nil
+	}
+
+	if rc.isAfterBase(doc.DeviceId, stateKindObjects, doc.Time) {
+		rc.applySds(doc.Sds)
+	}
+	if rc.isAfterBase(doc.DeviceId, stateKindFailures, doc.Time) {
+		rc.applyFailures(doc.Failures)
+	}
+	if rc.isAfterBase(doc.DeviceId, stateKindAccidents, doc.Time) {
+		rc.applyAccidents(doc.Accidents)
+	}
+	rc.applyNwa(doc.Nwa, doc.NwaState)
+
+	return nil
+}
+
+func (rc *stateReconstruction) getResult() map[uint32]*ObjectStateSnapshot {
+	result := make(map[uint32]*ObjectStateSnapshot)
+
+	for objectId, obj := range rc.objects {
+		snapshot := obj.snapshot
+
+		for failureId, failureTime := range obj.failures {
+			snapshot.Failures = append(snapshot.Failures, ObjectFailureState{FailureId: failureId, Time: failureTime})
+		}
+		sort.Slice(snapshot.Failures, func(i, j int) bool {
+			return snapshot.Failures[i].FailureId < snapshot.Failures[j].FailureId
+		})
+
+		for _, accident := range obj.accidents {
+			snapshot.Accidents = append(snapshot.Accidents, *accident)
+		}
+		sort.Slice(snapshot.Accidents, func(i, j int) bool {
+			return snapshot.Accidents[i].AlgorithmId < snapshot.Accidents[j].AlgorithmId
+		})
+
+		for _, nwa := range obj.nwa {
+			snapshot.Nwa = append(snapshot.Nwa, *nwa)
+		}
+		sort.Slice(snapshot.Nwa, func(i, j int) bool {
+			return snapshot.Nwa[i].AlgorithmId < snapshot.Nwa[j].AlgorithmId
+		})
+
+		result[objectId] = snapshot
+	}
+
+	return result
+}
+
+// ReconstructObjectStates восстанавливает состояние объектов станции на момент at: берет последние документы
+// полного состояния до at и применяет к ним изменения из последующих документов событий.
+// Если задана конфигурация архива, в результат попадают только объекты станции, а названия
+// состояний берутся из словаря состояний конфигурации
+func ReconstructObjectStates(ctx context.Context, reader DocumentReader, archiveConfig *ConfigurationInfo,
+	stationId int, at time.Time) (map[uint32]*ObjectStateSnapshot, error) {
+
+	rc := &stateReconstruction{
+		archiveConfig: archiveConfig,
+		stationId:     stationId,
+		objects:       make(map[uint32]*objectStateAccumulator),
+		baseTimes:     make(map[int32]*[stateKindCount]int64)}
+
+	from, err := rc.applyFullState(ctx, reader, at)
+	if err != nil {
+		return nil, err
+	}
+
+	err = reader.ReadDocuments(ctx, stationId, changeStateFormats, getTimeFromUnixMilliseconds(from), at, rc.applyChanges)
+	if err != nil {
+		return nil, err
+	}
+
+	return rc.getResult(), nil
+}
@@ -0,0 +1,213 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/imsat-spb/go-apkdk-core"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+type testDocumentReader struct {
+	documents [][]byte
+}
+
+type testDocumentHeader struct {
+	Time     int64 `json:"time"`
+	Stations []int `json:"stations"`
+	DeviceId int32 `json:"deviceId"`
+	Format   byte  `json:"format"`
+}
+
+func (reader *testDocumentReader) getHeaders(stationId int, formats []byte, from int64, to int64) ([]*testDocumentHeader, [][]byte) {
+	var headers []*testDocumentHeader
+	var docs [][]byte
+
+	for _, doc := range reader.documents {
+		header := &testDocumentHeader{}
+		if err := json.Unmarshal(doc, header); err != nil {
+			panic(err)
+		}
+
+		if header.Time < from || header.Time > to {
+			continue
+		}
+
+		hasStation, hasFormat := false, false
+		for _, s := range header.Stations {
+			hasStation = hasStation || s == stationId
+		}
+		for _, f := range formats {
+			hasFormat = hasFormat || f == header.Format
+		}
+
+		if hasStation && hasFormat {
+			headers = append(headers, header)
+			docs = append(docs, doc)
+		}
+	}
+
+	return headers, docs
+}
+
+func (reader *testDocumentReader) ReadLatestDocuments(ctx context.Context, stationId int, format byte, before time.Time) ([][]byte, error) {
+	headers, docs := reader.getHeaders(stationId, []byte{format}, 0, core.GetUnixMillisecondsFromTime(before))
+
+	latest := make(map[int32]int)
+	for i, header := range headers {
+		if j, ok := latest[header.DeviceId]; !ok || headers[j].Time < header.Time {
+			latest[header.DeviceId] = i
+		}
+	}
+
+	var result [][]byte
+	for _, i := range latest {
+		result = append(result, docs[i])
+	}
+
+	return result, nil
+}
+
+func (reader *testDocumentReader) ReadDocuments(ctx context.Context, stationId int, formats []byte, from time.Time, to time.Time,
+	handler func(document []byte) error) error {
+
+	headers, docs := reader.getHeaders(stationId, formats,
+		core.GetUnixMillisecondsFromTime(from), core.GetUnixMillisecondsFromTime(to))
+
+	indexes := make([]int, len(docs))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return headers[indexes[i]].Time < headers[indexes[j]].Time
+	})
+
+	for _, i := range indexes {
+		if err := handler(docs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getReconstructionTestReader() *testDocumentReader {
+	const stationId = 30000
+	deviceId := core.GetSpecialDeviceForHost(800)
+
+	// Документ первой версии схемы содержит только исходный пакет
+	objectStates := &core.DataPackage{
+		Time:     core.GetUnixMicrosecondsFromTime(time.Unix(1, 0)),
+		DeviceId: deviceId,
+		Format:   core.PackageFormatFullObjectStates,
+		Data: []byte{
+			core.PackageEventTypeObjectState, 100, 0, 0, 0, 10, 0,
+			core.PackageEventTypeObjectState, 200, 0, 0, 0, 17, 0,
+			core.PackageEventTypeObjectState, 44, 1, 0, 0, 1, 0},
+		DataSize: 21}
+
+	documents := []string{
+		fmt.Sprintf(`{"time":500,"stations":[%d],"deviceId":%d,"format":6,"sds":[{"objectId":100,"stateId":1}]}`,
+			stationId, deviceId),
+		fmt.Sprintf(`{"time":1000,"stations":[%d],"deviceId":%d,"format":6,"rawData":"%s"}`,
+			stationId, deviceId, objectStates.GetBase64String()),
+		fmt.Sprintf(`{"schemaVersion":2,"time":1000,"stations":[%d],"deviceId":%d,"format":2,`+
+			`"failures":[{"objectId":100,"faultId":5,"isStarted":true,"failureTime":900}]}`,
+			stationId, deviceId),
+		fmt.Sprintf(`{"schemaVersion":2,"time":600,"stations":[%d],"deviceId":%d,"format":5,`+
+			`"accidents":[{"objectId":200,"algorithmId":3,"accidentType":2,"startTime":550}]}`,
+			stationId, deviceId),
+		// Состояние объекта до полного состояния не применяется, инцидент после полного состояния инцидентов применяется
+		fmt.Sprintf(`{"schemaVersion":2,"time":800,"stations":[%d],"deviceId":%d,"format":1,`+
+			`"sds":[{"objectId":100,"stateId":99}],`+
+			`"accidents":[{"objectId":100,"algorithmId":4,"accidentType":2,"startTime":790}]}`,
+			stationId, deviceId),
+		fmt.Sprintf(`{"schemaVersion":2,"time":1500,"stations":[%d],"deviceId":%d,"format":1,`+
+			`"sds":[{"objectId":200,"stateId":20,"stateName":"Занят"}],`+
+			`"failures":[{"objectId":100,"faultId":5,"isStarted":false,"failureTime":1490}],`+
+			`"anr":[{"objectId":200,"algorithmId":7,"stateId":2,"isStarted":true,"time":1495}],`+
+			`"sanr":[{"objectId":200,"stateId":3,"time":1496}]}`,
+			stationId, deviceId),
+		fmt.Sprintf(`{"schemaVersion":2,"time":3000,"stations":[%d],"deviceId":%d,"format":1,`+
+			`"sds":[{"objectId":100,"stateId":50}]}`,
+			stationId, deviceId),
+	}
+
+	result := &testDocumentReader{}
+	for _, doc := range documents {
+		result.documents = append(result.documents, []byte(doc))
+	}
+
+	return result
+}
+
+func TestReconstructObjectStates(t *testing.T) {
+	reader := getReconstructionTestReader()
+
+	states, err := ReconstructObjectStates(context.Background(), reader, nil, 30000, time.Unix(2, 0))
+
+	assert.Nil(t, err)
+	assert.Len(t, states, 3)
+
+	obj := states[100]
+	assert.True(t, obj.HasState)
+	assert.Equal(t, uint16(10), obj.StateId)
+	assert.Empty(t, obj.Failures)
+	assert.Equal(t, []ObjectAccidentState{{AlgorithmId: 4, AccidentType: 2, StartTime: time.Unix(0, 790*int64(time.Millisecond))}},
+		obj.Accidents)
+	assert.Nil(t, obj.NwaStateId)
+
+	obj = states[200]
+	assert.Equal(t, uint16(20), obj.StateId)
+	assert.Equal(t, "Занят", obj.StateName)
+	assert.Equal(t, []ObjectAccidentState{{AlgorithmId: 3, AccidentType: 2, StartTime: time.Unix(0, 550*int64(time.Millisecond))}},
+		obj.Accidents)
+	assert.Equal(t, []ObjectNwaState{{AlgorithmId: 7, StateId: 2, Time: time.Unix(0, 1495*int64(time.Millisecond))}}, obj.Nwa)
+	assert.Equal(t, int32(3), *obj.NwaStateId)
+
+	assert.Equal(t, uint16(1), states[300].StateId)
+}
+
+func TestReconstructObjectStatesBeforeFailure(t *testing.T) {
+	reader := getReconstructionTestReader()
+
+	states, err := ReconstructObjectStates(context.Background(), reader, nil, 30000, time.Unix(1, 200*int64(time.Millisecond)))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ObjectFailureState{{FailureId: 5, Time: time.Unix(0, 900*int64(time.Millisecond))}}, states[100].Failures)
+	assert.Equal(t, uint16(17), states[200].StateId)
+	assert.Empty(t, states[200].Nwa)
+}
+
+func TestReconstructObjectStatesWithConfiguration(t *testing.T) {
+	reader := getReconstructionTestReader()
+
+	archiveConfig := &ConfigurationInfo{
+		Objects: map[int]*ObjectInfo{
+			100: {objectId: 100, stationId: 30000, typeId: 1},
+			200: {objectId: 200, stationId: 30000, typeId: 2},
+			300: {objectId: 300, stationId: 33000, typeId: 1}},
+		objectStates: map[int]map[int]*ObjectStateInfo{
+			1: {10: {Id: 10, Name: "Норма", Severity: 0}},
+			2: {20: {Id: 20, Name: "Занят по отказу", Severity: 2}}}}
+
+	states, err := ReconstructObjectStates(context.Background(), reader, archiveConfig, 30000, time.Unix(2, 0))
+
+	assert.Nil(t, err)
+	assert.Len(t, states, 2)
+	assert.Equal(t, "Норма", states[100].StateName)
+	assert.Equal(t, "Занят по отказу", states[200].StateName)
+	assert.Equal(t, 2, states[200].Severity)
+}
+
+func TestReconstructObjectStatesWithoutFullState(t *testing.T) {
+	reader := getReconstructionTestReader()
+
+	states, err := ReconstructObjectStates(context.Background(), reader, nil, 30000, time.Unix(0, 100*int64(time.Millisecond)))
+
+	assert.Nil(t, states)
+	assert.NotNil(t, err)
+}
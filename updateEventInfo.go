@@ -9,3 +9,12 @@ type createRequest struct {
 	Id      string `json:"_id"`
 	DocType string `json:"_type"`
 }
+
+// Возвращает параметры записи документа: create для документов архива, index для перезаписываемых
+// документов (пропусков). Для других запросов возвращает nil
+func getRequestAction(rq map[string]*createRequest) *createRequest {
+	if action, ok := rq["create"]; ok {
+		return action
+	}
+	return rq["index"]
+}
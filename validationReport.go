@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MappingReasonCode причина, по которой привязка измерения или атрибута не добавлена в архив
+type MappingReasonCode int
+
+const (
+	// Объект не объявлен в проекте
+	ReasonUndeclaredObject MappingReasonCode = iota + 1
+	// Измерение не объявлено в проекте
+	ReasonUnknownParameter
+	// Атрибут не объявлен в проекте
+	ReasonUnknownAttribute
+	// Устройство не найдено
+	ReasonUnknownDevice
+	// Номер датчика больше количества датчиков устройства
+	ReasonSensorOutOfRange
+	// Повторное описание привязки измерения или атрибута. Определяется только для проектов,
+	// реализующих ProjectMappingsInformation: configuration.ProjectInformation объединяет повторы
+	ReasonDuplicateMapping
+	// Датчик привязан к измерениям с разными единицами измерения
+	ReasonUnitConflict
+	// Датчик привязан и к измерениям, и к атрибутам
+	ReasonAttributeMeasureConflict
+)
+
+func (code MappingReasonCode) String() string {
+	switch code {
+	case ReasonUndeclaredObject:
+		return "undeclared object"
+	case ReasonUnknownParameter:
+		return "unknown parameter"
+	case ReasonUnknownAttribute:
+		return "unknown attribute"
+	case ReasonUnknownDevice:
+		return "unknown device"
+	case ReasonSensorOutOfRange:
+		return "sensor out of range"
+	case ReasonDuplicateMapping:
+		return "duplicate mapping"
+	case ReasonUnitConflict:
+		return "unit conflict"
+	case ReasonAttributeMeasureConflict:
+		return "attribute and measure conflict"
+	default:
+		return fmt.Sprintf("reason %d", int(code))
+	}
+}
+
+// MappingFinding пропущенная привязка измерения или атрибута
+type MappingFinding struct {
+	Reason      MappingReasonCode
+	ObjectId    int
+	MeasureId   int
+	IsAttribute bool
+	DeviceId    int
+	SensorId    int
+}
+
+func (finding *MappingFinding) String() string {
+	kind := "measure"
+	if finding.IsAttribute {
+		kind = "attribute"
+	}
+
+	return fmt.Sprintf("%s: object {%d} %s {%d} device {%d} sensor {%d}",
+		finding.Reason, finding.ObjectId, kind, finding.MeasureId, finding.DeviceId, finding.SensorId)
+}
+
+// ValidationReport список привязок, пропущенных при построении ConfigurationInfo
+type ValidationReport struct {
+	Findings []*MappingFinding
+}
+
+func (report *ValidationReport) add(reason MappingReasonCode, key ParameterOrAttributeMappingKey, mapping deviceMappingItem) {
+	report.Findings = append(report.Findings, &MappingFinding{
+		Reason:      reason,
+		ObjectId:    key.GetObjectId(),
+		MeasureId:   key.GetMeasureId(),
+		IsAttribute: key.isAttribute,
+		DeviceId:    mapping.deviceId,
+		SensorId:    mapping.sensorId})
+}
+
+// Привязки перебираются в случайном порядке, сортируем для стабильного отчета
+func (report *ValidationReport) sort() {
+	sort.Slice(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.ObjectId != b.ObjectId {
+			return a.ObjectId < b.ObjectId
+		}
+		if a.MeasureId != b.MeasureId {
+			return a.MeasureId < b.MeasureId
+		}
+		if a.IsAttribute != b.IsAttribute {
+			return !a.IsAttribute
+		}
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		if a.DeviceId != b.DeviceId {
+			return a.DeviceId < b.DeviceId
+		}
+		return a.SensorId < b.SensorId
+	})
+}
+
+func (report *ValidationReport) HasFindings() bool {
+	return len(report.Findings) > 0
+}
+
+func (report *ValidationReport) String() string {
+	var builder strings.Builder
+
+	for _, f := range report.Findings {
+		builder.WriteString(f.String())
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+// ValidationError возвращается NewConfigurationInfo при строгой проверке, если есть пропущенные привязки
+type ValidationError struct {
+	Report *ValidationReport
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("%d incorrect mappings found in project", len(err.Report.Findings))
+}
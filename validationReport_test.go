@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"errors"
+	configuration "github.com/imsat-spb/go-apkdk-configuration"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getProjectWithIncorrectMappings() *configuration.TestProjectData {
+	const objectId = 1
+	const deviceId = 3
+
+	return &configuration.TestProjectData{
+		Devices: map[int]*configuration.Device{
+			deviceId: {Id: deviceId, SensorCount: 10, BitsPerSensor: 32},
+		},
+		Objects: map[int]*configuration.ObjectInfo{
+			objectId: {Id: objectId, TypeId: 1, StationId: 1000}},
+		Parameters: map[int]*configuration.ObjectParameter{
+			100: {Id: 100, Name: "P"},
+			101: {Id: 101, Name: "P1"},
+			102: {Id: 102, Name: "P2"}},
+		ParameterMappings: map[configuration.ParameterMappingKey]*configuration.ObjectParameterMapping{
+			// Корректная привязка
+			configuration.NewParameterMappingKey(objectId, 100): {Id: 100, ObjectId: objectId, DeviceId: deviceId, SensorId: 0},
+			// Не объявленный объект
+			configuration.NewParameterMappingKey(2, 100): {Id: 100, ObjectId: 2, DeviceId: deviceId, SensorId: 1},
+			// Не объявленное измерение
+			configuration.NewParameterMappingKey(objectId, 200): {Id: 200, ObjectId: objectId, DeviceId: deviceId, SensorId: 2},
+			// Не найдено устройство
+			configuration.NewParameterMappingKey(objectId, 101): {Id: 101, ObjectId: objectId, DeviceId: 4, SensorId: 3},
+			// Номер датчика больше количества датчиков
+			configuration.NewParameterMappingKey(objectId, 102): {Id: 102, ObjectId: objectId, DeviceId: deviceId, SensorId: 10}},
+		AttributeMappings: map[configuration.ParameterMappingKey]*configuration.ObjectAttributeMapping{
+			// Не объявленный атрибут
+			configuration.NewParameterMappingKey(objectId, 300): {Id: 300, ObjectId: objectId, DeviceId: deviceId, SensorId: 4}},
+	}
+}
+
+func TestValidationReport(t *testing.T) {
+	info, err := NewConfigurationInfo(getProjectWithIncorrectMappings())
+
+	assert.Nil(t, err)
+	assert.Len(t, info.mappings[3], 1)
+
+	report := info.GetValidationReport()
+
+	assert.True(t, report.HasFindings())
+	assert.Equal(t, []*MappingFinding{
+		{Reason: ReasonUnknownDevice, ObjectId: 1, MeasureId: 101, DeviceId: 4, SensorId: 3},
+		{Reason: ReasonSensorOutOfRange, ObjectId: 1, MeasureId: 102, DeviceId: 3, SensorId: 10},
+		{Reason: ReasonUnknownParameter, ObjectId: 1, MeasureId: 200, DeviceId: 3, SensorId: 2},
+		{Reason: ReasonUnknownAttribute, ObjectId: 1, MeasureId: 300, IsAttribute: true, DeviceId: 3, SensorId: 4},
+		{Reason: ReasonUndeclaredObject, ObjectId: 2, MeasureId: 100, DeviceId: 3, SensorId: 1},
+	}, report.Findings)
+
+	assert.Equal(t, "undeclared object: object {2} measure {100} device {3} sensor {1}", report.Findings[4].String())
+}
+
+func TestStrictValidation(t *testing.T) {
+	info, err := NewConfigurationInfo(getProjectWithIncorrectMappings(), WithStrictValidation())
+
+	assert.Nil(t, info)
+
+	var validationError *ValidationError
+	assert.True(t, errors.As(err, &validationError))
+	assert.Len(t, validationError.Report.Findings, 5)
+
+	info, err = NewConfigurationInfo(&configuration.TestProjectData{}, WithStrictValidation())
+
+	assert.Nil(t, err)
+	assert.False(t, info.GetValidationReport().HasFindings())
+}